@@ -4,6 +4,8 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -20,10 +22,41 @@ type WebAppSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	Image string `json:"image,omitempty"`
 
-	// Message is the HTML body text served by nginx.
-	// +kubebuilder:validation:MinLength=1
+	// Message is the HTML body text served by nginx. Required unless content or source is set.
 	// +kubebuilder:validation:MaxLength=500
-	Message string `json:"message"`
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Content configures the pages rendered by the operator: Markdown, theme and translations.
+	// +optional
+	Content *ContentSpec `json:"content,omitempty"`
+
+	// Pages are further pages of the site, served next to the home page and
+	// listed, in order, in a navigation menu on every page and in /sitemap.xml.
+	// +kubebuilder:validation:MaxItems=50
+	// +listType=map
+	// +listMapKey=slug
+	// +optional
+	Pages []Page `json:"pages,omitempty"`
+
+	// BaseURL is the public URL of the site, e.g. https://www.example.com. It
+	// makes the locations in /sitemap.xml absolute, as search engines expect.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	BaseURL string `json:"baseURL,omitempty"`
+
+	// Schedule publishes content at given times. From its time on, an entry
+	// replaces the home page until the next entry is due; before the first,
+	// the message and content above are served. Entries are in chronological
+	// order. Revisions record the schedule itself, so rollout windows and
+	// approval hold changes to it, but not entries going live on time.
+	// +kubebuilder:validation:MaxItems=50
+	// +optional
+	Schedule []ScheduledContent `json:"schedule,omitempty"`
+
+	// Source serves the site from an external source instead of the message page.
+	// +optional
+	Source *SourceSpec `json:"source,omitempty"`
 
 	// Port is the container port nginx listens on.
 	// +kubebuilder:validation:Minimum=1
@@ -44,6 +77,618 @@ type WebAppSpec struct {
 	// +kubebuilder:validation:Minimum=0
 	// +kubebuilder:default=1
 	MaxUnavailable int32 `json:"maxUnavailable,omitempty"`
+
+	// Maintenance swaps the site for a maintenance page answered with HTTP 503,
+	// leaving its content in place. It is not recorded in revisions, so it is
+	// never held by rollout windows nor undone by a rollback. Toggling it and
+	// changing its message reach the running Pods without a rollout, while
+	// changing allowedCIDRs or retryAfterSeconds rolls them.
+	// +optional
+	Maintenance *MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Monitoring configures Prometheus scraping of the nginx Pods.
+	// +optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// DeletionPolicy controls what happens to the child resources when the WebApp is deleted.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// DriftPolicy controls what happens to out-of-band edits of the Deployment,
+	// Service and ConfigMaps. Enforce overwrites them; Report leaves them in
+	// place and reports them in the Drifted condition.
+	// +kubebuilder:default=Enforce
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// AdoptionPolicy controls what happens when a resource with the name of a
+	// child already exists and is not owned by the WebApp. Refuse leaves it
+	// alone and reports the NameConflict condition; Adopt takes ownership of it.
+	// Resources controlled by another owner are never adopted.
+	// +kubebuilder:default=Refuse
+	// +optional
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// Rollout selects how changes to the served page are rolled out.
+	// +optional
+	Rollout *RolloutSpec `json:"rollout,omitempty"`
+
+	// RevisionHistoryLimit is the number of old revisions kept for rollback.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=10
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RollbackTo restores the image, content and server configuration recorded
+	// in the given revision. The operator clears it once the rollback is applied.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RollbackTo *int64 `json:"rollbackTo,omitempty"`
+
+	// Tests are HTTP smoke tests run against the Service after each rollout.
+	// +optional
+	Tests *TestsSpec `json:"tests,omitempty"`
+
+	// Build renders the site from source.git with a static site generator
+	// before serving it.
+	// +optional
+	Build *BuildSpec `json:"build,omitempty"`
+}
+
+// BuildSpec runs a static site generator in a Job for every commit of the git
+// source. The output is kept on a PersistentVolumeClaim and served once the
+// build succeeds; until then, and whenever a build fails, the Pods keep serving
+// the last successful build.
+type BuildSpec struct {
+	// Image is the builder image, e.g. "hugomods/hugo:0.121.2".
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+
+	// Command renders the site. It runs in the checked-out source.git
+	// subdirectory and must write the site to $OUTPUT_DIR, e.g.
+	// ["hugo", "--destination", "$(OUTPUT_DIR)"].
+	// +kubebuilder:validation:MinItems=1
+	Command []string `json:"command"`
+
+	// Storage configures the PersistentVolumeClaim holding the builds.
+	// +optional
+	Storage *BuildStorage `json:"storage,omitempty"`
+}
+
+// BuildStorage configures the PersistentVolumeClaim holding the build output.
+type BuildStorage struct {
+	// Size is the requested capacity.
+	// +kubebuilder:default="1Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName is the storage class of the claim. Empty uses the default class.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessMode of the claim. Replicas spread over several nodes need ReadWriteMany.
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteMany
+	// +kubebuilder:default=ReadWriteOnce
+	// +optional
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+
+	// ReadWriteOncePolicy decides what happens when a ReadWriteOnce claim
+	// serves more than one replica, as for source.volume. Reject reports the
+	// conflict in the BuildSucceeded condition and leaves the Deployment as it
+	// is; SameNode schedules all Pods, and the build Jobs if possible, onto one node.
+	// +kubebuilder:default=Reject
+	// +optional
+	ReadWriteOncePolicy ReadWriteOncePolicy `json:"readWriteOncePolicy,omitempty"`
+}
+
+// ContentSpec configures the pages rendered into the html ConfigMap.
+type ContentSpec struct {
+	// Markdown is rendered to HTML as the index page.
+	// +optional
+	Markdown *MarkdownContent `json:"markdown,omitempty"`
+
+	// Theme is the built-in stylesheet of the page.
+	// +kubebuilder:default=Light
+	// +optional
+	Theme Theme `json:"theme,omitempty"`
+
+	// DefaultLocale is the BCP 47 language tag of spec.message, spec.pages and
+	// the Markdown, served when no locale matches the Accept-Language header of
+	// a request. Defaults to en when locales are set.
+	// +kubebuilder:validation:MaxLength=35
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$`
+	// +optional
+	DefaultLocale string `json:"defaultLocale,omitempty"`
+
+	// Locales are translations of the site. Each request is served the locale
+	// best matching its Accept-Language header.
+	// +kubebuilder:validation:MaxItems=20
+	// +listType=map
+	// +listMapKey=tag
+	// +optional
+	Locales []Locale `json:"locales,omitempty"`
+}
+
+// Locale is a translation of the site. What it leaves out is served in the
+// default locale.
+type Locale struct {
+	// Tag is the BCP 47 language tag of the translation, e.g. de or pt-BR.
+	// It is written into the nginx configuration and file names, so the
+	// schema admits only letters, digits and hyphens even without the webhook.
+	// +kubebuilder:validation:MaxLength=35
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$`
+	Tag string `json:"tag"`
+
+	// Message translates spec.message, and replaces the Markdown home page.
+	// +kubebuilder:validation:MaxLength=500
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Pages translate the spec.pages with the same slugs.
+	// +kubebuilder:validation:MaxItems=50
+	// +listType=map
+	// +listMapKey=slug
+	// +optional
+	Pages []Page `json:"pages,omitempty"`
+}
+
+// ScheduledContent replaces the home page from a given time on.
+type ScheduledContent struct {
+	// At is the wall-clock time the entry goes live, e.g. "2026-12-24T18:00".
+	// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}(:[0-9]{2})?$`
+	At string `json:"at"`
+
+	// TimeZone is the IANA time zone of at, e.g. "Europe/Berlin".
+	// +kubebuilder:default=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Message replaces spec.message and the Markdown home page.
+	// +kubebuilder:validation:MaxLength=500
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// ContentRef selects a key of a ConfigMap in the WebApp's namespace holding
+	// Markdown, rendered as the home page like spec.content.markdown.
+	// +optional
+	ContentRef *corev1.ConfigMapKeySelector `json:"contentRef,omitempty"`
+}
+
+// MarkdownContent is a Markdown document, given inline or in a ConfigMap. It
+// may start with a front-matter block between "---" lines setting the page
+// title, e.g. "title: Release notes".
+type MarkdownContent struct {
+	// Inline is the Markdown text.
+	// +kubebuilder:validation:MaxLength=262144
+	// +optional
+	Inline string `json:"inline,omitempty"`
+
+	// ConfigMapRef selects a key of a ConfigMap in the WebApp's namespace
+	// holding the Markdown text. Changes to it are rendered as they happen.
+	// +optional
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
+
+	// AllowRawHTML passes HTML embedded in the Markdown through to the page.
+	// By default it is left out, and script tags are rejected.
+	// +optional
+	AllowRawHTML bool `json:"allowRawHTML,omitempty"`
+}
+
+// Theme selects a built-in stylesheet for rendered content.
+// +kubebuilder:validation:Enum=Plain;Light;Dark
+type Theme string
+
+const (
+	// ThemePlain adds no styles.
+	ThemePlain Theme = "Plain"
+	// ThemeLight sets dark text on a light background in a readable column.
+	ThemeLight Theme = "Light"
+	// ThemeDark sets light text on a dark background in a readable column.
+	ThemeDark Theme = "Dark"
+)
+
+// Page is a page of the site, served at /<slug>.
+type Page struct {
+	// Slug is the path of the page below the site root.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Slug string `json:"slug"`
+
+	// Title is the page title and its entry in the navigation menu.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=100
+	Title string `json:"title"`
+
+	// Body is the Markdown text of the page. Embedded HTML is left out.
+	// +kubebuilder:validation:MaxLength=65536
+	// +optional
+	Body string `json:"body,omitempty"`
+}
+
+// SourceSpec selects where the served content comes from. At most one source may be set.
+type SourceSpec struct {
+	// Git serves the files of a git repository.
+	// +optional
+	Git *GitSource `json:"git,omitempty"`
+
+	// Archive serves the files of a tarball or OCI artifact.
+	// +optional
+	Archive *ArchiveSource `json:"archive,omitempty"`
+
+	// Volume serves the files of a PersistentVolumeClaim.
+	// +optional
+	Volume *VolumeSource `json:"volume,omitempty"`
+
+	// Upload serves the files last uploaded to the operator's upload endpoint.
+	// +optional
+	Upload *UploadSource `json:"upload,omitempty"`
+}
+
+// UploadSource serves a tarball uploaded to the operator's upload endpoint,
+// which stores it in ConfigMaps and sets the fields below. An init container
+// joins the ConfigMaps, verifies the digest and unpacks the tarball; each
+// upload rolls out the Pods.
+type UploadSource struct {
+	// Revision counts the uploads. Zero serves the message page until the first upload.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+
+	// SHA256 is the hex-encoded digest of the uploaded tarball.
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Chunks is the number of ConfigMaps the tarball is split across.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Chunks int32 `json:"chunks,omitempty"`
+
+	// Image runs the init container unpacking the tarball.
+	// +kubebuilder:default="busybox:1.36"
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// VolumeSource serves the files on a PersistentVolumeClaim, mounted read-only
+// at the served directory, for sites too large for a ConfigMap. The files are
+// uploaded to the claim out of band.
+type VolumeSource struct {
+	// ClaimName references an existing claim in the WebApp's namespace.
+	// +optional
+	ClaimName string `json:"claimName,omitempty"`
+
+	// ClaimTemplate has the operator create the claim <name>-content, deleted
+	// with the WebApp.
+	// +optional
+	ClaimTemplate *VolumeClaimTemplate `json:"claimTemplate,omitempty"`
+
+	// SubPath is the served directory inside the volume.
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+
+	// ReadWriteOncePolicy decides what happens when a claim only one node can
+	// mount backs more than one replica. Reject reports the conflict in the
+	// VolumeReady condition and leaves the Deployment as it is; SameNode
+	// schedules all Pods onto one node.
+	// +kubebuilder:default=Reject
+	// +optional
+	ReadWriteOncePolicy ReadWriteOncePolicy `json:"readWriteOncePolicy,omitempty"`
+}
+
+// VolumeClaimTemplate configures the PersistentVolumeClaim created for a volume source.
+type VolumeClaimTemplate struct {
+	// Size is the requested capacity.
+	// +kubebuilder:default="1Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName is the storage class of the claim. Empty uses the default class.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessMode of the claim. Replicas spread over several nodes need ReadWriteMany or ReadOnlyMany.
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteMany;ReadOnlyMany
+	// +kubebuilder:default=ReadWriteOnce
+	// +optional
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// ReadWriteOncePolicy selects how replicas share a claim only one node can mount.
+// +kubebuilder:validation:Enum=Reject;SameNode
+type ReadWriteOncePolicy string
+
+const (
+	// ReadWriteOncePolicyReject refuses to run more than one replica.
+	ReadWriteOncePolicyReject ReadWriteOncePolicy = "Reject"
+	// ReadWriteOncePolicySameNode schedules all replicas onto one node.
+	ReadWriteOncePolicySameNode ReadWriteOncePolicy = "SameNode"
+)
+
+// ArchiveSource serves the files of a published build. An init container
+// downloads it, verifies its digest and unpacks it into the served directory;
+// a digest mismatch fails the Pod start and is reported in the SourceVerified
+// condition. Changing the digest rolls out the Pods.
+type ArchiveSource struct {
+	// URL is an http(s):// URL of a tarball (optionally gzip-compressed), or an
+	// oci:// reference of an artifact whose layers are tarballs, e.g.
+	// oci://ghcr.io/example/site:v1.
+	// +kubebuilder:validation:Pattern=`^(https?|oci)://`
+	URL string `json:"url"`
+
+	// SHA256 is the hex-encoded SHA-256 digest of the tarball, or of the
+	// manifest of the OCI artifact.
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256"`
+
+	// PullSecretRef names a Secret with credentials: "username" and "password"
+	// keys for basic auth over HTTP(S), or a kubernetes.io/dockerconfigjson
+	// Secret for OCI registries.
+	// +optional
+	PullSecretRef *corev1.LocalObjectReference `json:"pullSecretRef,omitempty"`
+
+	// Image runs the download. It needs a POSIX shell, sha256sum and tar, plus
+	// curl for HTTP(S) or oras for OCI. Defaults to curlimages/curl:8.5.0 for
+	// HTTP(S) and ghcr.io/oras-project/oras:v1.1.0 for OCI.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// GitSource serves the files of a git repository. The operator resolves the ref
+// to a commit every interval and rolls out the Pods when the commit changes;
+// an init container clones that commit into the served directory.
+type GitSource struct {
+	// URL is the repository URL. http(s):// and git:// URLs are supported.
+	// +kubebuilder:validation:Pattern=`^(https?|git)://`
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or full commit SHA to serve.
+	// +kubebuilder:default=main
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Commit pins the full commit SHA to serve, skipping the lookup of ref.
+	// The operator pins the commit ref resolves to in the revisions it records,
+	// so a new commit is held by the rollout gate like any other change, and a
+	// rollback pins the commit it restores. Clear it to follow ref again.
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{40}([0-9a-f]{24})?$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Subdirectory is the directory of the repository served as the site root.
+	// +kubebuilder:validation:Pattern=`^[^/]`
+	// +optional
+	Subdirectory string `json:"subdirectory,omitempty"`
+
+	// SecretRef names a Secret with "username" and "password" keys, used as
+	// basic auth for HTTP(S) repositories, e.g. with a personal access token.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Interval is how often the ref is resolved again, e.g. "5m".
+	// +kubebuilder:default="1m"
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ms|s|m|h))+$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
+
+	// Image is the git-sync image that clones the repository into the Pods.
+	// +kubebuilder:default="registry.k8s.io/git-sync/git-sync:v4.2.1"
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// TestsSpec configures the smoke tests run after each rollout completes. The
+// checks run in a Job; the outcome is reported in the TestsPassed condition.
+type TestsSpec struct {
+	// Checks are the HTTP requests made against the Service.
+	// +kubebuilder:validation:MinItems=1
+	Checks []HTTPCheck `json:"checks"`
+
+	// Image runs the checks. It needs a POSIX shell, curl and grep.
+	// +kubebuilder:default="curlimages/curl:8.5.0"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// RollbackOnFailure reverts to the previous revision when the tests fail.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+// HTTPCheck is a single smoke-test request.
+type HTTPCheck struct {
+	// Path is the request path.
+	// +kubebuilder:default="/"
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path,omitempty"`
+
+	// ExpectedStatus is the expected HTTP status code.
+	// +kubebuilder:default=200
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:validation:Maximum=599
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+
+	// BodyContains is a substring the response body must contain.
+	// +optional
+	BodyContains string `json:"bodyContains,omitempty"`
+
+	// BodyRegex is an extended regular expression the response body must match.
+	// +optional
+	BodyRegex string `json:"bodyRegex,omitempty"`
+}
+
+// RolloutStrategy selects how a new version of the WebApp replaces the old one.
+// +kubebuilder:validation:Enum=RollingUpdate;BlueGreen;Canary
+type RolloutStrategy string
+
+const (
+	// RolloutStrategyRollingUpdate updates the single Deployment in place.
+	RolloutStrategyRollingUpdate RolloutStrategy = "RollingUpdate"
+	// RolloutStrategyBlueGreen brings up the new version next to the old one and
+	// switches the Service once it is fully ready.
+	RolloutStrategyBlueGreen RolloutStrategy = "BlueGreen"
+	// RolloutStrategyCanary shifts traffic to the new version step by step.
+	RolloutStrategyCanary RolloutStrategy = "Canary"
+)
+
+// RolloutSpec configures the rollout strategy.
+type RolloutSpec struct {
+	// Strategy selects the rollout strategy.
+	// +kubebuilder:default=RollingUpdate
+	Strategy RolloutStrategy `json:"strategy,omitempty"`
+
+	// BlueGreen tunes the BlueGreen strategy.
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+
+	// Canary configures the Canary strategy. Required when strategy is Canary.
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+
+	// Windows restrict when a new revision may roll out. Outside every window
+	// the Deployment is held at the previous revision until the next window
+	// opens. Scaling is never held. Empty means changes roll out at any time.
+	// +optional
+	Windows []RolloutWindow `json:"windows,omitempty"`
+
+	// RequireApproval holds every new revision until the WebApp is annotated
+	// with apps.codewizard.io/approved-generation set to its metadata.generation.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// RolloutWindow is a recurring period during which new revisions may roll out.
+type RolloutWindow struct {
+	// Schedule is a cron expression ("minute hour day-of-month month day-of-week")
+	// for when the window opens, e.g. "0 22 * * 1-5" for weekdays at 22:00.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open, e.g. "2h".
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ms|s|m|h))+$`
+	Duration string `json:"duration"`
+
+	// TimeZone is the IANA time zone of the schedule, e.g. "Europe/Berlin".
+	// +kubebuilder:default=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// BlueGreenStrategy tunes the BlueGreen rollout strategy.
+type BlueGreenStrategy struct {
+	// ScaleDownDelaySeconds is how long the previously active color keeps running
+	// after the switch, so traffic can be switched back quickly.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=30
+	// +optional
+	ScaleDownDelaySeconds int32 `json:"scaleDownDelaySeconds"`
+}
+
+// CanaryStrategy configures the Canary rollout strategy. A stable and a canary
+// Deployment sit behind the shared Service, so traffic is split by their
+// replica ratio. After the last step the new version is promoted to stable.
+type CanaryStrategy struct {
+	// Steps are run in order for every new version.
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+}
+
+// CanaryStep is one stage of a Canary rollout.
+type CanaryStep struct {
+	// Weight is the percentage of replicas, and so of traffic, running the new version.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Pause is how long the step is held once the canary is ready (e.g. "5m").
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ms|s|m|h))+$`
+	// +optional
+	Pause string `json:"pause,omitempty"`
+
+	// Manual holds the step until the WebApp is annotated with
+	// apps.codewizard.io/promote-canary=true.
+	// +optional
+	Manual bool `json:"manual,omitempty"`
+}
+
+// DeletionPolicy selects which child resources survive the deletion of their WebApp.
+// +kubebuilder:validation:Enum=Delete;Orphan;RetainService
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete garbage-collects every child resource with the WebApp.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan releases every child resource so another owner can take it over.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// DeletionPolicyRetainService releases only the Service (e.g. to keep a LoadBalancer IP).
+	DeletionPolicyRetainService DeletionPolicy = "RetainService"
+)
+
+// DriftPolicy selects how the operator treats out-of-band edits of its child resources.
+// +kubebuilder:validation:Enum=Enforce;Report
+type DriftPolicy string
+
+const (
+	// DriftPolicyEnforce restores every drifted field to the desired state.
+	DriftPolicyEnforce DriftPolicy = "Enforce"
+	// DriftPolicyReport leaves fields last written by someone else untouched and reports them.
+	DriftPolicyReport DriftPolicy = "Report"
+)
+
+// AdoptionPolicy selects whether pre-existing resources with a child's name are taken over.
+// +kubebuilder:validation:Enum=Refuse;Adopt
+type AdoptionPolicy string
+
+const (
+	// AdoptionPolicyRefuse leaves unowned resources with a child's name untouched.
+	AdoptionPolicyRefuse AdoptionPolicy = "Refuse"
+	// AdoptionPolicyAdopt makes the WebApp the controller of unowned resources with a child's name.
+	AdoptionPolicyAdopt AdoptionPolicy = "Adopt"
+)
+
+// MaintenanceSpec configures the maintenance page.
+type MaintenanceSpec struct {
+	// Enabled serves the maintenance page instead of the site.
+	Enabled bool `json:"enabled"`
+
+	// Message is the text of the maintenance page.
+	// +kubebuilder:validation:MaxLength=500
+	// +kubebuilder:default="This site is down for maintenance. Please check back soon."
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// AllowedCIDRs are the client address ranges that still see the site,
+	// e.g. "10.0.0.0/8" or "203.0.113.7/32".
+	// +kubebuilder:validation:MaxItems=50
+	// +kubebuilder:validation:items:MaxLength=43
+	// +kubebuilder:validation:items:Pattern=`^((25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])(\.(25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])){3}/(3[0-2]|[12]?[0-9])|[0-9a-fA-F:.]*:[0-9a-fA-F:.]*/(12[0-8]|1[01][0-9]|[1-9]?[0-9]))$`
+	// +optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+
+	// RetryAfterSeconds is sent in the Retry-After header of the maintenance page.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=300
+	// +optional
+	RetryAfterSeconds int32 `json:"retryAfterSeconds,omitempty"`
+}
+
+// MonitoringSpec configures the nginx metrics exporter and its ServiceMonitor.
+type MonitoringSpec struct {
+	// Enabled injects an nginx-prometheus-exporter sidecar, adds a "metrics" port
+	// to the Service, and creates a ServiceMonitor when the Prometheus Operator is installed.
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// ExporterImage is the nginx-prometheus-exporter container image.
+	// +kubebuilder:default="nginx/nginx-prometheus-exporter:1.1.0"
+	// +optional
+	ExporterImage string `json:"exporterImage,omitempty"`
+
+	// Interval is the Prometheus scrape interval set on the ServiceMonitor.
+	// +kubebuilder:default="30s"
+	// +kubebuilder:validation:Pattern=`^([0-9]+(ms|s|m|h))+$`
+	// +optional
+	Interval string `json:"interval,omitempty"`
 }
 
 // WebAppPhase is a simple enum for the overall lifecycle state.
@@ -63,10 +708,224 @@ const (
 	ConditionTypeAvailable = "Available"
 	// ConditionTypeProgressing means a rollout or scale is in progress.
 	ConditionTypeProgressing = "Progressing"
+	// ConditionTypeTestsPassed reports the outcome of the smoke tests of the current revision.
+	ConditionTypeTestsPassed = "TestsPassed"
+	// ConditionTypeRolloutBlocked reports that a new revision is held by a rollout window or approval gate.
+	ConditionTypeRolloutBlocked = "RolloutBlocked"
+	// ConditionTypePaused reports that reconciliation is paused through spec.paused.
+	ConditionTypePaused = "Paused"
+	// ConditionTypeDrifted lists child fields edited out-of-band and left in place by driftPolicy Report.
+	ConditionTypeDrifted = "Drifted"
+	// ConditionTypeNameConflict lists resources with a child's name that the WebApp does not own.
+	ConditionTypeNameConflict = "NameConflict"
+	// ConditionTypeSourceSynced reports whether the git source ref was last resolved successfully.
+	ConditionTypeSourceSynced = "SourceSynced"
+	// ConditionTypeSourceVerified reports whether the Pods verified the digest of the archive source.
+	ConditionTypeSourceVerified = "SourceVerified"
+	// ConditionTypeBuildSucceeded reports the outcome of the build of the current source commit.
+	ConditionTypeBuildSucceeded = "BuildSucceeded"
+	// ConditionTypeVolumeReady reports whether the claim of the volume source is bound and fits the replicas.
+	ConditionTypeVolumeReady = "VolumeReady"
+	// ConditionTypeContentReady reports whether the Markdown content was rendered as given.
+	ConditionTypeContentReady = "ContentReady"
+	// ConditionTypeMaintenance reports whether the maintenance page is served.
+	ConditionTypeMaintenance = "Maintenance"
 	// ConditionTypeDegraded means some (but not all) replicas are ready.
 	ConditionTypeDegraded = "Degraded"
 )
 
+// Annotations recognised on a WebApp.
+const (
+	// AnnotationSkipFinalizers, when set to "true" on a WebApp being deleted,
+	// skips any cleanup hooks that have not completed yet so deletion can proceed.
+	AnnotationSkipFinalizers = "apps.codewizard.io/skip-finalizers"
+
+	// AnnotationPromoteCanary, when set to "true", releases the current manual
+	// Canary step. The operator removes it once the step has been passed.
+	AnnotationPromoteCanary = "apps.codewizard.io/promote-canary"
+
+	// AnnotationAbortRollout, when set to "true", aborts the Canary rollout in
+	// progress: the canary is removed and the stable version takes all traffic.
+	// The operator removes it; the next spec change starts a new rollout.
+	AnnotationAbortRollout = "apps.codewizard.io/abort-rollout"
+
+	// AnnotationRollbackTo, set to a revision number, has the same effect as
+	// spec.rollbackTo. The operator removes it once the rollback is applied.
+	AnnotationRollbackTo = "apps.codewizard.io/rollback-to"
+
+	// AnnotationRestartedAt, set to an RFC 3339 timestamp, restarts the WebApp's
+	// Pods, like kubectl rollout restart. Changing the value restarts them again.
+	AnnotationRestartedAt = "apps.codewizard.io/restartedAt"
+
+	// AnnotationApprovedGeneration approves the rollout of the spec at the given
+	// metadata.generation when spec.rollout.requireApproval is set.
+	AnnotationApprovedGeneration = "apps.codewizard.io/approved-generation"
+)
+
+// AnnotationBreakGlass, set to "true" on a child resource of a WebApp, lets
+// anyone update or delete it despite the child protection webhook.
+const AnnotationBreakGlass = "apps.codewizard.io/break-glass"
+
+// FinalizerHookState is the outcome of the latest run of a cleanup hook.
+// +kubebuilder:validation:Enum=Pending;Succeeded;Failed;Skipped
+type FinalizerHookState string
+
+const (
+	FinalizerHookPending   FinalizerHookState = "Pending"
+	FinalizerHookSucceeded FinalizerHookState = "Succeeded"
+	FinalizerHookFailed    FinalizerHookState = "Failed"
+	FinalizerHookSkipped   FinalizerHookState = "Skipped"
+)
+
+// FinalizerHookStatus reports the progress of one cleanup hook during deletion.
+type FinalizerHookStatus struct {
+	// Name identifies the cleanup hook.
+	Name string `json:"name"`
+
+	// State is the outcome of the latest attempt.
+	State FinalizerHookState `json:"state"`
+
+	// Attempts is the number of times the hook has been run.
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Message holds the error returned by the latest failed attempt.
+	Message string `json:"message,omitempty"`
+
+	// LastAttemptTime is when the hook was last run.
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+}
+
+// RolloutStatus reports the state of a BlueGreen or Canary rollout.
+type RolloutStatus struct {
+	// ActiveColor is the color ("blue" or "green") currently receiving traffic.
+	ActiveColor string `json:"activeColor,omitempty"`
+
+	// PreviewColor is the standby color, where the next version is brought up.
+	PreviewColor string `json:"previewColor,omitempty"`
+
+	// PreviewServiceName is the Service that always points at the preview color.
+	PreviewServiceName string `json:"previewServiceName,omitempty"`
+
+	// ScaleDownAt is when the previously active color will be scaled to zero.
+	// +optional
+	ScaleDownAt *metav1.Time `json:"scaleDownAt,omitempty"`
+
+	// CanaryHash identifies the version being rolled out as a canary.
+	CanaryHash string `json:"canaryHash,omitempty"`
+
+	// CurrentStep is the index of the Canary step in progress.
+	// +optional
+	CurrentStep *int32 `json:"currentStep,omitempty"`
+
+	// CanaryWeight is the percentage of replicas currently running the canary.
+	CanaryWeight int32 `json:"canaryWeight,omitempty"`
+
+	// StepStartedAt is when the canary became ready at the current step.
+	// +optional
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+
+	// Aborted reports that the rollout of CanaryHash was aborted.
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// PendingChange describes how one child resource would change if the paused
+// WebApp were resumed.
+type PendingChange struct {
+	// Kind is the kind of the child, e.g. "Deployment".
+	Kind string `json:"kind"`
+
+	// Name is the name of the child.
+	Name string `json:"name"`
+
+	// Action is "Create" for a missing child or "Update" for one that differs.
+	Action string `json:"action"`
+
+	// Fields lists the fields that would change, e.g. "spec.replicas: 2 -> 3".
+	// +optional
+	Fields []string `json:"fields,omitempty"`
+}
+
+// ScheduleStatus reports the entries of spec.schedule being served and due next.
+type ScheduleStatus struct {
+	// Active is the index of the entry being served. Unset before the first entry is due.
+	// +optional
+	Active *int32 `json:"active,omitempty"`
+
+	// ActiveSince is when the active entry went live.
+	// +optional
+	ActiveSince *metav1.Time `json:"activeSince,omitempty"`
+
+	// Next is the index of the next entry to go live. Unset after the last entry.
+	// +optional
+	Next *int32 `json:"next,omitempty"`
+
+	// NextAt is when the next entry goes live.
+	// +optional
+	NextAt *metav1.Time `json:"nextAt,omitempty"`
+}
+
+// SourceStatus reports the content source being served.
+type SourceStatus struct {
+	// URL is the repository the commit was resolved from.
+	URL string `json:"url,omitempty"`
+
+	// Ref is the ref the commit was resolved from.
+	Ref string `json:"ref,omitempty"`
+
+	// Commit is the commit the git ref resolved to at the last sync.
+	Commit string `json:"commit,omitempty"`
+
+	// LastSyncTime is when the ref was last resolved successfully.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// BuildPhase is the state of a build Job.
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+type BuildPhase string
+
+const (
+	BuildPhaseRunning   BuildPhase = "Running"
+	BuildPhaseSucceeded BuildPhase = "Succeeded"
+	BuildPhaseFailed    BuildPhase = "Failed"
+)
+
+// BuildStatus reports the latest build and the build being served.
+type BuildStatus struct {
+	// ID identifies the latest build: the source commit, builder image and command.
+	ID string `json:"id,omitempty"`
+
+	// Commit is the source commit of the latest build.
+	Commit string `json:"commit,omitempty"`
+
+	// Phase is the state of the latest build.
+	Phase BuildPhase `json:"phase,omitempty"`
+
+	// JobName is the Job running the latest build.
+	JobName string `json:"jobName,omitempty"`
+
+	// Logs tells where to read the logs of the latest build.
+	Logs string `json:"logs,omitempty"`
+
+	// StartTime is when the latest build started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the latest build finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Duration is how long the latest build took.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// LastSuccessfulID identifies the build being served.
+	LastSuccessfulID string `json:"lastSuccessfulID,omitempty"`
+
+	// LastSuccessfulCommit is the source commit of the build being served.
+	LastSuccessfulCommit string `json:"lastSuccessfulCommit,omitempty"`
+}
+
 // WebAppStatus defines the observed state of WebApp.
 type WebAppStatus struct {
 	// AvailableReplicas is the number of Pods in the Ready state.
@@ -87,10 +946,43 @@ type WebAppStatus struct {
 	// URL is the in-cluster reachable address of the web application.
 	URL string `json:"url,omitempty"`
 
+	// CurrentRevision is the number of the newest revision that has rolled out.
+	CurrentRevision int64 `json:"currentRevision,omitempty"`
+
+	// LastRestartedAt is the restart time last propagated to the Pods.
+	// +optional
+	LastRestartedAt *metav1.Time `json:"lastRestartedAt,omitempty"`
+
 	// Conditions holds standard API conditions.
 	// +listType=map
 	// +listMapKey=type
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// PendingChanges lists what resuming the WebApp would change, while it is paused.
+	// +optional
+	PendingChanges []PendingChange `json:"pendingChanges,omitempty"`
+
+	// Source reports the commit served from spec.source.git.
+	// +optional
+	Source *SourceStatus `json:"source,omitempty"`
+
+	// Build reports the site builds of spec.build.
+	// +optional
+	Build *BuildStatus `json:"build,omitempty"`
+
+	// Schedule reports the entries of spec.schedule being served and due next.
+	// +optional
+	Schedule *ScheduleStatus `json:"schedule,omitempty"`
+
+	// Rollout reports the progress of BlueGreen and Canary rollouts.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Finalizers reports the cleanup hooks run while the WebApp is being deleted.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Finalizers []FinalizerHookStatus `json:"finalizers,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -100,6 +992,8 @@ type WebAppStatus struct {
 //+kubebuilder:printcolumn:name="Available",type=integer,JSONPath=".status.availableReplicas"
 //+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=".status.phase"
 //+kubebuilder:printcolumn:name="Image",type=string,JSONPath=".spec.image"
+//+kubebuilder:printcolumn:name="Revision",type=integer,JSONPath=".status.currentRevision"
+//+kubebuilder:printcolumn:name="Maintenance",type=string,JSONPath=".status.conditions[?(@.type=='Maintenance')].status"
 //+kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
 
 // WebApp is the Schema for the webapps API.
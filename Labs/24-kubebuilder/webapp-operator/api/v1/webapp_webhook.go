@@ -2,25 +2,67 @@
 package v1
 
 import (
+	"context"
 	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"golang.org/x/text/language"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"codewizard.io/webapp-operator/pkg/markdown"
+	"codewizard.io/webapp-operator/pkg/schedule"
 )
 
 var webapplog = logf.Log.WithName("webapp-webhook")
 
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// slugPattern matches page slugs: a single lowercase path segment, so a page
+// can neither escape the site root nor clash with a ConfigMap key.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// reservedSlugs are taken by the files generated next to the pages.
+var reservedSlugs = []string{"index", "sitemap"}
+
+// childReader looks up resources whose names collide with a WebApp's children.
+// It is nil until SetupWebhookWithManager runs, which skips the lookup.
+var childReader client.Reader
+
+// WebhookHandler defaults and validates the WebApps of admission requests.
+type WebhookHandler interface {
+	admission.CustomDefaulter
+	admission.CustomValidator
+}
+
 // SetupWebhookWithManager registers the webhook handlers with the controller-runtime manager.
-func (r *WebApp) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
-		Complete()
+// A non-nil handler admits the requests in place of the WebApp's own methods,
+// which it is expected to call; the operator uses it to trace and count
+// admissions without this package depending on its metrics or tracing.
+func (r *WebApp) SetupWebhookWithManager(mgr ctrl.Manager, handler WebhookHandler) error {
+	childReader = mgr.GetAPIReader()
+	builder := ctrl.NewWebhookManagedBy(mgr).For(r)
+	if handler != nil {
+		builder = builder.WithDefaulter(handler).WithValidator(handler)
+	}
+	return builder.Complete()
 }
 
 // ────────────────────────────────────────────────────────────────────────────
@@ -51,6 +93,116 @@ func (r *WebApp) Default() {
 	if r.Spec.MaxUnavailable == 0 {
 		r.Spec.MaxUnavailable = 1
 	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
+	if r.Spec.DriftPolicy == "" {
+		r.Spec.DriftPolicy = DriftPolicyEnforce
+	}
+	if r.Spec.AdoptionPolicy == "" {
+		r.Spec.AdoptionPolicy = AdoptionPolicyRefuse
+	}
+	if r.Spec.Rollout != nil {
+		if r.Spec.Rollout.Strategy == "" {
+			r.Spec.Rollout.Strategy = RolloutStrategyRollingUpdate
+		}
+		if r.Spec.Rollout.Strategy == RolloutStrategyBlueGreen && r.Spec.Rollout.BlueGreen == nil {
+			r.Spec.Rollout.BlueGreen = &BlueGreenStrategy{ScaleDownDelaySeconds: 30}
+		}
+		for i := range r.Spec.Rollout.Windows {
+			if r.Spec.Rollout.Windows[i].TimeZone == "" {
+				r.Spec.Rollout.Windows[i].TimeZone = "UTC"
+			}
+		}
+	}
+	if r.Spec.Source != nil && r.Spec.Source.Git != nil {
+		git := r.Spec.Source.Git
+		if git.Ref == "" {
+			git.Ref = "main"
+		}
+		if git.Interval == "" {
+			git.Interval = "1m"
+		}
+		if git.Image == "" {
+			git.Image = "registry.k8s.io/git-sync/git-sync:v4.2.1"
+		}
+	}
+	if r.Spec.Source != nil && r.Spec.Source.Archive != nil && r.Spec.Source.Archive.Image == "" {
+		if strings.HasPrefix(r.Spec.Source.Archive.URL, "oci://") {
+			r.Spec.Source.Archive.Image = "ghcr.io/oras-project/oras:v1.1.0"
+		} else {
+			r.Spec.Source.Archive.Image = "curlimages/curl:8.5.0"
+		}
+	}
+	if r.Spec.Source != nil && r.Spec.Source.Volume != nil {
+		volume := r.Spec.Source.Volume
+		if volume.ReadWriteOncePolicy == "" {
+			volume.ReadWriteOncePolicy = ReadWriteOncePolicyReject
+		}
+		if volume.ClaimTemplate != nil && volume.ClaimTemplate.Size.IsZero() {
+			volume.ClaimTemplate.Size = resource.MustParse("1Gi")
+		}
+		if volume.ClaimTemplate != nil && volume.ClaimTemplate.AccessMode == "" {
+			volume.ClaimTemplate.AccessMode = corev1.ReadWriteOnce
+		}
+	}
+	if r.Spec.Source != nil && r.Spec.Source.Upload != nil && r.Spec.Source.Upload.Image == "" {
+		r.Spec.Source.Upload.Image = "busybox:1.36"
+	}
+	if r.Spec.Content != nil && r.Spec.Content.Theme == "" {
+		r.Spec.Content.Theme = ThemeLight
+	}
+	if r.Spec.Content != nil && len(r.Spec.Content.Locales) > 0 && r.Spec.Content.DefaultLocale == "" {
+		r.Spec.Content.DefaultLocale = "en"
+	}
+	for i := range r.Spec.Schedule {
+		if r.Spec.Schedule[i].TimeZone == "" {
+			r.Spec.Schedule[i].TimeZone = "UTC"
+		}
+	}
+	if r.Spec.Build != nil {
+		if r.Spec.Build.Storage == nil {
+			r.Spec.Build.Storage = &BuildStorage{}
+		}
+		if r.Spec.Build.Storage.Size.IsZero() {
+			r.Spec.Build.Storage.Size = resource.MustParse("1Gi")
+		}
+		if r.Spec.Build.Storage.AccessMode == "" {
+			r.Spec.Build.Storage.AccessMode = corev1.ReadWriteOnce
+		}
+		if r.Spec.Build.Storage.ReadWriteOncePolicy == "" {
+			r.Spec.Build.Storage.ReadWriteOncePolicy = ReadWriteOncePolicyReject
+		}
+	}
+	if r.Spec.Tests != nil {
+		if r.Spec.Tests.Image == "" {
+			r.Spec.Tests.Image = "curlimages/curl:8.5.0"
+		}
+		for i := range r.Spec.Tests.Checks {
+			if r.Spec.Tests.Checks[i].Path == "" {
+				r.Spec.Tests.Checks[i].Path = "/"
+			}
+			if r.Spec.Tests.Checks[i].ExpectedStatus == 0 {
+				r.Spec.Tests.Checks[i].ExpectedStatus = 200
+			}
+		}
+	}
+	if r.Spec.Maintenance != nil {
+		if r.Spec.Maintenance.Message == "" {
+			r.Spec.Maintenance.Message = "This site is down for maintenance. Please check back soon."
+		}
+		if r.Spec.Maintenance.RetryAfterSeconds == 0 {
+			r.Spec.Maintenance.RetryAfterSeconds = 300
+		}
+	}
+	if r.Spec.Monitoring != nil {
+		if r.Spec.Monitoring.ExporterImage == "" {
+			r.Spec.Monitoring.ExporterImage = "nginx/nginx-prometheus-exporter:1.1.0"
+		}
+		if r.Spec.Monitoring.Interval == "" {
+			r.Spec.Monitoring.Interval = "30s"
+		}
+	}
 }
 
 // ────────────────────────────────────────────────────────────────────────────
@@ -96,14 +248,57 @@ func (r *WebApp) validateWebApp(oldWebApp *WebApp) (admission.Warnings, error) {
 		))
 	}
 
-	// ── Message is required ────────────────────────────────────────────────────
-	if r.Spec.Message == "" {
+	// ── Message is required unless the content comes from elsewhere ───────────
+	hasSource := r.Spec.Source != nil &&
+		(r.Spec.Source.Git != nil || r.Spec.Source.Archive != nil || r.Spec.Source.Volume != nil || r.Spec.Source.Upload != nil)
+	hasMarkdown := r.Spec.Content != nil && r.Spec.Content.Markdown != nil
+	if r.Spec.Message == "" && !hasSource && !hasMarkdown {
 		errs = append(errs, field.Required(
 			field.NewPath("spec", "message"),
-			"message is required and cannot be empty",
+			"message is required and cannot be empty unless content or a source is set",
 		))
 	}
 
+	// ── Markdown must be given once and be safe to serve ──────────────────────
+	errs = append(errs, r.validateMarkdown()...)
+	errs = append(errs, r.validateLocales()...)
+	if r.Spec.Content != nil && (hasMarkdown || len(r.Spec.Content.Locales) > 0) && hasSource {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "content"), "content and source are mutually exclusive"))
+	}
+
+	// ── Pages need unique, safe slugs and serve the message or content ───────
+	errs = append(errs, r.validatePages()...)
+	if len(r.Spec.Pages) > 0 && hasSource {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "pages"), "pages and source are mutually exclusive"))
+	}
+	// ── Scheduled content must go live in order ────────────────────────────────
+	errs = append(errs, r.validateSchedule()...)
+	if len(r.Spec.Schedule) > 0 && hasSource {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "schedule"), "schedule and source are mutually exclusive"))
+	}
+	if u, err := url.Parse(r.Spec.BaseURL); r.Spec.BaseURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "baseURL"), r.Spec.BaseURL, "must be an absolute http(s) URL"))
+	}
+
+	// ── Sources must be fetchable, one at a time ───────────────────────────────
+	errs = append(errs, r.validateGitSource()...)
+	errs = append(errs, r.validateArchiveSource()...)
+	errs = append(errs, r.validateVolumeSource()...)
+	errs = append(errs, r.validateUploadSource()...)
+
+	// ── Builds render the git source ───────────────────────────────────────────
+	if r.Spec.Build != nil && (r.Spec.Source == nil || r.Spec.Source.Git == nil) {
+		errs = append(errs, field.Required(field.NewPath("spec", "source", "git"), "the build renders the git source"))
+	}
+	if r.Spec.Build != nil && r.Spec.Build.Storage != nil {
+		storage := r.Spec.Build.Storage
+		if storage.AccessMode == corev1.ReadWriteOnce && r.Spec.Replicas > 1 && storage.ReadWriteOncePolicy != ReadWriteOncePolicySameNode {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "build", "storage", "accessMode"), storage.AccessMode,
+				fmt.Sprintf("only one node can mount the claim, but %d replicas are requested; "+
+					"use ReadWriteMany or set readWriteOncePolicy to SameNode", r.Spec.Replicas)))
+		}
+	}
+
 	// ── Image must not be empty ────────────────────────────────────────────────
 	if r.Spec.Image == "" {
 		errs = append(errs, field.Required(
@@ -129,6 +324,75 @@ func (r *WebApp) validateWebApp(oldWebApp *WebApp) (admission.Warnings, error) {
 		))
 	}
 
+	// ── The restart annotation must hold a timestamp ───────────────────────────
+	if value, ok := r.Annotations[AnnotationRestartedAt]; ok {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			errs = append(errs, field.Invalid(
+				field.NewPath("metadata", "annotations").Key(AnnotationRestartedAt),
+				value,
+				"must be an RFC 3339 timestamp, e.g. 2024-01-02T15:04:05Z",
+			))
+		}
+	}
+
+	// ── Canary needs steps, each with a parseable pause ─────────────────────────
+	errs = append(errs, r.validateCanary()...)
+
+	// ── Rollout windows must parse ─────────────────────────────────────────────
+	if r.Spec.Rollout != nil {
+		for i, w := range r.Spec.Rollout.Windows {
+			windowPath := field.NewPath("spec", "rollout", "windows").Index(i)
+			if _, err := schedule.Parse(w.Schedule); err != nil {
+				errs = append(errs, field.Invalid(windowPath.Child("schedule"), w.Schedule, err.Error()))
+			}
+			if d, err := time.ParseDuration(w.Duration); err != nil || d <= 0 {
+				errs = append(errs, field.Invalid(windowPath.Child("duration"), w.Duration, "must be a positive duration, e.g. 2h"))
+			}
+			if _, err := time.LoadLocation(w.TimeZone); err != nil {
+				errs = append(errs, field.Invalid(windowPath.Child("timeZone"), w.TimeZone, err.Error()))
+			}
+		}
+	}
+
+	// ── Smoke-test body patterns must compile ──────────────────────────────────
+	if r.Spec.Tests != nil {
+		for i, check := range r.Spec.Tests.Checks {
+			if check.BodyRegex == "" {
+				continue
+			}
+			// The test Job matches with grep -E, i.e. POSIX extended syntax
+			if _, err := regexp.CompilePOSIX(check.BodyRegex); err != nil {
+				errs = append(errs, field.Invalid(
+					field.NewPath("spec", "tests", "checks").Index(i).Child("bodyRegex"),
+					check.BodyRegex,
+					err.Error(),
+				))
+			}
+		}
+	}
+
+	// ── Maintenance allow-lists must be CIDRs ──────────────────────────────────
+	if r.Spec.Maintenance != nil {
+		for i, cidr := range r.Spec.Maintenance.AllowedCIDRs {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				errs = append(errs, field.Invalid(
+					field.NewPath("spec", "maintenance", "allowedCIDRs").Index(i),
+					cidr,
+					"must be a CIDR, e.g. 10.0.0.0/8",
+				))
+			}
+		}
+	}
+
+	// ── The exporter sidecar owns its port inside the Pod ──────────────────────
+	if r.Spec.Monitoring != nil && r.Spec.Monitoring.Enabled && r.Spec.Port == 9113 {
+		errs = append(errs, field.Invalid(
+			field.NewPath("spec", "port"),
+			r.Spec.Port,
+			"port 9113 is reserved for the metrics exporter when monitoring is enabled",
+		))
+	}
+
 	if len(errs) > 0 {
 		return nil, apierrors.NewInvalid(
 			schema.GroupKind{Group: "apps.codewizard.io", Kind: "WebApp"},
@@ -137,5 +401,338 @@ func (r *WebApp) validateWebApp(oldWebApp *WebApp) (admission.Warnings, error) {
 		)
 	}
 
-	return nil, nil
+	// ── Warn about existing resources with the children's names ────────────────
+	return r.nameConflictWarnings(), nil
+}
+
+// nameConflictWarnings warns about existing resources named like the WebApp's
+// children that it does not control. The names mirror the ones the controller
+// writes for the rollout strategy. Lookup errors only skip the warning.
+func (r *WebApp) nameConflictWarnings() admission.Warnings {
+	if childReader == nil {
+		return nil
+	}
+	services := []string{r.Name}
+	deployments := []string{r.Name}
+	if r.Spec.Rollout != nil {
+		switch r.Spec.Rollout.Strategy {
+		case RolloutStrategyBlueGreen:
+			services = append(services, r.Name+"-preview")
+			deployments = []string{r.Name + "-blue", r.Name + "-green"}
+		case RolloutStrategyCanary:
+			deployments = append(deployments, r.Name+"-canary")
+		}
+	}
+	type named struct {
+		kind string
+		obj  client.Object
+	}
+	var children []named
+	for _, name := range services {
+		children = append(children, named{"Service", &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name}}})
+	}
+	for _, name := range deployments {
+		children = append(children,
+			named{"Deployment", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name}}},
+			named{"ConfigMap", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name + "-html"}}},
+			named{"ConfigMap", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name + "-nginx"}}},
+		)
+	}
+
+	var warnings admission.Warnings
+	for _, child := range children {
+		key := types.NamespacedName{Name: child.obj.GetName(), Namespace: r.Namespace}
+		if err := childReader.Get(context.Background(), key, child.obj); err != nil {
+			continue
+		}
+		owner := metav1.GetControllerOf(child.obj)
+		switch {
+		case owner != nil && r.UID != "" && owner.UID == r.UID:
+			continue
+		case owner != nil:
+			warnings = append(warnings, fmt.Sprintf("%s %s is controlled by %s %s; the WebApp will not touch it",
+				child.kind, key.Name, owner.Kind, owner.Name))
+		case r.Spec.AdoptionPolicy == AdoptionPolicyAdopt:
+			warnings = append(warnings, fmt.Sprintf("%s %s already exists and will be adopted", child.kind, key.Name))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s %s already exists and is not owned by the WebApp; "+
+				"set spec.adoptionPolicy to Adopt to take it over", child.kind, key.Name))
+		}
+	}
+	return warnings
+}
+
+// validateGitSource checks the git source URL and poll interval.
+func (r *WebApp) validateGitSource() field.ErrorList {
+	if r.Spec.Source == nil || r.Spec.Source.Git == nil {
+		return nil
+	}
+	git := r.Spec.Source.Git
+	gitPath := field.NewPath("spec", "source", "git")
+
+	var errs field.ErrorList
+	if u, err := url.Parse(git.URL); err != nil {
+		errs = append(errs, field.Invalid(gitPath.Child("url"), git.URL, err.Error()))
+	} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "git" {
+		// file:// would read the operator's own filesystem
+		errs = append(errs, field.NotSupported(gitPath.Child("url"), u.Scheme, []string{"http", "https", "git"}))
+	} else if u.User != nil {
+		errs = append(errs, field.Invalid(gitPath.Child("url"), git.URL, "must not hold credentials; use secretRef instead"))
+	}
+	if d, err := time.ParseDuration(git.Interval); err != nil || d <= 0 {
+		errs = append(errs, field.Invalid(gitPath.Child("interval"), git.Interval, "must be a positive duration, e.g. 5m"))
+	}
+	if strings.HasPrefix(git.Subdirectory, "/") || slices.Contains(strings.Split(git.Subdirectory, "/"), "..") {
+		errs = append(errs, field.Invalid(gitPath.Child("subdirectory"), git.Subdirectory,
+			"must be a relative path inside the repository"))
+	}
+	return errs
+}
+
+// validateArchiveSource checks that the archive source is the only source and
+// that its URL can be fetched.
+func (r *WebApp) validateArchiveSource() field.ErrorList {
+	if r.Spec.Source == nil || r.Spec.Source.Archive == nil {
+		return nil
+	}
+	archive := r.Spec.Source.Archive
+	archivePath := field.NewPath("spec", "source", "archive")
+
+	var errs field.ErrorList
+	if r.Spec.Source.Git != nil {
+		errs = append(errs, field.Forbidden(archivePath, "only one of source.git and source.archive may be set"))
+	}
+	if u, err := url.Parse(archive.URL); err != nil {
+		errs = append(errs, field.Invalid(archivePath.Child("url"), archive.URL, err.Error()))
+	} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci" {
+		errs = append(errs, field.NotSupported(archivePath.Child("url"), u.Scheme, []string{"http", "https", "oci"}))
+	} else if u.User != nil {
+		errs = append(errs, field.Invalid(archivePath.Child("url"), archive.URL, "must not hold credentials; use pullSecretRef instead"))
+	} else if u.Scheme == "oci" && strings.Contains(u.Path, "@") {
+		errs = append(errs, field.Invalid(archivePath.Child("url"), archive.URL, "must not hold a digest; set sha256 instead"))
+	}
+	if !sha256Pattern.MatchString(archive.SHA256) {
+		errs = append(errs, field.Invalid(archivePath.Child("sha256"), archive.SHA256, "must be 64 lowercase hex digits"))
+	}
+	return errs
+}
+
+// validateMarkdown checks that the Markdown is set either inline or by
+// reference, and that inline Markdown has valid front matter and no script
+// tags unless raw HTML is allowed.
+func (r *WebApp) validateMarkdown() field.ErrorList {
+	if r.Spec.Content == nil || r.Spec.Content.Markdown == nil {
+		return nil
+	}
+	md := r.Spec.Content.Markdown
+	mdPath := field.NewPath("spec", "content", "markdown")
+
+	var errs field.ErrorList
+	switch {
+	case md.Inline == "" && md.ConfigMapRef == nil:
+		errs = append(errs, field.Required(mdPath, "one of inline and configMapRef is required"))
+	case md.Inline != "" && md.ConfigMapRef != nil:
+		errs = append(errs, field.Forbidden(mdPath, "only one of inline and configMapRef may be set"))
+	case md.ConfigMapRef != nil && md.ConfigMapRef.Name == "":
+		errs = append(errs, field.Required(mdPath.Child("configMapRef", "name"), "the ConfigMap name is required"))
+	}
+	if md.Inline != "" {
+		if _, _, err := markdown.SplitFrontMatter(md.Inline); err != nil {
+			errs = append(errs, field.Invalid(mdPath.Child("inline"), "", err.Error()))
+		}
+		if !md.AllowRawHTML && markdown.HasScript(md.Inline) {
+			errs = append(errs, field.Forbidden(mdPath.Child("inline"),
+				"script tags are not allowed; set allowRawHTML to serve them"))
+		}
+	}
+	return errs
+}
+
+// validateSchedule checks that every entry sets either a message or a content
+// reference, and goes live at a valid time after the entry before it.
+func (r *WebApp) validateSchedule() field.ErrorList {
+	var errs field.ErrorList
+	var previous time.Time
+	for i, entry := range r.Spec.Schedule {
+		entryPath := field.NewPath("spec", "schedule").Index(i)
+		switch {
+		case entry.Message == "" && entry.ContentRef == nil:
+			errs = append(errs, field.Required(entryPath, "one of message and contentRef is required"))
+		case entry.Message != "" && entry.ContentRef != nil:
+			errs = append(errs, field.Forbidden(entryPath, "only one of message and contentRef may be set"))
+		case entry.ContentRef != nil && entry.ContentRef.Name == "":
+			errs = append(errs, field.Required(entryPath.Child("contentRef", "name"), "the ConfigMap name is required"))
+		}
+
+		if _, err := time.LoadLocation(entry.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(entryPath.Child("timeZone"), entry.TimeZone, err.Error()))
+			continue
+		}
+		at, err := schedule.At(entry.At, entry.TimeZone)
+		if err != nil {
+			errs = append(errs, field.Invalid(entryPath.Child("at"), entry.At, err.Error()))
+			continue
+		}
+		if !previous.IsZero() && !at.After(previous) {
+			errs = append(errs, field.Invalid(entryPath.Child("at"), entry.At,
+				fmt.Sprintf("must be after the previous entry, at %s", previous.UTC().Format(time.RFC3339))))
+		}
+		previous = at
+	}
+	return errs
+}
+
+// validatePages checks that page slugs are unique path segments not taken by
+// a generated file, and that page bodies hold no script tags.
+func (r *WebApp) validatePages() field.ErrorList {
+	return validatePageList(r.Spec.Pages, field.NewPath("spec", "pages"))
+}
+
+// validatePageList checks the pages listed at path.
+func validatePageList(pages []Page, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, page := range pages {
+		pagePath := path.Index(i)
+		switch {
+		case !slugPattern.MatchString(page.Slug) || len(page.Slug) > 63:
+			errs = append(errs, field.Invalid(pagePath.Child("slug"), page.Slug,
+				"must be lowercase letters, digits and dashes, starting and ending with a letter or digit"))
+		case slices.Contains(reservedSlugs, page.Slug):
+			errs = append(errs, field.Invalid(pagePath.Child("slug"), page.Slug, "is reserved for a generated file"))
+		case seen[page.Slug]:
+			errs = append(errs, field.Duplicate(pagePath.Child("slug"), page.Slug))
+		}
+		seen[page.Slug] = true
+		if strings.TrimSpace(page.Title) == "" {
+			errs = append(errs, field.Required(pagePath.Child("title"), "the title is shown in the navigation menu"))
+		}
+		if markdown.HasScript(page.Body) {
+			errs = append(errs, field.Forbidden(pagePath.Child("body"), "script tags are not allowed in pages"))
+		}
+	}
+	return errs
+}
+
+// validateLocales checks that the locales are distinct BCP 47 tags in
+// canonical form, and that they translate only pages of spec.pages.
+func (r *WebApp) validateLocales() field.ErrorList {
+	if r.Spec.Content == nil || len(r.Spec.Content.Locales) == 0 {
+		return nil
+	}
+	contentPath := field.NewPath("spec", "content")
+
+	errs := validateLanguageTag(r.Spec.Content.DefaultLocale, contentPath.Child("defaultLocale"))
+	slugs := map[string]bool{}
+	for _, page := range r.Spec.Pages {
+		slugs[page.Slug] = true
+	}
+	seen := map[string]bool{strings.ToLower(r.Spec.Content.DefaultLocale): true}
+	for i, locale := range r.Spec.Content.Locales {
+		localePath := contentPath.Child("locales").Index(i)
+		errs = append(errs, validateLanguageTag(locale.Tag, localePath.Child("tag"))...)
+		if seen[strings.ToLower(locale.Tag)] {
+			errs = append(errs, field.Duplicate(localePath.Child("tag"), locale.Tag))
+		}
+		seen[strings.ToLower(locale.Tag)] = true
+
+		errs = append(errs, validatePageList(locale.Pages, localePath.Child("pages"))...)
+		for j, page := range locale.Pages {
+			if !slugs[page.Slug] {
+				errs = append(errs, field.NotFound(localePath.Child("pages").Index(j).Child("slug"), page.Slug))
+			}
+		}
+	}
+	return errs
+}
+
+// validateLanguageTag checks that tag is a well-formed BCP 47 language tag,
+// written in canonical form as it appears in Accept-Language headers.
+func validateLanguageTag(tag string, path *field.Path) field.ErrorList {
+	parsed, err := language.Parse(tag)
+	switch {
+	case err != nil || parsed == language.Und:
+		return field.ErrorList{field.Invalid(path, tag, "must be a BCP 47 language tag, e.g. de or pt-BR")}
+	case parsed.String() != tag:
+		return field.ErrorList{field.Invalid(path, tag, fmt.Sprintf("must be written as %s", parsed))}
+	}
+	return nil
+}
+
+// validateVolumeSource checks that the volume source is the only source, names
+// exactly one claim and, for a claim it creates, that the claim can back the replicas.
+func (r *WebApp) validateVolumeSource() field.ErrorList {
+	if r.Spec.Source == nil || r.Spec.Source.Volume == nil {
+		return nil
+	}
+	volume := r.Spec.Source.Volume
+	volumePath := field.NewPath("spec", "source", "volume")
+
+	var errs field.ErrorList
+	if r.Spec.Source.Git != nil || r.Spec.Source.Archive != nil {
+		errs = append(errs, field.Forbidden(volumePath, "only one of source.git, source.archive and source.volume may be set"))
+	}
+	switch {
+	case volume.ClaimName == "" && volume.ClaimTemplate == nil:
+		errs = append(errs, field.Required(volumePath, "one of claimName and claimTemplate is required"))
+	case volume.ClaimName != "" && volume.ClaimTemplate != nil:
+		errs = append(errs, field.Forbidden(volumePath, "only one of claimName and claimTemplate may be set"))
+	}
+	if strings.HasPrefix(volume.SubPath, "/") || slices.Contains(strings.Split(volume.SubPath, "/"), "..") {
+		errs = append(errs, field.Invalid(volumePath.Child("subPath"), volume.SubPath, "must be a relative path inside the volume"))
+	}
+	if template := volume.ClaimTemplate; template != nil && template.AccessMode == corev1.ReadWriteOnce &&
+		r.Spec.Replicas > 1 && volume.ReadWriteOncePolicy != ReadWriteOncePolicySameNode {
+		errs = append(errs, field.Invalid(volumePath.Child("claimTemplate", "accessMode"), template.AccessMode,
+			fmt.Sprintf("only one node can mount the claim, but %d replicas are requested; "+
+				"use ReadWriteMany or set readWriteOncePolicy to SameNode", r.Spec.Replicas)))
+	}
+	return errs
+}
+
+// validateUploadSource checks that the upload source is the only source and
+// that an upload is described completely.
+func (r *WebApp) validateUploadSource() field.ErrorList {
+	if r.Spec.Source == nil || r.Spec.Source.Upload == nil {
+		return nil
+	}
+	upload := r.Spec.Source.Upload
+	uploadPath := field.NewPath("spec", "source", "upload")
+
+	var errs field.ErrorList
+	if r.Spec.Source.Git != nil || r.Spec.Source.Archive != nil || r.Spec.Source.Volume != nil {
+		errs = append(errs, field.Forbidden(uploadPath, "the upload source cannot be combined with another source"))
+	}
+	if upload.Revision > 0 {
+		if !sha256Pattern.MatchString(upload.SHA256) {
+			errs = append(errs, field.Invalid(uploadPath.Child("sha256"), upload.SHA256, "must be 64 lowercase hex digits"))
+		}
+		if upload.Chunks < 1 {
+			errs = append(errs, field.Invalid(uploadPath.Child("chunks"), upload.Chunks, "an upload has at least one chunk"))
+		}
+	}
+	return errs
+}
+
+// validateCanary checks the Canary steps when the Canary strategy is selected.
+func (r *WebApp) validateCanary() field.ErrorList {
+	if r.Spec.Rollout == nil || r.Spec.Rollout.Strategy != RolloutStrategyCanary {
+		return nil
+	}
+
+	canaryPath := field.NewPath("spec", "rollout", "canary")
+	if r.Spec.Rollout.Canary == nil || len(r.Spec.Rollout.Canary.Steps) == 0 {
+		return field.ErrorList{field.Required(canaryPath.Child("steps"), "at least one step is required for the Canary strategy")}
+	}
+
+	var errs field.ErrorList
+	for i, step := range r.Spec.Rollout.Canary.Steps {
+		if step.Pause == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(step.Pause); err != nil {
+			errs = append(errs, field.Invalid(canaryPath.Child("steps").Index(i).Child("pause"), step.Pause, err.Error()))
+		}
+	}
+	return errs
 }
@@ -0,0 +1,194 @@
+// Command manager runs the WebApp operator: the reconciler, the admission
+// webhooks, the metrics and health endpoints, and optionally the content
+// upload endpoint.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	// Embed the time zone database for spec.rollout.windows[].timeZone
+	_ "time/tzdata"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/childguard"
+	"codewizard.io/webapp-operator/internal/controller"
+	"codewizard.io/webapp-operator/internal/tracing"
+	"codewizard.io/webapp-operator/internal/upload"
+	//+kubebuilder:scaffold:imports
+)
+
+var (
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(webappv1.AddToScheme(scheme))
+	//+kubebuilder:scaffold:scheme
+}
+
+func main() {
+	var metricsAddr string
+	var probeAddr string
+	var enableLeaderElection bool
+	var tracingOpts tracing.Options
+	var guardOpts childGuardOptions
+	var uploadOpts uploadOptions
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+		"Enable leader election for controller manager. "+
+			"Enabling this will ensure there is only one active controller manager.")
+	tracingOpts.BindFlags(flag.CommandLine)
+	flag.BoolVar(&guardOpts.enabled, "protect-children", false,
+		"Serve the webhook denying manual updates and deletions of WebApp children.")
+	flag.StringVar(&guardOpts.operatorUser, "operator-user", childguard.DefaultOperatorUser(),
+		"The username of the operator's service account, allowed to edit protected children. "+
+			"Defaults to the service account named by the "+childguard.NamespaceEnv+" and "+
+			childguard.ServiceAccountEnv+" environment variables, set through the downward API.")
+	flag.StringVar(&uploadOpts.addr, "upload-bind-address", "0",
+		"The address the content upload endpoint binds to. Set this to '0' to disable it.")
+	flag.StringVar(&uploadOpts.certDir, "upload-cert-dir", filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		"The directory with the tls.crt and tls.key the upload endpoint serves. Defaults to the webhook server's.")
+	flag.StringVar(&uploadOpts.tokenSecret, "upload-token-secret", "",
+		"The name of a Secret whose 'token' key authenticates uploads to the WebApps in the Secret's namespace. "+
+			"If empty, bearer tokens are checked with a TokenReview and a SubjectAccessReview.")
+	flag.StringVar(&uploadOpts.audience, "upload-token-audience", upload.DefaultAudience,
+		"The audience the reviewed bearer tokens of uploads must be issued for.")
+	flag.Int64Var(&uploadOpts.maxBytes, "upload-max-bytes", upload.DefaultMaxBytes,
+		"The largest compressed tarball the upload endpoint accepts.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	if err := run(metricsAddr, probeAddr, enableLeaderElection, tracingOpts, guardOpts, uploadOpts); err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
+	}
+}
+
+// run starts the manager and blocks until it stops. It is split out of main so
+// deferred shutdown hooks (e.g. flushing traces) run before the process exits.
+func run(metricsAddr, probeAddr string, enableLeaderElection bool, tracingOpts tracing.Options,
+	guardOpts childGuardOptions, uploadOpts uploadOptions) error {
+	ctx := ctrl.SetupSignalHandler()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+	if err != nil {
+		return fmt.Errorf("unable to set up tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+
+	// The API server records the user agent as the field manager of our writes,
+	// which is how driftPolicy Report tells out-of-band edits apart
+	cfg := ctrl.GetConfigOrDie()
+	cfg.UserAgent = controller.FieldManager
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: 9443}),
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "webapp-operator.codewizard.io",
+	})
+	if err != nil {
+		return fmt.Errorf("unable to start manager: %w", err)
+	}
+
+	if err = (&controller.WebAppReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor("webapp-controller"),
+		// Cleanup hooks for external resources (e.g. DNS records) go after the built-in one
+		Finalizers: []controller.Finalizer{controller.ForgetMetrics},
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create WebApp controller: %w", err)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&webappv1.WebApp{}).SetupWebhookWithManager(mgr, instrumentedWebhook{}); err != nil {
+			return fmt.Errorf("unable to create WebApp webhook: %w", err)
+		}
+	}
+	if guardOpts.enabled {
+		// Without it the guard would deny the operator its own children
+		if guardOpts.operatorUser == "" {
+			return fmt.Errorf("--protect-children needs --operator-user, or the %s and %s environment variables",
+				childguard.NamespaceEnv, childguard.ServiceAccountEnv)
+		}
+		mgr.GetWebhookServer().Register(childguard.Path, &webhook.Admission{
+			Handler: &childguard.Handler{OperatorUser: guardOpts.operatorUser},
+		})
+	}
+	if uploadOpts.addr != "0" {
+		// Each namespace holds its own token Secret
+		if strings.Contains(uploadOpts.tokenSecret, "/") {
+			return fmt.Errorf("--upload-token-secret must be a Secret name, got %q", uploadOpts.tokenSecret)
+		}
+		server := &upload.Server{
+			Client:      mgr.GetClient(),
+			Reader:      mgr.GetAPIReader(),
+			Scheme:      mgr.GetScheme(),
+			Addr:        uploadOpts.addr,
+			CertDir:     uploadOpts.certDir,
+			TokenSecret: uploadOpts.tokenSecret,
+			Audience:    uploadOpts.audience,
+			MaxBytes:    uploadOpts.maxBytes,
+		}
+		if err := mgr.Add(server); err != nil {
+			return fmt.Errorf("unable to set up upload endpoint: %w", err)
+		}
+	}
+	//+kubebuilder:scaffold:builder
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up health check: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return fmt.Errorf("unable to set up ready check: %w", err)
+	}
+
+	setupLog.Info("starting manager")
+	return mgr.Start(ctx)
+}
+
+// childGuardOptions configures the child protection webhook.
+type childGuardOptions struct {
+	enabled      bool
+	operatorUser string
+}
+
+// uploadOptions configures the content upload endpoint.
+type uploadOptions struct {
+	addr        string
+	certDir     string
+	tokenSecret string
+	audience    string
+	maxBytes    int64
+}
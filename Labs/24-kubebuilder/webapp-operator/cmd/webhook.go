@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+// instrumentedWebhook admits WebApps with their own Default and Validate
+// methods, tracing each admission and counting rejections by field.
+type instrumentedWebhook struct{}
+
+var _ webappv1.WebhookHandler = instrumentedWebhook{}
+
+// Default applies the WebApp's defaults.
+func (instrumentedWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	webapp, err := asWebApp(obj)
+	if err != nil {
+		return err
+	}
+	_, span := tracing.Start(ctx, "Default", webapp)
+	defer tracing.End(span, nil)
+
+	webapp.Default()
+	return nil
+}
+
+// ValidateCreate validates a new WebApp.
+func (w instrumentedWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	webapp, err := asWebApp(obj)
+	if err != nil {
+		return nil, err
+	}
+	return w.validate(ctx, webapp, webapp.ValidateCreate)
+}
+
+// ValidateUpdate validates an updated WebApp against its previous version.
+func (w instrumentedWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	webapp, err := asWebApp(newObj)
+	if err != nil {
+		return nil, err
+	}
+	return w.validate(ctx, webapp, func() (admission.Warnings, error) {
+		return webapp.ValidateUpdate(oldObj)
+	})
+}
+
+// ValidateDelete validates a deleted WebApp.
+func (instrumentedWebhook) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	webapp, err := asWebApp(obj)
+	if err != nil {
+		return nil, err
+	}
+	return webapp.ValidateDelete()
+}
+
+// validate runs the WebApp's validation in a span and counts each invalid
+// field of a rejection.
+func (instrumentedWebhook) validate(ctx context.Context, webapp *webappv1.WebApp,
+	validate func() (admission.Warnings, error)) (_ admission.Warnings, err error) {
+	_, span := tracing.Start(ctx, "validateWebApp", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	warnings, err := validate()
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			metrics.WebhookRejections.WithLabelValues(cause.Field).Inc()
+		}
+	}
+	return warnings, err
+}
+
+func asWebApp(obj runtime.Object) (*webappv1.WebApp, error) {
+	webapp, ok := obj.(*webappv1.WebApp)
+	if !ok {
+		return nil, fmt.Errorf("expected *WebApp, got %T", obj)
+	}
+	return webapp, nil
+}
@@ -0,0 +1,119 @@
+// Package childguard implements the optional admission webhook that protects
+// the children of WebApps from manual edits. Updates and deletions of
+// Deployments, Services and ConfigMaps controlled by a WebApp are denied to
+// everyone but the operator and the Kubernetes controllers, with a message
+// pointing at the owning WebApp. Annotating the child with
+// apps.codewizard.io/break-glass=true lifts the protection.
+package childguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+// Path is where the webhook is served.
+const Path = "/validate-webapp-children"
+
+// The environment variables the manager Pod fills in through the downward API,
+// from metadata.namespace and spec.serviceAccountName.
+const (
+	NamespaceEnv      = "POD_NAMESPACE"
+	ServiceAccountEnv = "POD_SERVICE_ACCOUNT"
+)
+
+// DefaultOperatorUser returns the username of the service account the operator
+// Pod runs as, or "" when the downward API variables are not set.
+func DefaultOperatorUser() string {
+	namespace, serviceAccount := os.Getenv(NamespaceEnv), os.Getenv(ServiceAccountEnv)
+	if namespace == "" || serviceAccount == "" {
+		return ""
+	}
+	return serviceAccountPrefix + namespace + ":" + serviceAccount
+}
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "webapp-operator"
+
+	// serviceAccountPrefix starts the username of every service account.
+	serviceAccountPrefix = "system:serviceaccount:"
+	// systemControllers is the prefix of the built-in controllers' service
+	// accounts, e.g. the garbage collector deleting the children of a removed WebApp.
+	systemControllers = serviceAccountPrefix + "kube-system:"
+	// controllerManager is the built-in controllers' user when they do not run
+	// with their own service accounts.
+	controllerManager = "system:kube-controller-manager"
+)
+
+var guardlog = logf.Log.WithName("child-guard")
+
+// The failure policy is Ignore so an unavailable operator never blocks cluster operations.
+//+kubebuilder:webhook:path=/validate-webapp-children,mutating=false,failurePolicy=ignore,sideEffects=None,groups=apps,resources=deployments,verbs=update;delete,versions=v1,name=vdeployments.webapp.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-webapp-children,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=services;configmaps,verbs=update;delete,versions=v1,name=vchildren.webapp.kb.io,admissionReviewVersions=v1
+
+// Handler denies updates and deletions of WebApp children by anyone but the
+// operator and the Kubernetes controllers.
+type Handler struct {
+	// OperatorUser is the username of the operator's service account.
+	OperatorUser string
+
+	// AllowedUsers are additional usernames allowed to edit the children.
+	AllowedUsers []string
+}
+
+var _ admission.Handler = &Handler{}
+
+// Handle implements admission.Handler.
+func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Update && req.Operation != admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	// The stored object decides, so removing the label does not lift the protection
+	old := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("decoding object: %w", err))
+	}
+	owner := metav1.GetControllerOf(old)
+	if old.Labels[managedByLabel] != managedBy || owner == nil || owner.Kind != "WebApp" {
+		return admission.Allowed("")
+	}
+
+	user := req.UserInfo.Username
+	if user == h.OperatorUser || user == controllerManager || strings.HasPrefix(user, systemControllers) ||
+		slices.Contains(h.AllowedUsers, user) {
+		return admission.Allowed("")
+	}
+
+	// Break glass: set on the stored object, or in the update itself
+	if old.Annotations[webappv1.AnnotationBreakGlass] == "true" {
+		return admission.Allowed("break-glass annotation set")
+	}
+	if req.Operation == admissionv1.Update {
+		updated := &metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(req.Object.Raw, updated); err == nil &&
+			updated.Annotations[webappv1.AnnotationBreakGlass] == "true" {
+			return admission.Allowed("break-glass annotation set")
+		}
+	}
+
+	guardlog.Info("Denying manual edit of a WebApp child", "kind", req.Kind.Kind, "name", req.Name,
+		"namespace", req.Namespace, "user", user, "operation", req.Operation)
+	return admission.Denied(fmt.Sprintf(
+		"%s %s/%s is managed by WebApp %s/%s; change the WebApp instead, "+
+			"or annotate the %s with %s=true to edit it anyway (the operator may revert the change)",
+		req.Kind.Kind, req.Namespace, req.Name, req.Namespace, owner.Name,
+		req.Kind.Kind, webappv1.AnnotationBreakGlass))
+}
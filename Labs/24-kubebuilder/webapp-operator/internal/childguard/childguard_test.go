@@ -0,0 +1,119 @@
+package childguard
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+const operatorUser = "system:serviceaccount:webapp-system:webapp-operator"
+
+// child returns the metadata of a ConfigMap controlled by a WebApp.
+func child(annotations map[string]string) metav1.PartialObjectMetadata {
+	controller := true
+	return metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "site-html",
+			Namespace:   "default",
+			Labels:      map[string]string{managedByLabel: managedBy},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: webappv1.GroupVersion.String(),
+				Kind:       "WebApp",
+				Name:       "site",
+				UID:        "1234",
+				Controller: &controller,
+			}},
+		},
+	}
+}
+
+func raw(t *testing.T, obj metav1.PartialObjectMetadata) runtime.RawExtension {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: data}
+}
+
+func TestHandle(t *testing.T) {
+	unmanaged := child(nil)
+	unmanaged.Labels = nil
+	breakGlass := map[string]string{webappv1.AnnotationBreakGlass: "true"}
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		user      string
+		old, obj  metav1.PartialObjectMetadata
+		allowed   bool
+	}{
+		{name: "operator update", operation: admissionv1.Update, user: operatorUser, old: child(nil), obj: child(nil), allowed: true},
+		{name: "operator delete", operation: admissionv1.Delete, user: operatorUser, old: child(nil), allowed: true},
+		{name: "garbage collector", operation: admissionv1.Delete, user: "system:serviceaccount:kube-system:generic-garbage-collector", old: child(nil), allowed: true},
+		{name: "controller manager", operation: admissionv1.Delete, user: controllerManager, old: child(nil), allowed: true},
+		{name: "allowed user", operation: admissionv1.Update, user: "ops@example.com", old: child(nil), obj: child(nil), allowed: true},
+		{name: "stored break-glass", operation: admissionv1.Delete, user: "dev@example.com", old: child(breakGlass), allowed: true},
+		{name: "break-glass in the update", operation: admissionv1.Update, user: "dev@example.com", old: child(nil), obj: child(breakGlass), allowed: true},
+		{name: "unmanaged object", operation: admissionv1.Update, user: "dev@example.com", old: unmanaged, obj: unmanaged, allowed: true},
+		{name: "create", operation: admissionv1.Create, user: "dev@example.com", obj: child(nil), allowed: true},
+		{name: "manual update", operation: admissionv1.Update, user: "dev@example.com", old: child(nil), obj: child(nil)},
+		{name: "manual delete", operation: admissionv1.Delete, user: "dev@example.com", old: child(nil)},
+		{name: "other namespace's service account", operation: admissionv1.Delete, user: "system:serviceaccount:default:deployer", old: child(nil)},
+		{name: "break-glass set to false", operation: admissionv1.Update, user: "dev@example.com", old: child(nil),
+			obj: child(map[string]string{webappv1.AnnotationBreakGlass: "false"})},
+	}
+
+	h := &Handler{OperatorUser: operatorUser, AllowedUsers: []string{"ops@example.com"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: tt.operation,
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+				Name:      "site-html",
+				Namespace: "default",
+				UserInfo:  authnv1.UserInfo{Username: tt.user},
+			}}
+			if tt.operation != admissionv1.Create {
+				req.OldObject = raw(t, tt.old)
+			}
+			if tt.operation != admissionv1.Delete {
+				req.Object = raw(t, tt.obj)
+			}
+
+			resp := h.Handle(context.Background(), req)
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v (%v)", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestDefaultOperatorUser(t *testing.T) {
+	tests := []struct {
+		name, namespace, serviceAccount, want string
+	}{
+		{name: "in a Pod", namespace: "webapp-system", serviceAccount: "webapp-operator", want: operatorUser},
+		{name: "no namespace", serviceAccount: "webapp-operator"},
+		{name: "no service account", namespace: "webapp-system"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NamespaceEnv, tt.namespace)
+			t.Setenv(ServiceAccountEnv, tt.serviceAccount)
+			if got := DefaultOperatorUser(); got != tt.want {
+				t.Errorf("DefaultOperatorUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
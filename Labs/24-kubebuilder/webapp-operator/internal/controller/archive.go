@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// archiveDigestAnnotation records the archive digest on the pod template, so
+	// a new digest rolls the Pods and their verification can be told apart.
+	archiveDigestAnnotation = "apps.codewizard.io/archive-sha256"
+	// archiveContainer is the init container fetching the archive.
+	archiveContainer = "fetch-archive"
+	// archiveCredentialsDir is where a dockerconfigjson pull secret is mounted.
+	archiveCredentialsDir = "/etc/archive-credentials"
+	// archiveMismatchExitCode is the exit code of the init container on a digest
+	// mismatch (EX_DATAERR), told apart from download and unpacking errors.
+	archiveMismatchExitCode = 65
+	// archiveVerifyRequeue is how often the Pods are checked while none has
+	// verified the archive yet, since Pods are not watched.
+	archiveVerifyRequeue = 15 * time.Second
+)
+
+// archiveHTTPScript downloads, verifies and unpacks a tarball. Like the smoke
+// tests, it reads everything from the spec from environment variables.
+const archiveHTTPScript = `set -eu
+tmp=$(mktemp -d)
+if [ -n "${ARCHIVE_USERNAME:-}" ]; then
+  curl -fsSL --retry 3 -u "$ARCHIVE_USERNAME:$ARCHIVE_PASSWORD" -o "$tmp/archive" "$ARCHIVE_URL"
+else
+  curl -fsSL --retry 3 -o "$tmp/archive" "$ARCHIVE_URL"
+fi
+actual=$(sha256sum "$tmp/archive" | cut -d' ' -f1)
+if [ "$actual" != "$ARCHIVE_SHA256" ]; then
+  echo "checksum mismatch: $ARCHIVE_URL has sha256 $actual, want $ARCHIVE_SHA256" >&2
+  exit 65
+fi
+tar -xf "$tmp/archive" -C "$ARCHIVE_DEST"
+`
+
+// archiveOCIScript checks that the tag, if any, still points at the expected
+// manifest, then pulls the artifact by digest and unpacks its layers.
+const archiveOCIScript = `set -eu
+config=""
+if [ -n "${ARCHIVE_REGISTRY_CONFIG:-}" ]; then config="--registry-config $ARCHIVE_REGISTRY_CONFIG"; fi
+if [ -n "${ARCHIVE_TAG:-}" ]; then
+  actual=$(oras resolve $config "$ARCHIVE_REPOSITORY:$ARCHIVE_TAG")
+  if [ "$actual" != "sha256:$ARCHIVE_SHA256" ]; then
+    echo "checksum mismatch: $ARCHIVE_REPOSITORY:$ARCHIVE_TAG has digest $actual, want sha256:$ARCHIVE_SHA256" >&2
+    exit 65
+  fi
+fi
+tmp=$(mktemp -d)
+oras pull $config -o "$tmp" "$ARCHIVE_REPOSITORY@sha256:$ARCHIVE_SHA256"
+for f in "$tmp"/*; do
+  if [ -d "$f" ]; then cp -R "$f"/. "$ARCHIVE_DEST"/; else tar -xf "$f" -C "$ARCHIVE_DEST"; fi
+done
+`
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileArchiveVerification reports in the SourceVerified condition whether
+// the Pods of the current archive digest verified and unpacked it. A digest
+// mismatch fails their init container, which is reported with its message.
+// It returns when to look again while the verification is pending.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileArchiveVerification(ctx context.Context, webapp *webappv1.WebApp) (_ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepSource, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileArchiveVerification", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	archive := archiveSource(webapp)
+	if archive == nil {
+		return 0, r.removeCondition(ctx, webapp, webappv1.ConditionTypeSourceVerified)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(webapp.Namespace), client.MatchingLabels(labelsForWebApp(webapp.Name))); err != nil {
+		return 0, err
+	}
+	verified, mismatch := false, ""
+	for _, pod := range pods.Items {
+		if pod.Annotations[archiveDigestAnnotation] != archive.SHA256 {
+			continue
+		}
+		for _, status := range pod.Status.InitContainerStatuses {
+			if status.Name != archiveContainer {
+				continue
+			}
+			// Only the latest run counts, so a retry that succeeded clears an
+			// earlier mismatch; while the container waits to restart, its last run does
+			terminated := status.State.Terminated
+			if terminated == nil && status.State.Waiting != nil {
+				terminated = status.LastTerminationState.Terminated
+			}
+			switch {
+			case terminated == nil:
+			case terminated.ExitCode == archiveMismatchExitCode:
+				mismatch = strings.TrimSpace(terminated.Message)
+			case terminated.ExitCode == 0:
+				verified = true
+			}
+		}
+	}
+
+	switch {
+	case mismatch != "":
+		message := fmt.Sprintf("the archive failed verification: %s", mismatch)
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceVerified); cond == nil || cond.Message != message {
+			log.FromContext(ctx).Info("Archive digest mismatch", "name", webapp.Name, "url", archive.URL)
+			r.event(webapp, corev1.EventTypeWarning, "ChecksumMismatch", message)
+		}
+		return archiveVerifyRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceVerified,
+			metav1.ConditionFalse, "ChecksumMismatch", message)
+	case verified:
+		return 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceVerified, metav1.ConditionTrue, "Verified",
+			fmt.Sprintf("serving %s with sha256 %s", archive.URL, archive.SHA256))
+	default:
+		return archiveVerifyRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceVerified,
+			metav1.ConditionUnknown, "Verifying", fmt.Sprintf("waiting for a Pod to fetch %s", archive.URL))
+	}
+}
+
+// archiveSource returns the WebApp's archive source, or nil if it has none.
+func archiveSource(webapp *webappv1.WebApp) *webappv1.ArchiveSource {
+	if webapp.Spec.Source == nil {
+		return nil
+	}
+	return webapp.Spec.Source.Archive
+}
+
+// withArchiveSource replaces the html ConfigMap volume of the pod template with
+// an emptyDir the init container unpacks the verified archive into.
+func withArchiveSource(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	archive := archiveSource(webapp)
+	if archive == nil {
+		return
+	}
+	template.Annotations[archiveDigestAnnotation] = archive.SHA256
+	emptyHTMLVolume(template)
+
+	container := corev1.Container{
+		Name:            archiveContainer,
+		Image:           archive.Image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c"},
+		Env: []corev1.EnvVar{
+			{Name: "ARCHIVE_SHA256", Value: archive.SHA256},
+			{Name: "ARCHIVE_DEST", Value: htmlRoot},
+		},
+		// The last lines of the output explain a failure in the Pod status
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts:             []corev1.VolumeMount{{Name: "html", MountPath: htmlRoot}},
+	}
+
+	if reference, ok := strings.CutPrefix(archive.URL, "oci://"); ok {
+		repository, tag := splitOCIReference(reference)
+		container.Args = []string{archiveOCIScript}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "ARCHIVE_REPOSITORY", Value: repository},
+			corev1.EnvVar{Name: "ARCHIVE_TAG", Value: tag})
+		if archive.PullSecretRef != nil {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  "ARCHIVE_REGISTRY_CONFIG",
+				Value: archiveCredentialsDir + "/" + corev1.DockerConfigJsonKey,
+			})
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name: "archive-credentials", MountPath: archiveCredentialsDir, ReadOnly: true,
+			})
+			template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+				Name: "archive-credentials",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+					SecretName: archive.PullSecretRef.Name,
+				}},
+			})
+		}
+	} else {
+		container.Args = []string{archiveHTTPScript}
+		container.Env = append(container.Env, corev1.EnvVar{Name: "ARCHIVE_URL", Value: archive.URL})
+		if archive.PullSecretRef != nil {
+			for _, env := range []struct{ name, key string }{
+				{"ARCHIVE_USERNAME", "username"},
+				{"ARCHIVE_PASSWORD", "password"},
+			} {
+				container.Env = append(container.Env, corev1.EnvVar{
+					Name: env.name,
+					ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: *archive.PullSecretRef,
+						Key:                  env.key,
+					}},
+				})
+			}
+		}
+	}
+	template.Spec.InitContainers = append(template.Spec.InitContainers, container)
+}
+
+// splitOCIReference splits "registry/repository:tag" into the repository and
+// the tag, which is empty when the reference has none.
+func splitOCIReference(reference string) (string, string) {
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		return reference[:i], reference[i+1:]
+	}
+	return reference, ""
+}
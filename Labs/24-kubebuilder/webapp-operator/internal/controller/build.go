@@ -0,0 +1,417 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// buildAnnotation records the served build on the pod template, so a new
+	// successful build rolls the Pods.
+	buildAnnotation = "apps.codewizard.io/build"
+	// buildComponent labels the build Jobs and their Pods.
+	buildComponent = "build"
+	// buildContainer runs the builder command.
+	buildContainer = "build"
+	// buildsDir is where the build claim is mounted in the build Job. Each
+	// build writes to its own subdirectory, named after the build ID.
+	buildsDir = "/builds"
+	// buildWorkspace is where the build Job checks out the source.
+	buildWorkspace = "/workspace"
+	// buildPruneImage removes the output of builds that are no longer needed.
+	buildPruneImage = "busybox:1.36"
+	// buildBackoffLimit retries a failing build once, e.g. after a node failure.
+	buildBackoffLimit = 1
+)
+
+// buildPruneScript deletes every build but the one starting and the ones served.
+const buildPruneScript = `for dir in "$BUILDS_DIR"/*; do
+  case " $BUILD_ID $KEEP_IDS " in *" ${dir##*/} "*) ;; *) rm -rf "$dir" ;; esac
+done`
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileBuild renders the git source commit pinned in the spec with
+// spec.build in a Job writing to the build claim, and records its progress in
+// status.build. It runs on the spec the rollout gate let through, so held
+// commits are not built. The Pods serve the last successful build, so a
+// failing build never replaces a working site. It returns whether the claim
+// conflicts with the replicas, which leaves the Deployment alone, and when to
+// look again.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileBuild(ctx context.Context, webapp *webappv1.WebApp) (_ bool, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepBuild, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileBuild", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	if webapp.Spec.Build == nil {
+		if webapp.Status.Build != nil {
+			webapp.Status.Build = nil
+			if err := r.persistStatus(ctx, webapp); err != nil {
+				return false, 0, err
+			}
+		}
+		return false, 0, r.removeCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded)
+	}
+	pinned := withPinnedCommit(webapp)
+	if gitSource(pinned) == nil || gitSource(pinned).Commit == "" {
+		return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded, metav1.ConditionUnknown,
+			"WaitingForSource", "waiting for the git source to resolve to a commit")
+	}
+	commit := gitSource(pinned).Commit
+	// The build runs before reconcileOwnership, so it checks its claim itself
+	conflict, err := r.claim(ctx, webapp, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name: buildClaimName(webapp), Namespace: webapp.Namespace,
+	}})
+	if err != nil {
+		return false, 0, err
+	}
+	if conflict != "" {
+		return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded, metav1.ConditionUnknown, "NameConflict", conflict)
+	}
+	claim, err := r.ensureBuildClaim(ctx, webapp)
+	if err != nil {
+		return false, 0, fmt.Errorf("creating build claim: %w", err)
+	}
+	if conflict := accessModeConflict(claim, webapp.Spec.Replicas, buildStorage(webapp).ReadWriteOncePolicy); conflict != "" {
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeBuildSucceeded); cond == nil || cond.Message != conflict {
+			logger.Info("Build claim does not fit the replicas", "name", webapp.Name, "claim", claim.Name)
+			r.event(webapp, corev1.EventTypeWarning, "AccessModeConflict", conflict)
+		}
+		return true, volumeRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded,
+			metav1.ConditionFalse, "AccessModeConflict", conflict)
+	}
+
+	id, err := buildID(pinned)
+	if err != nil {
+		return false, 0, err
+	}
+	status := webapp.Status.Build
+	if status == nil {
+		status = &webappv1.BuildStatus{}
+	}
+	if status.ID == id && status.Phase != webappv1.BuildPhaseRunning {
+		// Finished; the Job may be gone
+		return false, 0, nil
+	}
+
+	name := fmt.Sprintf("%s-build-%s", webapp.Name, id)
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, job)
+	if errors.IsNotFound(err) {
+		keep, err := r.servedBuilds(ctx, webapp)
+		if err != nil {
+			return false, 0, err
+		}
+		job = buildJobForWebApp(pinned, name, id, keep)
+		if err := ctrl.SetControllerReference(webapp, job, r.Scheme); err != nil {
+			return false, 0, err
+		}
+		logger.Info("Starting build", "name", webapp.Name, "job", name, "commit", commit)
+		if err := r.Create(ctx, job); err != nil {
+			return false, 0, err
+		}
+		status.ID, status.Commit, status.JobName = id, commit, name
+		status.Phase = webappv1.BuildPhaseRunning
+		status.Logs = fmt.Sprintf("kubectl logs -n %s job/%s -c %s", webapp.Namespace, name, buildContainer)
+		status.StartTime = &metav1.Time{Time: time.Now()}
+		status.CompletionTime, status.Duration = nil, nil
+		webapp.Status.Build = status
+		if err := r.persistStatus(ctx, webapp); err != nil {
+			return false, 0, err
+		}
+		return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded, metav1.ConditionUnknown, "Building",
+			fmt.Sprintf("building commit %s", status.Commit))
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	var phase webappv1.BuildPhase
+	switch {
+	case jobHasCondition(job, batchv1.JobComplete):
+		phase = webappv1.BuildPhaseSucceeded
+	case jobHasCondition(job, batchv1.JobFailed):
+		phase = webappv1.BuildPhaseFailed
+	default:
+		return false, 0, nil
+	}
+
+	now := time.Now()
+	status.Phase = phase
+	status.CompletionTime = &metav1.Time{Time: now}
+	if status.StartTime != nil {
+		status.Duration = &metav1.Duration{Duration: now.Sub(status.StartTime.Time).Round(time.Second)}
+	}
+	if phase == webappv1.BuildPhaseSucceeded {
+		status.LastSuccessfulID, status.LastSuccessfulCommit = status.ID, status.Commit
+	}
+	webapp.Status.Build = status
+	if err := r.persistStatus(ctx, webapp); err != nil {
+		return false, 0, err
+	}
+
+	if phase == webappv1.BuildPhaseSucceeded {
+		logger.Info("Build succeeded", "name", webapp.Name, "job", name, "duration", status.Duration)
+		r.event(webapp, corev1.EventTypeNormal, "BuildSucceeded", fmt.Sprintf("built commit %s", status.Commit))
+		if err := r.pruneBuildJobs(ctx, webapp, name); err != nil {
+			return false, 0, err
+		}
+		return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded, metav1.ConditionTrue, "BuildSucceeded",
+			fmt.Sprintf("serving the build of commit %s", status.Commit))
+	}
+
+	message := fmt.Sprintf("the build of commit %s failed; see %s", status.Commit, status.Logs)
+	if status.LastSuccessfulCommit != "" {
+		message += fmt.Sprintf("; still serving the build of commit %s", status.LastSuccessfulCommit)
+	}
+	logger.Info("Build failed", "name", webapp.Name, "job", name)
+	r.event(webapp, corev1.EventTypeWarning, "BuildFailed", message)
+	return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeBuildSucceeded, metav1.ConditionFalse, "BuildFailed", message)
+}
+
+// ensureBuildClaim creates the PersistentVolumeClaim holding the builds if it
+// does not exist, and returns it.
+func (r *WebAppReconciler) ensureBuildClaim(ctx context.Context, webapp *webappv1.WebApp) (*corev1.PersistentVolumeClaim, error) {
+	claim := buildClaimForWebApp(webapp)
+	existing := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(claim), existing)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err := ctrl.SetControllerReference(webapp, claim, r.Scheme); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Creating build claim", "name", claim.Name)
+	return claim, r.Create(ctx, claim)
+}
+
+// servedBuilds returns the IDs of the builds a new build must leave in place:
+// the last successful one, and those the WebApp's Deployments serve, such as
+// the previous color or the stable track during a rollout.
+func (r *WebAppReconciler) servedBuilds(ctx context.Context, webapp *webappv1.WebApp) ([]string, error) {
+	var ids []string
+	if webapp.Status.Build != nil && webapp.Status.Build.LastSuccessfulID != "" {
+		ids = append(ids, webapp.Status.Build.LastSuccessfulID)
+	}
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments, client.InNamespace(webapp.Namespace),
+		client.MatchingLabels(labelsForWebApp(webapp.Name))); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		dep := &deployments.Items[i]
+		if id := dep.Spec.Template.Annotations[buildAnnotation]; id != "" && metav1.IsControlledBy(dep, webapp) && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// pruneBuildJobs deletes the build Jobs other than the one of the served build.
+func (r *WebAppReconciler) pruneBuildJobs(ctx context.Context, webapp *webappv1.WebApp, keep string) error {
+	labels := labelsForWebApp(webapp.Name)
+	labels["app.kubernetes.io/component"] = buildComponent
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(webapp.Namespace), client.MatchingLabels(labels)); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		old := &jobs.Items[i]
+		if old.Name == keep || !metav1.IsControlledBy(old, webapp) {
+			continue
+		}
+		if err := r.Delete(ctx, old, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildID identifies the build of the pinned source commit with the current
+// builder settings, so changing either starts a new build.
+func buildID(webapp *webappv1.WebApp) (string, error) {
+	data, err := json.Marshal([]any{
+		gitSource(webapp).Commit,
+		gitSource(webapp).Subdirectory,
+		webapp.Spec.Build.Image,
+		webapp.Spec.Build.Command,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:5]), nil
+}
+
+// buildClaimName returns the name of the WebApp's build claim.
+func buildClaimName(webapp *webappv1.WebApp) string {
+	return webapp.Name + "-builds"
+}
+
+// buildStorage returns the storage settings of the build claim.
+func buildStorage(webapp *webappv1.WebApp) *webappv1.BuildStorage {
+	if webapp.Spec.Build.Storage == nil {
+		return &webappv1.BuildStorage{}
+	}
+	return webapp.Spec.Build.Storage
+}
+
+// buildClaimForWebApp returns the PersistentVolumeClaim holding the builds.
+func buildClaimForWebApp(webapp *webappv1.WebApp) *corev1.PersistentVolumeClaim {
+	storage := buildStorage(webapp)
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      buildClaimName(webapp),
+			Namespace: webapp.Namespace,
+			Labels:    labelsForWebApp(webapp.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: storage.StorageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: storage.Size},
+			},
+		},
+	}
+	if storage.AccessMode != "" {
+		claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{storage.AccessMode}
+	}
+	return claim
+}
+
+// buildJobForWebApp returns the Job checking out the pinned source commit and
+// running the builder into the build's directory on the claim. It first
+// prunes the builds other than the ones to keep.
+func buildJobForWebApp(webapp *webappv1.WebApp, name, id string, keep []string) *batchv1.Job {
+	git := gitSource(webapp)
+
+	labels := labelsForWebApp(webapp.Name)
+	labels["app.kubernetes.io/component"] = buildComponent
+	backoffLimit := int32(buildBackoffLimit)
+	builds := corev1.VolumeMount{Name: "builds", MountPath: buildsDir}
+	workspace := corev1.VolumeMount{Name: "workspace", MountPath: buildWorkspace}
+
+	// The Job checks out the commit the build is named after
+	checkout := gitSyncContainer(webapp, buildWorkspace, "src")
+	checkout.VolumeMounts = []corev1.VolumeMount{workspace}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					// Not the WebApp selector labels, so the Service never routes to the build Pod
+					Labels: map[string]string{
+						"app.kubernetes.io/instance":  webapp.Name,
+						"app.kubernetes.io/component": buildComponent,
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{
+						{
+							Name:         "prune",
+							Image:        buildPruneImage,
+							Command:      []string{"/bin/sh", "-c", buildPruneScript},
+							Env:          []corev1.EnvVar{{Name: "BUILDS_DIR", Value: buildsDir}, {Name: "BUILD_ID", Value: id}, {Name: "KEEP_IDS", Value: strings.Join(keep, " ")}},
+							VolumeMounts: []corev1.VolumeMount{builds},
+						},
+						checkout,
+					},
+					Containers: []corev1.Container{
+						{
+							Name:         buildContainer,
+							Image:        webapp.Spec.Build.Image,
+							Command:      webapp.Spec.Build.Command,
+							WorkingDir:   path.Join(buildWorkspace, "src", git.Subdirectory),
+							Env:          []corev1.EnvVar{{Name: "OUTPUT_DIR", Value: path.Join(buildsDir, id)}},
+							VolumeMounts: []corev1.VolumeMount{workspace, builds},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{Name: "workspace", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+						{Name: "builds", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: buildClaimName(webapp),
+						}}},
+					},
+				},
+			},
+		},
+	}
+	if buildStorage(webapp).ReadWriteOncePolicy == webappv1.ReadWriteOncePolicySameNode {
+		// Preferred only, since the first build may run before any Pod exists
+		job.Spec.Template.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+				Weight: 100,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: labelsForWebApp(webapp.Name)},
+					TopologyKey:   corev1.LabelHostname,
+				},
+			}},
+		}}
+	}
+	return job
+}
+
+// withBuild serves the last successful build from the build claim. Until the
+// first build succeeds, the message page is served. With the SameNode policy,
+// the Pods require each other's node.
+func withBuild(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	if webapp.Spec.Build == nil || webapp.Status.Build == nil || webapp.Status.Build.LastSuccessfulID == "" {
+		return
+	}
+	id := webapp.Status.Build.LastSuccessfulID
+	template.Annotations[buildAnnotation] = id
+
+	for i := range template.Spec.Volumes {
+		if template.Spec.Volumes[i].Name == "html" {
+			template.Spec.Volumes[i].VolumeSource = corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: buildClaimName(webapp), ReadOnly: true},
+			}
+		}
+	}
+	for i := range template.Spec.Containers {
+		for j := range template.Spec.Containers[i].VolumeMounts {
+			if mount := &template.Spec.Containers[i].VolumeMounts[j]; mount.Name == "html" {
+				mount.SubPath = id
+				mount.ReadOnly = true
+			}
+		}
+	}
+	if buildStorage(webapp).ReadWriteOncePolicy == webappv1.ReadWriteOncePolicySameNode {
+		withSameNode(webapp, template)
+	}
+}
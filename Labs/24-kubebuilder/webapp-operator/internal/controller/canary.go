@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// trackLabel selects the Pods of one Canary track.
+	trackLabel  = "apps.codewizard.io/track"
+	trackStable = "stable"
+	trackCanary = "canary"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileCanary drives a Canary rollout. The stable "<name>" Deployment keeps
+// the previous version while "<name>-canary" runs the new one; both match the
+// Service selector, so their replica ratio sets the traffic split. Each step
+// holds its weight for its pause and, if manual, until promoted by annotation.
+// After the last step the new version is promoted to the stable Deployment.
+//
+// WebApps have no ingress exposure, so there is no weighted routing: the split
+// is only as fine-grained as spec.replicas allows.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileCanary(ctx context.Context, webapp *webappv1.WebApp) (_ *appsv1.Deployment, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepDeployment, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileCanary", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	status := webappv1.RolloutStatus{}
+	if prev := webapp.Status.Rollout; prev != nil {
+		// Only the Canary fields carry over from another strategy
+		status = webappv1.RolloutStatus{
+			CanaryHash:    prev.CanaryHash,
+			CurrentStep:   prev.CurrentStep,
+			CanaryWeight:  prev.CanaryWeight,
+			StepStartedAt: prev.StepStartedAt,
+			Aborted:       prev.Aborted,
+		}
+	}
+	hash := rolloutHash(webapp)
+
+	abort, err := r.consumeAnnotation(ctx, webapp, webappv1.AnnotationAbortRollout)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stable, err := r.getDeployment(ctx, webapp, webapp.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// ── No rollout in progress: the stable Deployment is missing or already runs this version
+	adopted := false
+	if stable != nil {
+		if adopted, err = r.stableRuns(ctx, stable, webapp, hash); err != nil {
+			return nil, 0, err
+		}
+	}
+	if stable == nil || adopted {
+		dep, err := r.applyStable(ctx, webapp, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Keep a promoted canary serving until the stable Pods have rolled
+		if deploymentReady(dep) {
+			if err := r.deleteStaleWorkloads(ctx, webapp, webapp.Name); err != nil {
+				return nil, 0, err
+			}
+			return dep, 0, r.setRolloutStatus(ctx, webapp, nil)
+		}
+		return dep, 0, nil
+	}
+
+	// The stable Pods keep serving during the rollout, so a restart reaches them directly
+	if err := r.restartDeployment(ctx, webapp, stable); err != nil {
+		return nil, 0, err
+	}
+
+	// ── Aborted: drop the canary and give the stable version all the traffic
+	// until the spec changes again
+	if abort || (status.Aborted && status.CanaryHash == hash) {
+		if abort {
+			logger.Info("Aborting canary rollout", "name", webapp.Name)
+			r.event(webapp, corev1.EventTypeWarning, "RolloutAborted", "canary removed, stable version restored")
+		}
+		if err := r.deleteStaleWorkloads(ctx, webapp, webapp.Name); err != nil {
+			return nil, 0, err
+		}
+		if err := r.scaleDeployment(ctx, stable, webapp.Spec.Replicas); err != nil {
+			return nil, 0, err
+		}
+		return stable, 0, r.setRolloutStatus(ctx, webapp, &webappv1.RolloutStatus{CanaryHash: hash, Aborted: true})
+	}
+
+	// ── A new version: (re)start the steps whenever the canary target changes
+	if status.CanaryHash != hash || status.CurrentStep == nil {
+		first := int32(0)
+		status = webappv1.RolloutStatus{CanaryHash: hash, CurrentStep: &first}
+	}
+
+	var canary *appsv1.Deployment
+	var requeueAfter time.Duration
+	steps := canarySteps(webapp)
+	for int(*status.CurrentStep) < len(steps) {
+		step := steps[*status.CurrentStep]
+		replicas := canaryReplicas(webapp.Spec.Replicas, step.Weight)
+		if canary, err = r.applyCanary(ctx, webapp, hash, replicas); err != nil {
+			return nil, 0, err
+		}
+		status.CanaryWeight = step.Weight
+		if !deploymentReady(canary) {
+			// The Deployment watch re-triggers reconciliation as the Pods become ready
+			logger.Info("Waiting for canary to become ready", "name", webapp.Name, "step", *status.CurrentStep)
+			break
+		}
+		// Only move stable traffic over once the canary can take it
+		if err := r.scaleDeployment(ctx, stable, webapp.Spec.Replicas-replicas); err != nil {
+			return nil, 0, err
+		}
+		if status.StepStartedAt == nil {
+			now := metav1.Now()
+			status.StepStartedAt = &now
+		}
+
+		wait, held, err := r.canaryStepHeld(ctx, webapp, step, status.StepStartedAt.Time)
+		if err != nil {
+			return nil, 0, err
+		}
+		if held {
+			requeueAfter = wait
+			break
+		}
+
+		r.event(webapp, corev1.EventTypeNormal, "CanaryStepCompleted",
+			fmt.Sprintf("step %d (weight %d%%) completed", *status.CurrentStep, step.Weight))
+		next := *status.CurrentStep + 1
+		status.CurrentStep = &next
+		status.StepStartedAt = nil
+	}
+
+	// ── Every step passed: promote the new version to stable
+	if int(*status.CurrentStep) >= len(steps) {
+		logger.Info("Promoting canary to stable", "name", webapp.Name)
+		r.event(webapp, corev1.EventTypeNormal, "CanaryPromoted", "new version promoted to stable")
+		status.CanaryWeight = 100
+		if stable, err = r.applyStable(ctx, webapp, hash); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return withCanaryStatus(stable, canary), requeueAfter, r.setRolloutStatus(ctx, webapp, &status)
+}
+
+// canaryStepHeld reports whether the step must still hold its weight, and for
+// how long when it is waiting on its pause. A manual step waits for the promote
+// annotation, which itself triggers reconciliation.
+func (r *WebAppReconciler) canaryStepHeld(ctx context.Context, webapp *webappv1.WebApp, step webappv1.CanaryStep, startedAt time.Time) (time.Duration, bool, error) {
+	if step.Pause != "" {
+		// The webhook rejects unparseable pauses
+		pause, _ := time.ParseDuration(step.Pause)
+		if remaining := time.Until(startedAt.Add(pause)); remaining > 0 {
+			return remaining, true, nil
+		}
+	}
+	if !step.Manual {
+		return 0, false, nil
+	}
+	promoted, err := r.consumeAnnotation(ctx, webapp, webappv1.AnnotationPromoteCanary)
+	if err != nil {
+		return 0, false, err
+	}
+	if !promoted {
+		log.FromContext(ctx).Info("Canary step waiting for promotion", "name", webapp.Name,
+			"annotation", webappv1.AnnotationPromoteCanary)
+	}
+	return 0, !promoted, nil
+}
+
+// applyStable writes the stable ConfigMaps and Deployment with the current spec.
+func (r *WebAppReconciler) applyStable(ctx context.Context, webapp *webappv1.WebApp, hash string) (*appsv1.Deployment, error) {
+	if err := r.applyContent(ctx, webapp, webapp.Name); err != nil {
+		return nil, err
+	}
+	desired := deploymentForWebApp(webapp, webapp.Name, stableLabels(webapp), webapp.Spec.Replicas)
+	desired.Spec.Template.Annotations[rolloutHashAnnotation] = hash
+	return r.applyDeployment(ctx, webapp, desired)
+}
+
+// applyCanary writes the canary ConfigMaps and Deployment with the current spec.
+func (r *WebAppReconciler) applyCanary(ctx context.Context, webapp *webappv1.WebApp, hash string, replicas int32) (*appsv1.Deployment, error) {
+	name := webapp.Name + "-" + trackCanary
+	if err := r.applyContent(ctx, webapp, name); err != nil {
+		return nil, err
+	}
+	labels := labelsForWebApp(webapp.Name)
+	labels[trackLabel] = trackCanary
+	desired := deploymentForWebApp(webapp, name, labels, replicas)
+	desired.Spec.Template.Annotations[rolloutHashAnnotation] = hash
+	return r.applyDeployment(ctx, webapp, desired)
+}
+
+// scaleDeployment sets the replica count of an existing Deployment, leaving its template alone.
+func (r *WebAppReconciler) scaleDeployment(ctx context.Context, dep *appsv1.Deployment, replicas int32) error {
+	if dep.Spec.Replicas != nil && *dep.Spec.Replicas == replicas {
+		return nil
+	}
+	log.FromContext(ctx).Info("Scaling Deployment", "name", dep.Name, "replicas", replicas)
+	dep.Spec.Replicas = &replicas
+	return r.Update(ctx, dep)
+}
+
+// consumeAnnotation reports whether the WebApp carries the annotation set to
+// "true", removing it so it only takes effect once.
+func (r *WebAppReconciler) consumeAnnotation(ctx context.Context, webapp *webappv1.WebApp, key string) (bool, error) {
+	if webapp.Annotations[key] != "true" {
+		return false, nil
+	}
+	if err := r.updateWebApp(ctx, webapp, func(w *webappv1.WebApp) {
+		delete(w.Annotations, key)
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// stableRuns reports whether the stable Deployment already runs the given version.
+// A Deployment left by the RollingUpdate strategy carries no hash; it is adopted
+// when everything the hash covers already matches the spec: its pod template
+// and the content of the ConfigMaps it mounts.
+func (r *WebAppReconciler) stableRuns(ctx context.Context, stable *appsv1.Deployment, webapp *webappv1.WebApp, hash string) (bool, error) {
+	if h, ok := stable.Spec.Template.Annotations[rolloutHashAnnotation]; ok {
+		return h == hash, nil
+	}
+	// It was created with the labels of the RollingUpdate strategy
+	desired := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), webapp.Spec.Replicas)
+	if podTemplateChanged(&desired.Spec.Template, &stable.Spec.Template) {
+		return false, nil
+	}
+	for _, want := range []*corev1.ConfigMap{
+		htmlConfigMapForWebApp(webapp, webapp.Name+"-html"),
+		nginxConfigMapForWebApp(webapp, webapp.Name+"-nginx"),
+	} {
+		live := &corev1.ConfigMap{}
+		exists, err := r.getChild(ctx, want.Namespace, want.Name, live)
+		if err != nil || !exists {
+			return false, err
+		}
+		if !equality.Semantic.DeepEqual(live.Data, want.Data) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// withCanaryStatus adds the canary's Pods to the stable Deployment status, since
+// both serve traffic while a Canary rollout is in progress.
+func withCanaryStatus(stable, canary *appsv1.Deployment) *appsv1.Deployment {
+	if canary == nil {
+		return stable
+	}
+	combined := stable.DeepCopy()
+	combined.Status.ReadyReplicas += canary.Status.ReadyReplicas
+	combined.Status.AvailableReplicas += canary.Status.AvailableReplicas
+	return combined
+}
+
+// canaryReplicas returns how many of the total replicas run the canary at the
+// given weight, rounded up so any non-zero weight gets at least one Pod.
+func canaryReplicas(total, weight int32) int32 {
+	return min((total*weight+99)/100, total)
+}
+
+// canarySteps returns the configured Canary steps.
+func canarySteps(webapp *webappv1.WebApp) []webappv1.CanaryStep {
+	if webapp.Spec.Rollout == nil || webapp.Spec.Rollout.Canary == nil {
+		return nil
+	}
+	return webapp.Spec.Rollout.Canary.Steps
+}
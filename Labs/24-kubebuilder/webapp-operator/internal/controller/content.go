@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+	"codewizard.io/webapp-operator/pkg/markdown"
+)
+
+// contentHashAnnotation records the checksum of the served HTML on the pod template.
+const contentHashAnnotation = "apps.codewizard.io/content-hash"
+
+// errMarkdownNotFound is returned while the ConfigMap key holding the Markdown does not exist.
+var errMarkdownNotFound = errors.New("markdown not found")
+
+// layout is the page shared by the home page and the pages of a rendered
+// site. The body is rendered from the spec and the style is built in, so
+// neither is escaped.
+var layout = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html{{with .Lang}} lang="{{.}}"{{end}}>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+{{- with .Style}}
+  <style>{{.}}</style>
+{{- end}}
+</head>
+<body>
+{{- with .Nav}}
+<nav>
+{{- range .}}
+  <a href="{{.Href}}"{{if .Current}} aria-current="page"{{end}}>{{.Title}}</a>
+{{- end}}
+</nav>
+{{- end}}
+<main>
+{{.Body}}</main>
+</body>
+</html>
+`))
+
+// themeStyles holds the stylesheet of each built-in theme.
+var themeStyles = map[webappv1.Theme]template.CSS{
+	webappv1.ThemePlain: "",
+	webappv1.ThemeLight: `body { margin: 0; background: #fff; color: #1f2328; font: 16px/1.6 system-ui, sans-serif; }
+main { max-width: 46rem; margin: 0 auto; padding: 2rem 1rem; }
+a { color: #0969da; }
+code, pre { background: #f6f8fa; font-family: ui-monospace, monospace; }
+pre { padding: 1rem; overflow: auto; }
+blockquote { margin: 0; padding: 0 1rem; border-left: 4px solid #d0d7de; color: #59636e; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: .25rem .75rem; }
+img { max-width: 100%; }
+nav { display: flex; flex-wrap: wrap; gap: 1rem; max-width: 46rem; margin: 0 auto; padding: 1rem 1rem 0; }
+nav a[aria-current] { font-weight: bold; text-decoration: none; }`,
+	webappv1.ThemeDark: `body { margin: 0; background: #0d1117; color: #e6edf3; font: 16px/1.6 system-ui, sans-serif; }
+main { max-width: 46rem; margin: 0 auto; padding: 2rem 1rem; }
+a { color: #4493f8; }
+code, pre { background: #161b22; font-family: ui-monospace, monospace; }
+pre { padding: 1rem; overflow: auto; }
+blockquote { margin: 0; padding: 0 1rem; border-left: 4px solid #3d444d; color: #9198a1; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #3d444d; padding: .25rem .75rem; }
+img { max-width: 100%; }
+nav { display: flex; flex-wrap: wrap; gap: 1rem; max-width: 46rem; margin: 0 auto; padding: 1rem 1rem 0; }
+nav a[aria-current] { font-weight: bold; text-decoration: none; }`,
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileContent reports in the ContentReady condition whether the Markdown
+// content renders as given. It returns the WebApp with Markdown referenced
+// from a ConfigMap read inline, for the remaining steps to render, or missing
+// while the referenced key does not exist.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileContent(ctx context.Context, webapp *webappv1.WebApp) (_ *webappv1.WebApp, missing bool, err error) {
+	defer metrics.ObserveStep(metrics.StepContent, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileContent", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	md := markdownContent(webapp)
+	if md == nil {
+		return webapp, false, r.removeCondition(ctx, webapp, webappv1.ConditionTypeContentReady)
+	}
+
+	resolved, err := r.resolveMarkdown(ctx, webapp)
+	if errors.Is(err, errMarkdownNotFound) {
+		message := err.Error()
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeContentReady); cond == nil || cond.Message != message {
+			log.FromContext(ctx).Info("Markdown content not found", "name", webapp.Name, "configMap", md.ConfigMapRef.Name)
+			r.event(webapp, corev1.EventTypeWarning, "ContentNotFound", message)
+		}
+		// The ConfigMap watch reconciles again once the Markdown appears
+		return webapp, true, r.setCondition(ctx, webapp, webappv1.ConditionTypeContentReady,
+			metav1.ConditionFalse, "ConfigMapNotFound", message)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	source := resolved.Spec.Content.Markdown.Inline
+	if _, _, err := markdown.SplitFrontMatter(source); err != nil {
+		return resolved, false, r.setCondition(ctx, resolved, webappv1.ConditionTypeContentReady, metav1.ConditionFalse,
+			"InvalidFrontMatter", fmt.Sprintf("serving the whole document as Markdown: %v", err))
+	}
+	if !md.AllowRawHTML && markdown.HasScript(source) {
+		message := "the Markdown embeds script tags, which are left out; set allowRawHTML to serve them"
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeContentReady); cond == nil || cond.Message != message {
+			log.FromContext(ctx).Info("Leaving out raw HTML", "name", webapp.Name)
+			r.event(webapp, corev1.EventTypeWarning, "RawHTMLOmitted", message)
+		}
+		return resolved, false, r.setCondition(ctx, resolved, webappv1.ConditionTypeContentReady, metav1.ConditionFalse, "RawHTMLOmitted", message)
+	}
+
+	message := "serving the inline Markdown"
+	if ref := md.ConfigMapRef; ref != nil {
+		message = fmt.Sprintf("serving the Markdown in key %s of ConfigMap %s", ref.Key, ref.Name)
+	}
+	return resolved, false, r.setCondition(ctx, resolved, webappv1.ConditionTypeContentReady, metav1.ConditionTrue, "Rendered", message)
+}
+
+// resolveMarkdown returns the WebApp with the Markdown its content references
+// read inline. It fails with errMarkdownNotFound while the key does not exist.
+func (r *WebAppReconciler) resolveMarkdown(ctx context.Context, webapp *webappv1.WebApp) (*webappv1.WebApp, error) {
+	md := markdownContent(webapp)
+	if md == nil || md.ConfigMapRef == nil {
+		return webapp, nil
+	}
+	ref := md.ConfigMapRef
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: webapp.Namespace}, configMap); client.IgnoreNotFound(err) != nil {
+		return nil, fmt.Errorf("reading ConfigMap %s: %w", ref.Name, err)
+	}
+	source, ok := configMap.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("%w: ConfigMap %s has no key %s", errMarkdownNotFound, ref.Name, ref.Key)
+	}
+
+	resolved := webapp.DeepCopy()
+	resolved.Spec.Content = &webappv1.ContentSpec{
+		Theme: webapp.Spec.Content.Theme,
+		Markdown: &webappv1.MarkdownContent{
+			Inline:       source,
+			AllowRawHTML: md.AllowRawHTML,
+		},
+	}
+	return resolved, nil
+}
+
+// markdownContent returns the WebApp's Markdown content, or nil if it serves another page.
+func markdownContent(webapp *webappv1.WebApp) *webappv1.MarkdownContent {
+	if webapp.Spec.Content == nil {
+		return nil
+	}
+	return webapp.Spec.Content.Markdown
+}
+
+// htmlConfigMapForWebApp returns the ConfigMap with the given name holding the served HTML.
+func htmlConfigMapForWebApp(webapp *webappv1.WebApp, name string) *corev1.ConfigMap {
+	data := map[string]string{
+		"index.html": fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><title>%s</title></head>
+<body>
+  <h1>%s</h1>
+  <p>Managed by the <strong>WebApp Operator</strong> | Instance: <strong>%s</strong></p>
+</body>
+</html>`, webapp.Spec.Message, webapp.Spec.Message, webapp.Name),
+	}
+	if markdownContent(webapp) != nil || len(webapp.Spec.Pages) > 0 || len(contentLocales(webapp)) > 0 {
+		data = renderSite(webapp)
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+			Labels:    labelsForWebApp(webapp.Name),
+		},
+		Data: data,
+	}
+}
+
+// contentHash returns a short checksum of the HTML the WebApp serves from its
+// html ConfigMap.
+func contentHash(webapp *webappv1.WebApp) string {
+	// json.Marshal sorts map keys, so the encoding is stable
+	b, _ := json.Marshal(htmlConfigMapForWebApp(webapp, "").Data)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sitePage is a page of a rendered site.
+type sitePage struct {
+	// slug names the file of the page; the home page has none.
+	slug, href, title string
+	body              template.HTML
+}
+
+// renderSite renders the home page and spec.pages in the layout of the
+// selected theme, keyed by file name. With pages, every page links to the
+// others and sitemap.xml lists them. Each locale is rendered to files named
+// <page>.<tag>.html, picked by the nginx configuration.
+func renderSite(webapp *webappv1.WebApp) map[string]string {
+	home := sitePage{href: "/", title: webapp.Spec.Message, body: messageBody(webapp, webapp.Spec.Message)}
+	if md := markdownContent(webapp); md != nil {
+		// A front-matter error is reported by reconcileContent; the page is still rendered
+		page, _ := markdown.Render(md.Inline, md.AllowRawHTML)
+		home.title, home.body = page.Title, template.HTML(page.Body)
+		if home.title == "" {
+			home.title = webapp.Name
+		}
+	}
+	pages := []sitePage{home}
+	for _, p := range webapp.Spec.Pages {
+		pages = append(pages, renderPage(p))
+	}
+
+	data := map[string]string{}
+	renderLocale(data, webapp, "", defaultLocale(webapp), pages)
+	for _, locale := range contentLocales(webapp) {
+		translated := slices.Clone(pages)
+		if locale.Message != "" {
+			translated[0] = sitePage{href: "/", title: locale.Message, body: messageBody(webapp, locale.Message)}
+		}
+		for _, p := range locale.Pages {
+			for i := range translated {
+				if translated[i].slug == p.Slug {
+					translated[i] = renderPage(p)
+				}
+			}
+		}
+		renderLocale(data, webapp, "."+locale.Tag, locale.Tag, translated)
+	}
+	if len(pages) > 1 {
+		data["sitemap.xml"] = sitemap(webapp.Spec.BaseURL, pages)
+	}
+	return data
+}
+
+// renderPage renders the Markdown body of a page, leaving out embedded HTML.
+func renderPage(p webappv1.Page) sitePage {
+	page, _ := markdown.Render(p.Body, false)
+	return sitePage{slug: p.Slug, href: "/" + p.Slug, title: p.Title, body: template.HTML(page.Body)}
+}
+
+// messageBody returns the body of the message page.
+func messageBody(webapp *webappv1.WebApp, message string) template.HTML {
+	return template.HTML(fmt.Sprintf("<h1>%s</h1>\n<p>Managed by the <strong>WebApp Operator</strong> | Instance: <strong>%s</strong></p>\n",
+		message, webapp.Name))
+}
+
+// renderLocale renders the pages of one locale into data, with suffix
+// inserted before the .html extension of their files.
+func renderLocale(data map[string]string, webapp *webappv1.WebApp, suffix, lang string, pages []sitePage) {
+	style, ok := themeStyles[contentTheme(webapp)]
+	if !ok {
+		style = themeStyles[webappv1.ThemeLight]
+	}
+	type navLink struct {
+		Href, Title string
+		Current     bool
+	}
+	for i, page := range pages {
+		var nav []navLink
+		if len(pages) > 1 {
+			for j, link := range pages {
+				nav = append(nav, navLink{Href: link.href, Title: link.title, Current: i == j})
+			}
+		}
+		var buf bytes.Buffer
+		// The template only fails on write errors, which a bytes.Buffer never returns
+		_ = layout.Execute(&buf, struct {
+			Lang, Title string
+			Style       template.CSS
+			Nav         []navLink
+			Body        template.HTML
+		}{lang, page.title, style, nav, page.body})
+
+		name := page.slug
+		if name == "" {
+			name = "index"
+		}
+		data[name+suffix+".html"] = buf.String()
+	}
+}
+
+// sitemap lists the pages in the sitemaps.org format, at absolute URLs below
+// baseURL or, without one, at paths from the site root.
+func sitemap(baseURL string, pages []sitePage) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for _, page := range pages {
+		b.WriteString("  <url><loc>")
+		_ = xml.EscapeText(&b, []byte(strings.TrimSuffix(baseURL, "/")+page.href))
+		b.WriteString("</loc></url>\n")
+	}
+	b.WriteString("</urlset>\n")
+	return b.String()
+}
+
+// defaultLocale returns the language tag of the untranslated pages, or "" if
+// it is not known.
+func defaultLocale(webapp *webappv1.WebApp) string {
+	if webapp.Spec.Content == nil {
+		return ""
+	}
+	return webapp.Spec.Content.DefaultLocale
+}
+
+// contentLocales returns the translations of the site.
+func contentLocales(webapp *webappv1.WebApp) []webappv1.Locale {
+	if webapp.Spec.Content == nil {
+		return nil
+	}
+	return webapp.Spec.Content.Locales
+}
+
+// contentTheme returns the theme of the rendered pages.
+func contentTheme(webapp *webappv1.WebApp) webappv1.Theme {
+	if webapp.Spec.Content == nil || webapp.Spec.Content.Theme == "" {
+		return webappv1.ThemeLight
+	}
+	return webapp.Spec.Content.Theme
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+// managedByLabel marks a resource as owned by the operator.
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// ─────────────────────────────────────────────────────────────────────────────
+// applyDeletionPolicy releases the children the deletion policy wants to keep,
+// so the garbage collector leaves them alone once the WebApp is gone.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) applyDeletionPolicy(ctx context.Context, webapp *webappv1.WebApp) error {
+	children, err := r.childrenToOrphan(webapp)
+	if err != nil {
+		return err
+	}
+	if webapp.Spec.DeletionPolicy == webappv1.DeletionPolicyOrphan {
+		// The upload chunks are named by upload revision, so they are listed
+		chunks, err := r.uploadChunks(ctx, webapp)
+		if err != nil {
+			return err
+		}
+		for i := range chunks {
+			children = append(children, &chunks[i])
+		}
+	}
+	for _, child := range children {
+		if err := r.orphan(ctx, webapp, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childrenToOrphan lists the (empty) child objects to release under the WebApp's deletion policy.
+func (r *WebAppReconciler) childrenToOrphan(webapp *webappv1.WebApp) ([]client.Object, error) {
+	ns := webapp.Namespace
+	switch webapp.Spec.DeletionPolicy {
+	case webappv1.DeletionPolicyRetainService:
+		return []client.Object{
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: webapp.Name, Namespace: ns}},
+		}, nil
+	case webappv1.DeletionPolicyOrphan:
+		// Every Deployment mounts its own pair of ConfigMaps, so they have to survive with it.
+		// Missing children (e.g. the colors of a RollingUpdate WebApp) are skipped.
+		children := namedChildren(webapp,
+			[]string{webapp.Name, webapp.Name + "-preview"},
+			[]string{
+				webapp.Name,
+				webapp.Name + "-" + trackCanary,
+				colorDeploymentName(webapp, colorBlue),
+				colorDeploymentName(webapp, colorGreen),
+			})
+		// The maintenance ConfigMap is shared by the Deployments, and the claims
+		// hold the served content and the builds; children the WebApp
+		// does not control, such as a claim referenced by name, are skipped.
+		children = append(children,
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: maintenanceConfigMapName(webapp), Namespace: ns}},
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: webapp.Name + "-content", Namespace: ns}},
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: buildClaimName(webapp), Namespace: ns}},
+		)
+		installed, err := r.serviceMonitorInstalled()
+		if err != nil {
+			return nil, err
+		}
+		if installed {
+			sm := &unstructured.Unstructured{}
+			sm.SetGroupVersionKind(serviceMonitorGVK)
+			sm.SetName(webapp.Name)
+			sm.SetNamespace(ns)
+			children = append(children, sm)
+		}
+		return children, nil
+	default:
+		return nil, nil
+	}
+}
+
+// namedChildren lists the (empty) Services and Deployments with the given names,
+// each Deployment followed by the pair of ConfigMaps it mounts.
+func namedChildren(webapp *webappv1.WebApp, services, deployments []string) []client.Object {
+	ns := webapp.Namespace
+	var children []client.Object
+	for _, name := range services {
+		children = append(children, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}})
+	}
+	for _, name := range deployments {
+		children = append(children,
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name + "-html", Namespace: ns}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name + "-nginx", Namespace: ns}},
+		)
+	}
+	return children
+}
+
+// claimsForWebApp lists the (empty) PersistentVolumeClaims the operator
+// creates for the WebApp's source and build.
+func claimsForWebApp(webapp *webappv1.WebApp) []client.Object {
+	var claims []client.Object
+	if volume := volumeSource(webapp); volume != nil && volume.ClaimTemplate != nil {
+		claims = append(claims, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: volumeClaimName(webapp), Namespace: webapp.Namespace}})
+	}
+	if webapp.Spec.Build != nil {
+		claims = append(claims, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: buildClaimName(webapp), Namespace: webapp.Namespace}})
+	}
+	return claims
+}
+
+// orphan strips the WebApp's controller reference and the managed-by label from
+// the child. Selector labels are kept so the workload keeps serving traffic.
+func (r *WebAppReconciler) orphan(ctx context.Context, webapp *webappv1.WebApp, child client.Object) error {
+	logger := log.FromContext(ctx)
+
+	err := r.Get(ctx, types.NamespacedName{Name: child.GetName(), Namespace: child.GetNamespace()}, child)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(child, webapp) {
+		return nil
+	}
+
+	var refs []metav1.OwnerReference
+	for _, ref := range child.GetOwnerReferences() {
+		if ref.UID != webapp.UID {
+			refs = append(refs, ref)
+		}
+	}
+	child.SetOwnerReferences(refs)
+
+	labels := child.GetLabels()
+	delete(labels, managedByLabel)
+	child.SetLabels(labels)
+
+	logger.Info("Orphaning child resource", "name", child.GetName(), "policy", webapp.Spec.DeletionPolicy)
+	return r.Update(ctx, child)
+}
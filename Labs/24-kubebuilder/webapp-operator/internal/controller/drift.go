@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+// FieldManager is the field manager the API server records for the operator's
+// writes; main sets it as the client's user agent. With driftPolicy Report,
+// fields last written by any other manager count as drift.
+const FieldManager = "webapp-operator"
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileDrift reports, with driftPolicy Report, the child fields that were
+// edited out-of-band and left in place, together with the field managers that
+// wrote them. It sets the Drifted condition, emits a Warning event when the
+// drift changes, and exports the drifted field count.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileDrift(ctx context.Context, webapp *webappv1.WebApp) (err error) {
+	defer metrics.ObserveStep(metrics.StepDrift, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileDrift", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	if webapp.Spec.DriftPolicy != webappv1.DriftPolicyReport {
+		metrics.DriftedFields.DeletePartialMatch(map[string]string{"namespace": webapp.Namespace, "webapp": webapp.Name})
+		return r.removeCondition(ctx, webapp, webappv1.ConditionTypeDrifted)
+	}
+
+	diffs, err := r.childDiffs(ctx, webapp)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{"ConfigMap": 0, "Deployment": 0, "Service": 0}
+	var report []string
+	for _, d := range diffs {
+		if d.live == nil {
+			continue
+		}
+		if drifted := driftedFields(d.live, d.fields); len(drifted) > 0 {
+			counts[d.kind] += len(drifted)
+			report = append(report, fmt.Sprintf("%s %s: %s", d.kind, d.name, strings.Join(drifted, "; ")))
+		}
+	}
+	for kind, n := range counts {
+		metrics.DriftedFields.WithLabelValues(webapp.Namespace, webapp.Name, kind).Set(float64(n))
+	}
+
+	if len(report) == 0 {
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeDrifted, metav1.ConditionFalse, "NoDrift",
+			"no child was edited out-of-band")
+	}
+	message := strings.Join(report, "\n")
+	if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeDrifted); cond == nil || cond.Message != message {
+		log.FromContext(ctx).Info("Children drifted", "name", webapp.Name, "drift", report)
+		r.event(webapp, corev1.EventTypeWarning, "DriftDetected", message)
+	}
+	return r.setCondition(ctx, webapp, webappv1.ConditionTypeDrifted, metav1.ConditionTrue, "Drifted", message)
+}
+
+// keptDrift returns, with driftPolicy Report, the paths of the changed fields
+// another field manager wrote, e.g. "spec.replicas". An update leaves these
+// fields at their live values and applies the rest of the desired state.
+func keptDrift(webapp *webappv1.WebApp, live client.Object, fields []string) []string {
+	if webapp.Spec.DriftPolicy != webappv1.DriftPolicyReport {
+		return nil
+	}
+	var paths []string
+	for _, f := range fields {
+		if len(fieldManagers(live, f)) > 0 {
+			path, _, _ := strings.Cut(f, ": ")
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// driftedFields returns the changed fields of the live child owned by a field
+// manager other than the operator, each followed by the managers that own it.
+func driftedFields(live client.Object, fields []string) []string {
+	var drifted []string
+	for _, f := range fields {
+		if managers := fieldManagers(live, f); len(managers) > 0 {
+			drifted = append(drifted, fmt.Sprintf("%s (by %s)", f, strings.Join(managers, ", ")))
+		}
+	}
+	return drifted
+}
+
+// fieldManagers returns the field managers other than the operator that own
+// the changed field of the live child.
+func fieldManagers(live client.Object, field string) []string {
+	path := managedPath(field)
+	var managers []string
+	for _, entry := range live.GetManagedFields() {
+		// Status writes never conflict with the desired state
+		if entry.Manager == FieldManager || entry.Subresource == "status" || entry.FieldsV1 == nil {
+			continue
+		}
+		if ownsField(entry.FieldsV1.Raw, path) && !slices.Contains(managers, entry.Manager) {
+			managers = append(managers, entry.Manager)
+		}
+	}
+	return managers
+}
+
+// keepDriftedConfigMap sets the drifted data keys of desired to their live values.
+func keepDriftedConfigMap(desired, live *corev1.ConfigMap, paths []string) {
+	for _, path := range paths {
+		key, ok := fieldKey(path, "data")
+		if !ok {
+			continue
+		}
+		if value, ok := live.Data[key]; ok {
+			desired.Data[key] = value
+		} else {
+			delete(desired.Data, key)
+		}
+	}
+}
+
+// keepDriftedDeployment sets the drifted replica and pod template fields of
+// desired to their live values.
+func keepDriftedDeployment(desired, live *appsv1.Deployment, paths []string) {
+	for _, path := range paths {
+		template, liveTemplate := &desired.Spec.Template, &live.Spec.Template
+		if name, ok := fieldKey(path, "spec.template.spec.containers"); ok {
+			template.Spec.Containers = withLiveContainer(template.Spec.Containers, liveTemplate.Spec.Containers, name)
+			continue
+		}
+		if key, ok := fieldKey(path, "spec.template.metadata.annotations"); ok {
+			if value, ok := liveTemplate.Annotations[key]; ok {
+				template.Annotations[key] = value
+			} else {
+				delete(template.Annotations, key)
+			}
+			continue
+		}
+		switch path {
+		case "spec.replicas":
+			desired.Spec.Replicas = live.Spec.Replicas
+		case "spec.template.spec.volumes":
+			template.Spec.Volumes = liveTemplate.Spec.Volumes
+		case "spec.template":
+			desired.Spec.Template = *liveTemplate.DeepCopy()
+		}
+	}
+}
+
+// withLiveContainer returns the containers with the named one as it is live,
+// keeping their order.
+func withLiveContainer(containers, live []corev1.Container, name string) []corev1.Container {
+	liveContainer := findContainer(live, name)
+	i := slices.IndexFunc(containers, func(c corev1.Container) bool { return c.Name == name })
+	switch {
+	case i >= 0 && liveContainer != nil:
+		containers[i] = *liveContainer
+	case i >= 0:
+		containers = slices.Delete(containers, i, i+1)
+	case liveContainer != nil:
+		containers = append(containers, *liveContainer)
+	}
+	return containers
+}
+
+// keepDriftedService sets the drifted type, ports and selector of desired to
+// their live values. Ports are owned as a whole list, so they are kept together.
+func keepDriftedService(desired, live *corev1.Service, paths []string) {
+	for _, path := range paths {
+		switch {
+		case path == "spec.type":
+			desired.Spec.Type = live.Spec.Type
+		case path == "spec.selector":
+			desired.Spec.Selector = live.Spec.Selector
+		case strings.HasPrefix(path, "spec.ports["):
+			desired.Spec.Ports = live.Spec.Ports
+		}
+	}
+}
+
+// fieldKey returns the key of a path inside the given map or list field, e.g.
+// "nginx" for "spec.template.spec.containers[nginx].image".
+func fieldKey(path, field string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, field+"[")
+	if !ok {
+		return "", false
+	}
+	key, _, ok := strings.Cut(rest, "]")
+	return key, ok
+}
+
+// managedPath converts a changed field as listed by the diff helpers, e.g.
+// "spec.template.spec.containers[nginx].image: a -> b", into its managedFields
+// path. Ports are keyed by port and protocol there, so they map to the whole list.
+func managedPath(field string) []string {
+	path, _, _ := strings.Cut(field, ": ")
+	var out []string
+	for path != "" {
+		name, rest := path, ""
+		if i := strings.IndexAny(path, ".["); i >= 0 {
+			name, rest = path[:i], path[i:]
+		}
+		out = append(out, "f:"+name)
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return out
+			}
+			key := rest[1:end]
+			rest = rest[end+1:]
+			switch name {
+			case "containers":
+				out = append(out, fmt.Sprintf(`k:{"name":%q}`, key))
+			case "ports":
+				return out
+			default:
+				out = append(out, "f:"+key)
+			}
+		}
+		path = strings.TrimPrefix(rest, ".")
+	}
+	return out
+}
+
+// ownsField reports whether the FieldsV1 set contains the path.
+func ownsField(raw []byte, path []string) bool {
+	var node map[string]any
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return false
+	}
+	for _, key := range path {
+		child, ok := node[key].(map[string]any)
+		if !ok {
+			return false
+		}
+		node = child
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+)
+
+const (
+	// defaultFinalizerTimeout bounds how long cleanup hooks may hold up deletion
+	// when WebAppReconciler.FinalizerTimeout is not set.
+	defaultFinalizerTimeout = 10 * time.Minute
+	// finalizerHookTimeout bounds a single run of a cleanup hook.
+	finalizerHookTimeout = 30 * time.Second
+	// finalizerBaseBackoff and finalizerMaxBackoff bound the retry delay of a failed hook.
+	finalizerBaseBackoff = 5 * time.Second
+	finalizerMaxBackoff  = 5 * time.Minute
+)
+
+// Finalizer is a cleanup hook run, in registration order, while a WebApp is being
+// deleted - e.g. removing a DNS record, deregistering from an external registry,
+// or archiving the served content. Hooks must be idempotent: a failed hook is
+// retried with backoff, and hooks that already succeeded are not run again.
+type Finalizer interface {
+	// Name identifies the hook in the WebApp status and in logs.
+	Name() string
+	// Finalize releases whatever the hook holds for the WebApp.
+	Finalize(ctx context.Context, webapp *webappv1.WebApp) error
+}
+
+// FinalizerFunc adapts a plain function into a named Finalizer.
+type FinalizerFunc struct {
+	HookName string
+	Fn       func(ctx context.Context, webapp *webappv1.WebApp) error
+}
+
+// Name returns the hook name.
+func (f FinalizerFunc) Name() string { return f.HookName }
+
+// Finalize calls the wrapped function.
+func (f FinalizerFunc) Finalize(ctx context.Context, webapp *webappv1.WebApp) error {
+	return f.Fn(ctx, webapp)
+}
+
+// ForgetMetrics is the built-in cleanup hook dropping the per-WebApp metric
+// series, so dashboards do not keep alerting on a deleted WebApp.
+var ForgetMetrics = FinalizerFunc{
+	HookName: "forget-metrics",
+	Fn: func(_ context.Context, webapp *webappv1.WebApp) error {
+		metrics.ForgetWebApp(webapp.Namespace, webapp.Name)
+		return nil
+	},
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// runFinalizers runs the registered cleanup hooks for a WebApp being deleted.
+// It returns a non-zero requeue delay while a hook is failing, and records the
+// per-hook progress in status.finalizers.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) runFinalizers(ctx context.Context, webapp *webappv1.WebApp) (time.Duration, error) {
+	logger := log.FromContext(ctx)
+
+	if len(r.Finalizers) == 0 {
+		return 0, nil
+	}
+
+	// Escape hatch: stuck cleanup must never block namespace deletion forever
+	if reason := r.finalizerEscapeReason(webapp); reason != "" {
+		logger.Info("Skipping remaining cleanup hooks", "name", webapp.Name, "reason", reason)
+		r.event(webapp, corev1.EventTypeWarning, "FinalizersSkipped", reason)
+		for _, f := range r.Finalizers {
+			hook := finalizerHookStatus(webapp, f.Name())
+			if hook.State != webappv1.FinalizerHookSucceeded {
+				hook.State = webappv1.FinalizerHookSkipped
+			}
+		}
+		return 0, r.Status().Update(ctx, webapp)
+	}
+
+	var requeue time.Duration
+	for _, f := range r.Finalizers {
+		hook := finalizerHookStatus(webapp, f.Name())
+		if hook.State == webappv1.FinalizerHookSucceeded {
+			continue
+		}
+
+		hookCtx, cancel := context.WithTimeout(ctx, finalizerHookTimeout)
+		err := f.Finalize(hookCtx, webapp)
+		cancel()
+
+		now := metav1.Now()
+		hook.Attempts++
+		hook.LastAttemptTime = &now
+		if err != nil {
+			hook.State = webappv1.FinalizerHookFailed
+			hook.Message = err.Error()
+			requeue = finalizerBackoff(hook.Attempts)
+			logger.Error(err, "Cleanup hook failed", "name", webapp.Name, "hook", f.Name(), "retryIn", requeue)
+			r.event(webapp, corev1.EventTypeWarning, "FinalizerFailed",
+				fmt.Sprintf("cleanup hook %q failed (attempt %d): %v", f.Name(), hook.Attempts, err))
+			// Hooks run in order - later hooks wait until this one succeeds
+			break
+		}
+		hook.State = webappv1.FinalizerHookSucceeded
+		hook.Message = ""
+		logger.Info("Cleanup hook succeeded", "name", webapp.Name, "hook", f.Name())
+	}
+
+	// Status().Update refreshes webapp's resourceVersion, so the caller can
+	// still remove the finalizer with a plain Update afterwards
+	if err := r.Status().Update(ctx, webapp); err != nil {
+		return 0, err
+	}
+	return requeue, nil
+}
+
+// finalizerEscapeReason explains why the remaining hooks should be skipped,
+// or returns "" if they should still run.
+func (r *WebAppReconciler) finalizerEscapeReason(webapp *webappv1.WebApp) string {
+	if webapp.Annotations[webappv1.AnnotationSkipFinalizers] == "true" {
+		return fmt.Sprintf("annotation %s is set", webappv1.AnnotationSkipFinalizers)
+	}
+
+	timeout := r.FinalizerTimeout
+	if timeout == 0 {
+		timeout = defaultFinalizerTimeout
+	}
+	if webapp.DeletionTimestamp != nil && time.Since(webapp.DeletionTimestamp.Time) > timeout {
+		return fmt.Sprintf("cleanup did not finish within %s", timeout)
+	}
+	return ""
+}
+
+// finalizerHookStatus returns the status entry for the named hook, adding a
+// Pending entry the first time the hook is seen.
+func finalizerHookStatus(webapp *webappv1.WebApp, name string) *webappv1.FinalizerHookStatus {
+	for i := range webapp.Status.Finalizers {
+		if webapp.Status.Finalizers[i].Name == name {
+			return &webapp.Status.Finalizers[i]
+		}
+	}
+	webapp.Status.Finalizers = append(webapp.Status.Finalizers, webappv1.FinalizerHookStatus{
+		Name:  name,
+		State: webappv1.FinalizerHookPending,
+	})
+	return &webapp.Status.Finalizers[len(webapp.Status.Finalizers)-1]
+}
+
+// finalizerBackoff returns the exponential retry delay after the given number of attempts.
+func finalizerBackoff(attempts int32) time.Duration {
+	delay := finalizerBaseBackoff
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= finalizerMaxBackoff {
+			return finalizerMaxBackoff
+		}
+	}
+	return delay
+}
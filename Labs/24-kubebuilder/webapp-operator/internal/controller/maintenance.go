@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileMaintenance writes the maintenance ConfigMap mounted by every
+// Deployment of the WebApp, and reports in the Maintenance condition whether
+// the maintenance page is served. nginx checks the ConfigMap's flag on every
+// request, so maintenance reaches all running Pods (of every color) as soon
+// as the kubelet syncs the volume, without a rollout.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileMaintenance(ctx context.Context, webapp *webappv1.WebApp) (err error) {
+	defer metrics.ObserveStep(metrics.StepMaintenance, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileMaintenance", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	maintenance := webapp.Spec.Maintenance
+	if maintenance == nil {
+		// Remove the ConfigMap we created earlier; the volume is optional
+		existing := &corev1.ConfigMap{}
+		found, err := r.getChild(ctx, webapp.Namespace, maintenanceConfigMapName(webapp), existing)
+		if err != nil {
+			return err
+		}
+		if found && metav1.IsControlledBy(existing, webapp) {
+			log.FromContext(ctx).Info("Deleting ConfigMap", "name", existing.Name)
+			if err := client.IgnoreNotFound(r.Delete(ctx, existing)); err != nil {
+				return err
+			}
+		}
+		return r.removeCondition(ctx, webapp, webappv1.ConditionTypeMaintenance)
+	}
+	if err := r.applyConfigMap(ctx, webapp, maintenanceConfigMapForWebApp(webapp)); err != nil {
+		return err
+	}
+	wasEnabled := meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypeMaintenance)
+
+	if !maintenance.Enabled {
+		if wasEnabled {
+			log.FromContext(ctx).Info("Leaving maintenance", "name", webapp.Name)
+			r.event(webapp, corev1.EventTypeNormal, "MaintenanceDisabled", "serving the site again")
+		}
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeMaintenance, metav1.ConditionFalse, "Disabled", "serving the site")
+	}
+
+	message := "serving the maintenance page with HTTP 503"
+	if cidrs := maintenance.AllowedCIDRs; len(cidrs) > 0 {
+		message += fmt.Sprintf(", and the site to clients in %s", strings.Join(cidrs, ", "))
+	}
+	if !wasEnabled {
+		log.FromContext(ctx).Info("Entering maintenance", "name", webapp.Name)
+		r.event(webapp, corev1.EventTypeNormal, "MaintenanceEnabled", message)
+	}
+	return r.setCondition(ctx, webapp, webappv1.ConditionTypeMaintenance, metav1.ConditionTrue, "Enabled", message)
+}
+
+// maintenanceEnabled reports whether the WebApp serves the maintenance page.
+func maintenanceEnabled(webapp *webappv1.WebApp) bool {
+	return webapp.Spec.Maintenance != nil && webapp.Spec.Maintenance.Enabled
+}
+
+// maintenanceConfigMapName returns the name of the maintenance ConfigMap,
+// which all Deployments of the WebApp share.
+func maintenanceConfigMapName(webapp *webappv1.WebApp) string {
+	return webapp.Name + "-maintenance"
+}
+
+// maintenanceConfigMapForWebApp returns the maintenance ConfigMap. It holds the
+// maintenance page, and the flag file only while maintenance is enabled.
+func maintenanceConfigMapForWebApp(webapp *webappv1.WebApp) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      maintenanceConfigMapName(webapp),
+			Namespace: webapp.Namespace,
+			Labels:    labelsForWebApp(webapp.Name),
+		},
+		Data: map[string]string{
+			maintenancePageKey: maintenancePage(webapp),
+		},
+	}
+	if maintenanceEnabled(webapp) {
+		configMap.Data[maintenanceFlagKey] = "true"
+	}
+	return configMap
+}
+
+// maintenanceVolume mounts the maintenance ConfigMap. It is optional, so Pods
+// start before the ConfigMap exists or without a maintenance block, and it
+// has no subPath, so the kubelet keeps its files in sync.
+func maintenanceVolume(webapp *webappv1.WebApp) (corev1.Volume, corev1.VolumeMount) {
+	optional := true
+	volume := corev1.Volume{
+		Name: "maintenance",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: maintenanceConfigMapName(webapp)},
+				Optional:             &optional,
+			},
+		},
+	}
+	return volume, corev1.VolumeMount{Name: "maintenance", MountPath: maintenanceDir, ReadOnly: true}
+}
+
+// retryAfterSeconds returns the Retry-After of the maintenance page.
+func retryAfterSeconds(webapp *webappv1.WebApp) int32 {
+	if webapp.Spec.Maintenance == nil || webapp.Spec.Maintenance.RetryAfterSeconds == 0 {
+		return defaultRetryAfterSeconds
+	}
+	return webapp.Spec.Maintenance.RetryAfterSeconds
+}
+
+// maintenancePage renders the maintenance page in the layout of the site's
+// theme. Unlike spec.message, the maintenance message is plain text.
+func maintenancePage(webapp *webappv1.WebApp) string {
+	style, ok := themeStyles[contentTheme(webapp)]
+	if !ok {
+		style = themeStyles[webappv1.ThemeLight]
+	}
+	message := webapp.Spec.Maintenance.Message
+	var buf bytes.Buffer
+	// The template only fails on write errors, which a bytes.Buffer never returns
+	_ = layout.Execute(&buf, struct {
+		Lang, Title string
+		Style       template.CSS
+		Nav         any
+		Body        template.HTML
+	}{defaultLocale(webapp), message, style, nil, template.HTML("<h1>" + template.HTMLEscapeString(message) + "</h1>\n")})
+	return buf.String()
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// exporterPort is the port nginx-prometheus-exporter serves /metrics on.
+	exporterPort = 9113
+	// metricsPortName names the exporter port on the container and the Service.
+	metricsPortName = "metrics"
+)
+
+// serviceMonitorGVK identifies the Prometheus Operator ServiceMonitor kind.
+// It is handled as unstructured so the operator does not depend on its Go types.
+var serviceMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "ServiceMonitor",
+}
+
+// monitoringEnabled reports whether the WebApp asked for metrics collection.
+func monitoringEnabled(webapp *webappv1.WebApp) bool {
+	return webapp.Spec.Monitoring != nil && webapp.Spec.Monitoring.Enabled
+}
+
+// exporterContainer returns the nginx-prometheus-exporter sidecar that scrapes
+// nginx's stub_status over loopback and serves Prometheus metrics.
+func exporterContainer(webapp *webappv1.WebApp) corev1.Container {
+	return corev1.Container{
+		Name:            "metrics-exporter",
+		Image:           webapp.Spec.Monitoring.ExporterImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			fmt.Sprintf("--nginx.scrape-uri=http://127.0.0.1:%d%s", webapp.Spec.Port, stubStatusPath),
+		},
+		Ports: []corev1.ContainerPort{
+			{Name: metricsPortName, ContainerPort: exporterPort, Protocol: corev1.ProtocolTCP},
+		},
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileServiceMonitor creates, updates, or removes the ServiceMonitor.
+// It is skipped gracefully when the ServiceMonitor CRD is not installed.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileServiceMonitor(ctx context.Context, webapp *webappv1.WebApp) (err error) {
+	defer metrics.ObserveStep(metrics.StepServiceMonitor, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileServiceMonitor", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	installed, err := r.serviceMonitorInstalled()
+	if err != nil {
+		return err
+	}
+	if !installed {
+		if monitoringEnabled(webapp) {
+			logger.Info("ServiceMonitor CRD not installed, skipping", "name", webapp.Name)
+		}
+		return nil
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(serviceMonitorGVK)
+	err = r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	// Monitoring turned off - remove the ServiceMonitor we created earlier
+	if !monitoringEnabled(webapp) {
+		if found && metav1.IsControlledBy(existing, webapp) {
+			logger.Info("Deleting ServiceMonitor", "name", existing.GetName())
+			return client.IgnoreNotFound(r.Delete(ctx, existing))
+		}
+		return nil
+	}
+
+	desired := serviceMonitorForWebApp(webapp)
+	if err := ctrl.SetControllerReference(webapp, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	if !found {
+		logger.Info("Creating ServiceMonitor", "name", desired.GetName())
+		return r.Create(ctx, desired)
+	}
+
+	if !equality.Semantic.DeepEqual(existing.Object["spec"], desired.Object["spec"]) {
+		existing.Object["spec"] = desired.Object["spec"]
+		logger.Info("Updating ServiceMonitor", "name", existing.GetName())
+		return r.Update(ctx, existing)
+	}
+
+	return nil
+}
+
+// serviceMonitorInstalled uses API discovery (through the REST mapper) to check
+// whether the Prometheus Operator CRDs are present in the cluster.
+func (r *WebAppReconciler) serviceMonitorInstalled() (bool, error) {
+	_, err := r.RESTMapper().RESTMapping(serviceMonitorGVK.GroupKind(), serviceMonitorGVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// serviceMonitorForWebApp returns the ServiceMonitor scraping the WebApp's metrics port.
+func serviceMonitorForWebApp(webapp *webappv1.WebApp) *unstructured.Unstructured {
+	matchLabels := map[string]interface{}{}
+	for k, v := range labelsForWebApp(webapp.Name) {
+		matchLabels[k] = v
+	}
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetName(webapp.Name)
+	sm.SetNamespace(webapp.Namespace)
+	sm.SetLabels(labelsForWebApp(webapp.Name))
+	endpoint := map[string]interface{}{
+		"port": metricsPortName,
+		"path": "/metrics",
+	}
+	if webapp.Spec.Monitoring.Interval != "" {
+		endpoint["interval"] = webapp.Spec.Monitoring.Interval
+	}
+	sm.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": matchLabels,
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+	return sm
+}
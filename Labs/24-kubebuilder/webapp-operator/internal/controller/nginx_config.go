@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+const (
+	// nginxConfigKey is the ConfigMap key holding the generated server block.
+	nginxConfigKey = "default.conf"
+	// nginxConfigDir replaces the stock conf.d directory of the nginx image.
+	nginxConfigDir = "/etc/nginx/conf.d"
+	// nginxConfigHashAnnotation records the config checksum on the pod template.
+	nginxConfigHashAnnotation = "apps.codewizard.io/nginx-config-hash"
+	// stubStatusPath exposes nginx connection counters to the metrics exporter.
+	stubStatusPath = "/stub_status"
+	// localeVariable holds the file suffix of the locale served to a request.
+	localeVariable = "webapp_locale"
+	// maintenanceVariable is 1 for the clients served the maintenance page.
+	maintenanceVariable = "webapp_maintenance"
+	// maintenanceAllowedVariable is 1 for the clients in the maintenance allow-list.
+	maintenanceAllowedVariable = "webapp_maintenance_allowed"
+	// maintenanceDir is where the maintenance ConfigMap is mounted.
+	maintenanceDir = "/etc/nginx/maintenance"
+	// maintenancePageKey is the maintenance ConfigMap key holding the maintenance page.
+	maintenancePageKey = "maintenance.html"
+	// maintenanceFlagKey is the maintenance ConfigMap key present while in maintenance.
+	maintenanceFlagKey = "enabled"
+	// defaultRetryAfterSeconds is sent in Retry-After without a maintenance block.
+	defaultRetryAfterSeconds = 300
+	// healthPath is probed instead of the site, which answers 503 in maintenance.
+	healthPath = "/healthz"
+)
+
+// nginxConfigMapForWebApp returns the ConfigMap with the given name holding the generated nginx configuration.
+func nginxConfigMapForWebApp(webapp *webappv1.WebApp, name string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+			Labels:    labelsForWebApp(webapp.Name),
+		},
+		Data: map[string]string{
+			nginxConfigKey: nginxConfigForWebApp(webapp),
+		},
+	}
+}
+
+// nginxConfigForWebApp renders the nginx server block for the WebApp.
+// It mirrors the stock nginx default.conf, but listens on spec.port and
+// enables stub_status for the metrics exporter when monitoring is on. With
+// locales, it serves each request the files of its preferred language. While
+// the maintenance ConfigMap holds its flag, clients outside the allow-list get
+// the maintenance page; the flag is checked on every request, so toggling
+// maintenance needs neither a reload nor a rollout.
+func nginxConfigForWebApp(webapp *webappv1.WebApp) string {
+	var b strings.Builder
+
+	localized := len(contentLocales(webapp)) > 0
+	if localized {
+		writeLocaleMap(&b, webapp)
+	}
+	allowList := webapp.Spec.Maintenance != nil && len(webapp.Spec.Maintenance.AllowedCIDRs) > 0
+	if allowList {
+		writeMaintenanceGeo(&b, webapp)
+	}
+
+	b.WriteString("server {\n")
+	fmt.Fprintf(&b, "    listen       %d;\n", webapp.Spec.Port)
+	b.WriteString("    server_name  localhost;\n\n")
+	b.WriteString("    set $" + maintenanceVariable + " \"\";\n")
+	fmt.Fprintf(&b, "    if (-f %s/%s) {\n", maintenanceDir, maintenanceFlagKey)
+	b.WriteString("        set $" + maintenanceVariable + " 1;\n")
+	b.WriteString("    }\n")
+	if allowList {
+		b.WriteString("    if ($" + maintenanceAllowedVariable + ") {\n")
+		b.WriteString("        set $" + maintenanceVariable + " \"\";\n")
+		b.WriteString("    }\n")
+	}
+	b.WriteString("\n    location / {\n")
+	b.WriteString("        if ($" + maintenanceVariable + ") {\n")
+	b.WriteString("            return 503;\n")
+	b.WriteString("        }\n")
+	fmt.Fprintf(&b, "        root   %s;\n", siteRoot(webapp))
+	switch {
+	case localized && len(webapp.Spec.Pages) > 0:
+		b.WriteString("        index  index${" + localeVariable + "}.html index.html;\n")
+		b.WriteString("        try_files $uri${" + localeVariable + "}.html $uri $uri.html $uri/ =404;\n")
+	case localized:
+		b.WriteString("        index  index${" + localeVariable + "}.html index.html;\n")
+	case len(webapp.Spec.Pages) > 0:
+		b.WriteString("        index  index.html index.htm;\n")
+		// Pages are served at /<slug> from <slug>.html
+		b.WriteString("        try_files $uri $uri.html $uri/ =404;\n")
+	default:
+		b.WriteString("        index  index.html index.htm;\n")
+	}
+	if localized {
+		// Caches must not serve one language to everyone
+		b.WriteString("        add_header Vary Accept-Language;\n")
+	}
+	b.WriteString("    }\n")
+
+	// The 503 keeps its status through error_page; "always" adds the
+	// header to error responses
+	b.WriteString("\n    error_page 503 @maintenance;\n")
+	b.WriteString("    location @maintenance {\n")
+	fmt.Fprintf(&b, "        root   %s;\n", maintenanceDir)
+	fmt.Fprintf(&b, "        try_files /%s =503;\n", maintenancePageKey)
+	fmt.Fprintf(&b, "        add_header Retry-After %d always;\n", retryAfterSeconds(webapp))
+	b.WriteString("        add_header Cache-Control no-store always;\n")
+	b.WriteString("    }\n")
+
+	// The probes must pass while the site answers 503
+	fmt.Fprintf(&b, "\n    location = %s {\n", healthPath)
+	b.WriteString("        access_log off;\n")
+	b.WriteString("        return 200;\n")
+	b.WriteString("    }\n")
+
+	if gitSource(webapp) != nil {
+		// Never serve the repository metadata of the checkout
+		b.WriteString("\n    location ~ /\\.git {\n")
+		b.WriteString("        deny all;\n")
+		b.WriteString("    }\n")
+	}
+
+	if monitoringEnabled(webapp) {
+		// Only the exporter sidecar (same Pod, loopback) may read the counters
+		fmt.Fprintf(&b, "\n    location = %s {\n", stubStatusPath)
+		b.WriteString("        stub_status;\n")
+		b.WriteString("        access_log off;\n")
+		b.WriteString("        allow 127.0.0.1;\n")
+		b.WriteString("        deny all;\n")
+		b.WriteString("    }\n")
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeLocaleMap writes the map from the Accept-Language header to the file
+// suffix of the best matching locale, empty for the default locale. The
+// languages listed first win over the rest, and among them longer tags, so
+// pt-BR is preferred to pt. Quality values are not weighed.
+func writeLocaleMap(b *strings.Builder, webapp *webappv1.WebApp) {
+	type choice struct{ tag, suffix string }
+	var choices []choice
+	if tag := defaultLocale(webapp); tag != "" {
+		choices = append(choices, choice{tag, ""})
+	}
+	for _, locale := range contentLocales(webapp) {
+		choices = append(choices, choice{locale.Tag, "." + locale.Tag})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return len(choices[i].tag) > len(choices[j].tag) })
+
+	fmt.Fprintf(b, "map $http_accept_language $%s {\n", localeVariable)
+	b.WriteString("    default \"\";\n")
+	for _, position := range []string{`^\s*`, `,\s*`} {
+		for _, c := range choices {
+			fmt.Fprintf(b, "    \"~*%s%s(?:[-;,\\s]|$)\" \"%s\";\n", position, c.tag, c.suffix)
+		}
+	}
+	b.WriteString("}\n\n")
+}
+
+// writeMaintenanceGeo writes the geo block setting the allow-list variable
+// for every client in the allowed ranges. Behind a proxy, or a Service with
+// externalTrafficPolicy Cluster, nginx sees the proxy's address instead.
+func writeMaintenanceGeo(b *strings.Builder, webapp *webappv1.WebApp) {
+	fmt.Fprintf(b, "geo $%s {\n", maintenanceAllowedVariable)
+	b.WriteString("    default 0;\n")
+	for _, cidr := range webapp.Spec.Maintenance.AllowedCIDRs {
+		fmt.Fprintf(b, "    %s 1;\n", cidr)
+	}
+	b.WriteString("}\n\n")
+}
+
+// nginxConfigHash returns a short checksum of the generated nginx configuration.
+func nginxConfigHash(webapp *webappv1.WebApp) string {
+	sum := sha256.Sum256([]byte(nginxConfigForWebApp(webapp)))
+	return hex.EncodeToString(sum[:8])
+}
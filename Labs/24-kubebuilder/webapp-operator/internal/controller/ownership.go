@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+// nameConflictRequeue is how often a WebApp blocked by a name conflict checks
+// again, since the conflicting resources are not watched.
+const nameConflictRequeue = time.Minute
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileOwnership checks that the resources named like the WebApp's children
+// are missing or controlled by the WebApp, so the later steps never write to
+// someone else's object. With adoptionPolicy Adopt, unowned resources are taken
+// over. It reports the conflicts left in the NameConflict condition and
+// returns whether there are any.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileOwnership(ctx context.Context, webapp *webappv1.WebApp) (bool, error) {
+	var conflicts []string
+	for _, child := range childrenForStrategy(webapp) {
+		conflict, err := r.claim(ctx, webapp, child)
+		if err != nil {
+			return false, err
+		}
+		if conflict != "" {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return false, r.removeCondition(ctx, webapp, webappv1.ConditionTypeNameConflict)
+	}
+	message := strings.Join(conflicts, "; ")
+	if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeNameConflict); cond == nil || cond.Message != message {
+		log.FromContext(ctx).Info("Children's names are taken", "name", webapp.Name, "conflicts", conflicts)
+		r.event(webapp, corev1.EventTypeWarning, "NameConflict", message)
+	}
+	return true, r.setCondition(ctx, webapp, webappv1.ConditionTypeNameConflict, metav1.ConditionTrue, "NameConflict", message)
+}
+
+// claim makes sure the existing resource with the child's name, if any, is
+// controlled by the WebApp, adopting it when the policy allows. It returns a
+// description of the conflict when the resource belongs to someone else.
+func (r *WebAppReconciler) claim(ctx context.Context, webapp *webappv1.WebApp, child client.Object) (string, error) {
+	err := r.Get(ctx, types.NamespacedName{Name: child.GetName(), Namespace: child.GetNamespace()}, child)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if metav1.IsControlledBy(child, webapp) {
+		return "", nil
+	}
+
+	kind := childKind(child)
+	if owner := metav1.GetControllerOf(child); owner != nil {
+		return fmt.Sprintf("%s %s is controlled by %s %s", kind, child.GetName(), owner.Kind, owner.Name), nil
+	}
+	if webapp.Spec.AdoptionPolicy != webappv1.AdoptionPolicyAdopt {
+		return fmt.Sprintf("%s %s exists and is not owned by the WebApp; set spec.adoptionPolicy to Adopt to take it over",
+			kind, child.GetName()), nil
+	}
+
+	if err := ctrl.SetControllerReference(webapp, child, r.Scheme); err != nil {
+		return "", err
+	}
+	labels := child.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[managedByLabel] = "webapp-operator"
+	child.SetLabels(labels)
+
+	log.FromContext(ctx).Info("Adopting existing resource", "kind", kind, "name", child.GetName())
+	if err := r.Update(ctx, child); err != nil {
+		return "", err
+	}
+	r.event(webapp, corev1.EventTypeNormal, "Adopted", fmt.Sprintf("took ownership of existing %s %s", kind, child.GetName()))
+	return "", nil
+}
+
+// childrenForStrategy lists the (empty) Services, Deployments and ConfigMaps
+// the WebApp's rollout strategy writes, and the claims the operator creates.
+func childrenForStrategy(webapp *webappv1.WebApp) []client.Object {
+	var children []client.Object
+	switch rolloutStrategy(webapp) {
+	case webappv1.RolloutStrategyBlueGreen:
+		children = namedChildren(webapp,
+			[]string{webapp.Name, webapp.Name + "-preview"},
+			[]string{colorDeploymentName(webapp, colorBlue), colorDeploymentName(webapp, colorGreen)})
+	case webappv1.RolloutStrategyCanary:
+		children = namedChildren(webapp,
+			[]string{webapp.Name},
+			[]string{webapp.Name, webapp.Name + "-" + trackCanary})
+	default:
+		children = namedChildren(webapp, []string{webapp.Name}, []string{webapp.Name})
+	}
+	if webapp.Spec.Maintenance != nil {
+		children = append(children, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: maintenanceConfigMapName(webapp), Namespace: webapp.Namespace}})
+	}
+	return append(children, claimsForWebApp(webapp)...)
+}
+
+// childKind returns the kind of a typed child, whose TypeMeta is usually empty.
+func childKind(child client.Object) string {
+	name := fmt.Sprintf("%T", child)
+	return name[strings.LastIndex(name, ".")+1:]
+}
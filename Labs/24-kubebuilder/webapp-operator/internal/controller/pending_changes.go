@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+const (
+	pendingCreate = "Create"
+	pendingUpdate = "Update"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reportPendingChanges records, while the WebApp is paused, which fields of its
+// ConfigMaps, Deployment, and Service resuming would change, and sets the
+// Paused condition. Nothing but the WebApp status is written.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reportPendingChanges(ctx context.Context, webapp *webappv1.WebApp) error {
+	changes, err := r.pendingChanges(ctx, webapp)
+	if err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(webapp.Status.PendingChanges, changes) {
+		webapp.Status.PendingChanges = changes
+		if err := r.persistStatus(ctx, webapp); err != nil {
+			return err
+		}
+	}
+
+	message := "reconciliation is paused; resuming changes nothing"
+	if len(changes) > 0 {
+		message = fmt.Sprintf("reconciliation is paused; resuming changes %d resources, see status.pendingChanges", len(changes))
+	}
+	return r.setCondition(ctx, webapp, webappv1.ConditionTypePaused, metav1.ConditionTrue, "Paused", message)
+}
+
+// clearPendingChanges drops the pending changes and the Paused condition once the WebApp is resumed.
+func (r *WebAppReconciler) clearPendingChanges(ctx context.Context, webapp *webappv1.WebApp) error {
+	if len(webapp.Status.PendingChanges) > 0 {
+		webapp.Status.PendingChanges = nil
+		if err := r.persistStatus(ctx, webapp); err != nil {
+			return err
+		}
+	}
+	return r.removeCondition(ctx, webapp, webappv1.ConditionTypePaused)
+}
+
+// pendingChanges summarizes the differences between the desired and live children.
+func (r *WebAppReconciler) pendingChanges(ctx context.Context, webapp *webappv1.WebApp) ([]webappv1.PendingChange, error) {
+	// Markdown read from a ConfigMap is compared as it is now; while it is
+	// missing, the page resuming would render is not known yet
+	desired, err := r.resolveMarkdown(ctx, webapp)
+	if stderrors.Is(err, errMarkdownNotFound) {
+		desired = webapp
+	} else if err != nil {
+		return nil, err
+	}
+	diffs, err := r.childDiffs(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	var changes []webappv1.PendingChange
+	for _, d := range diffs {
+		if d.live == nil {
+			changes = append(changes, webappv1.PendingChange{Kind: d.kind, Name: d.name, Action: pendingCreate})
+		} else {
+			changes = append(changes, webappv1.PendingChange{Kind: d.kind, Name: d.name, Action: pendingUpdate, Fields: d.fields})
+		}
+	}
+	return changes, nil
+}
+
+// childDiff is a child resource that differs from its desired state.
+type childDiff struct {
+	kind, name string
+	// live is the child as stored, or nil if it is missing.
+	live client.Object
+	// fields lists the changed fields, as "path: old -> new".
+	fields []string
+}
+
+// childDiffs compares the desired children with the live ones. BlueGreen and
+// Canary are compared against the Deployment currently serving traffic.
+func (r *WebAppReconciler) childDiffs(ctx context.Context, webapp *webappv1.WebApp) ([]childDiff, error) {
+	// Resuming serves the commit last resolved from the git source
+	webapp = withPinnedCommit(webapp)
+	name, selector := webapp.Name, stableLabels(webapp)
+	if rolloutStrategy(webapp) == webappv1.RolloutStrategyBlueGreen && webapp.Status.Rollout != nil && webapp.Status.Rollout.ActiveColor != "" {
+		name, selector = colorDeploymentName(webapp, webapp.Status.Rollout.ActiveColor), colorLabels(webapp, webapp.Status.Rollout.ActiveColor)
+	}
+
+	var diffs []childDiff
+	add := func(kind, childName string, live client.Object, exists bool, fields []string) {
+		switch {
+		case !exists:
+			diffs = append(diffs, childDiff{kind: kind, name: childName})
+		case len(fields) > 0:
+			diffs = append(diffs, childDiff{kind: kind, name: childName, live: live, fields: fields})
+		}
+	}
+
+	for _, desired := range []*corev1.ConfigMap{
+		htmlConfigMapForWebApp(webapp, name+"-html"),
+		nginxConfigMapForWebApp(webapp, name+"-nginx"),
+	} {
+		existing := &corev1.ConfigMap{}
+		exists, err := r.getChild(ctx, desired.Namespace, desired.Name, existing)
+		if err != nil {
+			return nil, err
+		}
+		add("ConfigMap", desired.Name, existing, exists, configMapChanges(desired, existing))
+	}
+
+	desiredDep := deploymentForWebApp(webapp, name, selector, webapp.Spec.Replicas)
+	existingDep := &appsv1.Deployment{}
+	exists, err := r.getChild(ctx, webapp.Namespace, name, existingDep)
+	if err != nil {
+		return nil, err
+	}
+	add("Deployment", name, existingDep, exists, deploymentChanges(desiredDep, existingDep))
+
+	desiredSvc := serviceForWebApp(webapp, webapp.Name, corev1.ServiceType(webapp.Spec.ServiceType), serviceSelectorForWebApp(webapp))
+	existingSvc := &corev1.Service{}
+	exists, err = r.getChild(ctx, webapp.Namespace, webapp.Name, existingSvc)
+	if err != nil {
+		return nil, err
+	}
+	add("Service", webapp.Name, existingSvc, exists, serviceChanges(desiredSvc, existingSvc))
+
+	return diffs, nil
+}
+
+// getChild reads the named child into obj, reporting whether it exists.
+func (r *WebAppReconciler) getChild(ctx context.Context, namespace, name string, obj client.Object) (bool, error) {
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// configMapChanges lists the data keys that differ. Values are left out, since
+// they hold whole pages.
+func configMapChanges(desired, existing *corev1.ConfigMap) []string {
+	var fields []string
+	for key, value := range desired.Data {
+		old, ok := existing.Data[key]
+		switch {
+		case !ok:
+			fields = append(fields, fmt.Sprintf("data[%s]: added", key))
+		case old != value:
+			fields = append(fields, fmt.Sprintf("data[%s]: changed", key))
+		}
+	}
+	for key := range existing.Data {
+		if _, ok := desired.Data[key]; !ok {
+			fields = append(fields, fmt.Sprintf("data[%s]: removed", key))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// deploymentChanges lists the replica and pod template fields applyDeployment would update.
+func deploymentChanges(desired, existing *appsv1.Deployment) []string {
+	var fields []string
+	if existing.Spec.Replicas == nil || *existing.Spec.Replicas != *desired.Spec.Replicas {
+		fields = append(fields, fieldChange("spec.replicas", derefInt32(existing.Spec.Replicas), *desired.Spec.Replicas))
+	}
+	if !podTemplateChanged(&desired.Spec.Template, &existing.Spec.Template) {
+		return fields
+	}
+	detailed := len(fields)
+	want, got := desired.Spec.Template, existing.Spec.Template
+
+	for _, c := range want.Spec.Containers {
+		path := fmt.Sprintf("spec.template.spec.containers[%s]", c.Name)
+		old := findContainer(got.Spec.Containers, c.Name)
+		switch {
+		case old == nil:
+			fields = append(fields, path+": added")
+		case old.Image != c.Image:
+			fields = append(fields, fieldChange(path+".image", old.Image, c.Image))
+		case !equality.Semantic.DeepDerivative(c, *old):
+			fields = append(fields, path+": changed")
+		}
+	}
+	for _, c := range got.Spec.Containers {
+		if findContainer(want.Spec.Containers, c.Name) == nil {
+			fields = append(fields, fmt.Sprintf("spec.template.spec.containers[%s]: removed", c.Name))
+		}
+	}
+
+	keys := make([]string, 0, len(want.Annotations))
+	for key := range want.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if old := got.Annotations[key]; old != want.Annotations[key] {
+			fields = append(fields, fieldChange(fmt.Sprintf("spec.template.metadata.annotations[%s]", key), old, want.Annotations[key]))
+		}
+	}
+
+	if len(want.Spec.Volumes) != len(got.Spec.Volumes) ||
+		!equality.Semantic.DeepDerivative(want.Spec.Volumes, got.Spec.Volumes) {
+		fields = append(fields, "spec.template.spec.volumes: changed")
+	}
+
+	// Anything else the template comparison caught
+	if len(fields) == detailed {
+		fields = append(fields, "spec.template: changed")
+	}
+	return fields
+}
+
+// serviceChanges lists the type, port, and selector fields applyService would update.
+func serviceChanges(desired, existing *corev1.Service) []string {
+	var fields []string
+	if existing.Spec.Type != desired.Spec.Type {
+		fields = append(fields, fieldChange("spec.type", existing.Spec.Type, desired.Spec.Type))
+	}
+	if servicePortsChanged(desired.Spec.Ports, existing.Spec.Ports) {
+		for _, p := range desired.Spec.Ports {
+			path := fmt.Sprintf("spec.ports[%s]", p.Name)
+			old := findServicePort(existing.Spec.Ports, p.Name)
+			switch {
+			case old == nil:
+				fields = append(fields, path+": added")
+			case old.Port != p.Port:
+				fields = append(fields, fieldChange(path+".port", old.Port, p.Port))
+			case old.TargetPort != p.TargetPort:
+				fields = append(fields, fieldChange(path+".targetPort", old.TargetPort.String(), p.TargetPort.String()))
+			case old.Protocol != p.Protocol:
+				fields = append(fields, fieldChange(path+".protocol", old.Protocol, p.Protocol))
+			}
+		}
+		for _, p := range existing.Spec.Ports {
+			if findServicePort(desired.Spec.Ports, p.Name) == nil {
+				fields = append(fields, fmt.Sprintf("spec.ports[%s]: removed", p.Name))
+			}
+		}
+	}
+	if !equality.Semantic.DeepEqual(desired.Spec.Selector, existing.Spec.Selector) {
+		fields = append(fields, fieldChange("spec.selector",
+			labels.Set(existing.Spec.Selector).String(), labels.Set(desired.Spec.Selector).String()))
+	}
+	return fields
+}
+
+// fieldChange formats a changed field as "path: old -> new".
+func fieldChange(path string, old, desired any) string {
+	return fmt.Sprintf("%s: %v -> %v", path, old, desired)
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func findServicePort(ports []corev1.ServicePort, name string) *corev1.ServicePort {
+	for i := range ports {
+		if ports[i].Name == name {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+func derefInt32(p *int32) int32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// revisionLabel links a ControllerRevision to the WebApp it snapshots.
+	revisionLabel = "apps.codewizard.io/webapp"
+	// defaultRevisionHistoryLimit applies when spec.revisionHistoryLimit is not set.
+	defaultRevisionHistoryLimit = 10
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileRevision records the applied spec as an immutable ControllerRevision
+// and prunes old revisions beyond spec.revisionHistoryLimit, together with the
+// uploads only they referred to. It returns the current revision number.
+// Re-applying an older spec (e.g. after a rollback) renumbers its revision as
+// the newest, the way Deployments do.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileRevision(ctx context.Context, webapp *webappv1.WebApp) (_ int64, err error) {
+	defer metrics.ObserveStep(metrics.StepRevision, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileRevision", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	name, data, err := revisionFor(webapp)
+	if err != nil {
+		return 0, err
+	}
+
+	revisions, err := r.listRevisions(ctx, webapp)
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	var current *appsv1.ControllerRevision
+	for i := range revisions {
+		latest = max(latest, revisions[i].Revision)
+		if revisions[i].Name == name {
+			current = &revisions[i]
+		}
+	}
+
+	switch {
+	case current == nil:
+		current = &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: webapp.Namespace,
+				Labels:    revisionLabels(webapp),
+			},
+			Data:     runtime.RawExtension{Raw: data},
+			Revision: latest + 1,
+		}
+		if err := ctrl.SetControllerReference(webapp, current, r.Scheme); err != nil {
+			return 0, err
+		}
+		logger.Info("Recording revision", "name", name, "revision", current.Revision)
+		if err := r.Create(ctx, current); err != nil {
+			return 0, err
+		}
+		revisions = append(revisions, *current)
+	case current.Revision != latest:
+		current.Revision = latest + 1
+		logger.Info("Renumbering revision", "name", name, "revision", current.Revision)
+		if err := r.Update(ctx, current); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := r.pruneRevisions(ctx, webapp, revisions, name); err != nil {
+		return 0, err
+	}
+	return current.Revision, r.pruneUploadChunks(ctx, webapp)
+}
+
+// recordRevision records the applied spec once the Deployment has rolled it out,
+// and returns the current revision number. Until then the revision recorded
+// last stays current, so a rollout that never completes is never recorded.
+func (r *WebAppReconciler) recordRevision(ctx context.Context, webapp, applied *webappv1.WebApp, deployment *appsv1.Deployment) (int64, error) {
+	if !rolloutComplete(webapp, deployment) {
+		return webapp.Status.CurrentRevision, nil
+	}
+	recorded := webapp.DeepCopy()
+	recorded.Spec = applied.Spec
+	return r.reconcileRevision(ctx, recorded)
+}
+
+// revisionFor returns the name and data of the revision recording the WebApp's
+// current spec. The name is derived from the data, so equal specs share a revision.
+func revisionFor(webapp *webappv1.WebApp) (string, []byte, error) {
+	data, err := json.Marshal(versionedSpec(webapp.Spec))
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s-%s", webapp.Name, hex.EncodeToString(sum[:5])), data, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the history limit. The
+// current revision is never pruned and does not count towards the limit.
+func (r *WebAppReconciler) pruneRevisions(ctx context.Context, webapp *webappv1.WebApp, revisions []appsv1.ControllerRevision, current string) error {
+	limit := defaultRevisionHistoryLimit
+	if webapp.Spec.RevisionHistoryLimit != nil {
+		limit = int(*webapp.Spec.RevisionHistoryLimit)
+	}
+
+	var old []appsv1.ControllerRevision
+	for _, rev := range revisions {
+		if rev.Name != current {
+			old = append(old, rev)
+		}
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].Revision < old[j].Revision })
+
+	for i := 0; i < len(old)-limit; i++ {
+		log.FromContext(ctx).Info("Pruning revision", "name", old[i].Name, "revision", old[i].Revision)
+		if err := r.Delete(ctx, &old[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// rollback restores the spec recorded in the revision requested through
+// spec.rollbackTo or the rollback-to annotation, and clears the request. It
+// reports whether the WebApp was updated.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) rollback(ctx context.Context, webapp *webappv1.WebApp) (bool, error) {
+	target, requested, parseErr := rollbackTarget(webapp)
+	if !requested {
+		return false, nil
+	}
+
+	// The request is served once, whether or not it succeeds
+	webapp.Spec.RollbackTo = nil
+	delete(webapp.Annotations, webappv1.AnnotationRollbackTo)
+
+	if parseErr != nil {
+		r.event(webapp, corev1.EventTypeWarning, "RollbackFailed", parseErr.Error())
+		return true, r.Update(ctx, webapp)
+	}
+
+	revisions, err := r.listRevisions(ctx, webapp)
+	if err != nil {
+		return false, err
+	}
+	var revision *appsv1.ControllerRevision
+	for i := range revisions {
+		if revisions[i].Revision == target {
+			revision = &revisions[i]
+		}
+	}
+	if revision == nil {
+		r.event(webapp, corev1.EventTypeWarning, "RollbackFailed", fmt.Sprintf("revision %d not found", target))
+		return true, r.Update(ctx, webapp)
+	}
+
+	var snapshot webappv1.WebAppSpec
+	if err := json.Unmarshal(revision.Data.Raw, &snapshot); err != nil {
+		return false, fmt.Errorf("decoding revision %d: %w", target, err)
+	}
+	webapp.Spec = withUnversioned(snapshot, webapp.Spec)
+
+	log.FromContext(ctx).Info("Rolling back", "name", webapp.Name, "revision", target)
+	r.event(webapp, corev1.EventTypeNormal, "RolledBack", fmt.Sprintf("restored revision %d", target))
+	return true, r.Update(ctx, webapp)
+}
+
+// rollbackTarget returns the requested rollback revision. spec.rollbackTo wins
+// over the annotation.
+func rollbackTarget(webapp *webappv1.WebApp) (int64, bool, error) {
+	if webapp.Spec.RollbackTo != nil {
+		return *webapp.Spec.RollbackTo, true, nil
+	}
+	value, ok := webapp.Annotations[webappv1.AnnotationRollbackTo]
+	if !ok {
+		return 0, false, nil
+	}
+	target, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("annotation %s: %q is not a revision number", webappv1.AnnotationRollbackTo, value)
+	}
+	return target, true, nil
+}
+
+// listRevisions returns the WebApp's revisions, oldest first.
+func (r *WebAppReconciler) listRevisions(ctx context.Context, webapp *webappv1.WebApp) ([]appsv1.ControllerRevision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	if err := r.List(ctx, list,
+		client.InNamespace(webapp.Namespace),
+		client.MatchingLabels{revisionLabel: webapp.Name}); err != nil {
+		return nil, err
+	}
+
+	var revisions []appsv1.ControllerRevision
+	for _, rev := range list.Items {
+		if metav1.IsControlledBy(&rev, webapp) {
+			revisions = append(revisions, rev)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// revisionLabels returns the labels of the WebApp's ControllerRevisions.
+func revisionLabels(webapp *webappv1.WebApp) map[string]string {
+	labels := labelsForWebApp(webapp.Name)
+	labels[revisionLabel] = webapp.Name
+	return labels
+}
+
+// versionedSpec returns the part of the spec a revision records: what is served
+// and how. Scaling, exposure, maintenance, rollout and lifecycle settings are
+// left out, so a rollback never undoes them.
+func versionedSpec(spec webappv1.WebAppSpec) webappv1.WebAppSpec {
+	return withUnversioned(spec, webappv1.WebAppSpec{})
+}
+
+// withUnversioned returns spec with every field not recorded in revisions taken from from.
+func withUnversioned(spec, from webappv1.WebAppSpec) webappv1.WebAppSpec {
+	spec.Replicas = from.Replicas
+	spec.ServiceType = from.ServiceType
+	spec.Paused = from.Paused
+	spec.MaxUnavailable = from.MaxUnavailable
+	spec.Maintenance = from.Maintenance
+	spec.Monitoring = from.Monitoring
+	spec.DeletionPolicy = from.DeletionPolicy
+	spec.DriftPolicy = from.DriftPolicy
+	spec.AdoptionPolicy = from.AdoptionPolicy
+	spec.Rollout = from.Rollout
+	spec.RevisionHistoryLimit = from.RevisionHistoryLimit
+	spec.RollbackTo = from.RollbackTo
+	return spec
+}
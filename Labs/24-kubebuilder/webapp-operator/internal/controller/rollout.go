@@ -0,0 +1,376 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+
+	// colorLabel selects the Pods of one BlueGreen color.
+	colorLabel = "apps.codewizard.io/color"
+	// rolloutHashAnnotation records, on the pod template, which version of the WebApp it runs.
+	rolloutHashAnnotation = "apps.codewizard.io/rollout-hash"
+
+	// defaultScaleDownDelay applies when spec.rollout.blueGreen is not set.
+	defaultScaleDownDelay = 30 * time.Second
+)
+
+// rolloutStrategy returns the WebApp's rollout strategy, defaulting to RollingUpdate.
+func rolloutStrategy(webapp *webappv1.WebApp) webappv1.RolloutStrategy {
+	if webapp.Spec.Rollout == nil || webapp.Spec.Rollout.Strategy == "" {
+		return webappv1.RolloutStrategyRollingUpdate
+	}
+	return webapp.Spec.Rollout.Strategy
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileWorkloads runs the Deployment step of the selected rollout strategy.
+// It returns the Deployment currently serving traffic and, when the strategy is
+// waiting on a timer, how soon the WebApp must be reconciled again.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileWorkloads(ctx context.Context, webapp *webappv1.WebApp) (*appsv1.Deployment, time.Duration, error) {
+	switch rolloutStrategy(webapp) {
+	case webappv1.RolloutStrategyBlueGreen:
+		return r.reconcileBlueGreen(ctx, webapp)
+	case webappv1.RolloutStrategyCanary:
+		return r.reconcileCanary(ctx, webapp)
+	}
+
+	deployment, err := r.reconcileDeployment(ctx, webapp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Retire colored or canary Deployments left over from another strategy once
+	// the single Deployment can take all the traffic
+	if webapp.Status.Rollout != nil && deploymentReady(deployment) {
+		if err := r.deleteStaleWorkloads(ctx, webapp, deployment.Name); err != nil {
+			return nil, 0, err
+		}
+		if err := r.setRolloutStatus(ctx, webapp, nil); err != nil {
+			return nil, 0, err
+		}
+	}
+	return deployment, 0, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileBlueGreen drives a BlueGreen rollout across the "<name>-blue" and
+// "<name>-green" Deployments. A new version is brought up on the preview color;
+// once it is fully ready, status.rollout.activeColor flips and reconcileService
+// switches the Service selector in a single update. The old color keeps running
+// for the scale-down delay, then is scaled to zero.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileBlueGreen(ctx context.Context, webapp *webappv1.WebApp) (_ *appsv1.Deployment, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepDeployment, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileBlueGreen", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	status := webappv1.RolloutStatus{}
+	if prev := webapp.Status.Rollout; prev != nil {
+		// Only the BlueGreen fields carry over from another strategy
+		status = webappv1.RolloutStatus{
+			ActiveColor:  prev.ActiveColor,
+			PreviewColor: prev.PreviewColor,
+			ScaleDownAt:  prev.ScaleDownAt,
+		}
+	}
+	status.PreviewServiceName = webapp.Name + "-preview"
+	hash := rolloutHash(webapp)
+	active := status.ActiveColor
+
+	var activeDep *appsv1.Deployment
+	if active != "" {
+		if activeDep, err = r.getDeployment(ctx, webapp, colorDeploymentName(webapp, active)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// ── Steady state: the active color already runs this version (or was deleted
+	// and is simply recreated) - keep it scaled, and retire the old color
+	if active != "" && (activeDep == nil || activeDep.Spec.Template.Annotations[rolloutHashAnnotation] == hash) {
+		dep, err := r.applyColor(ctx, webapp, active, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		requeueAfter, err := r.scaleDownPreview(ctx, webapp, &status)
+		if err != nil {
+			return nil, 0, err
+		}
+		if deploymentReady(dep) {
+			// Drop the single Deployment of a previous RollingUpdate strategy
+			if err := r.deleteStaleWorkloads(ctx, webapp,
+				colorDeploymentName(webapp, colorBlue), colorDeploymentName(webapp, colorGreen)); err != nil {
+				return nil, 0, err
+			}
+		}
+		return dep, requeueAfter, r.setRolloutStatus(ctx, webapp, &status)
+	}
+
+	// The active color keeps serving during the rollout, so a restart reaches it directly
+	if err := r.restartDeployment(ctx, webapp, activeDep); err != nil {
+		return nil, 0, err
+	}
+
+	// ── A new version: bring it up on the preview color (blue for the first rollout)
+	target := colorBlue
+	if active != "" {
+		target = otherColor(active)
+	}
+	status.PreviewColor = target
+	previewDep, err := r.applyColor(ctx, webapp, target, hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !deploymentReady(previewDep) {
+		logger.Info("Waiting for preview color to become ready", "name", webapp.Name, "color", target)
+		if activeDep == nil {
+			activeDep = previewDep
+		}
+		// The Deployment watch re-triggers reconciliation as the Pods become ready
+		return activeDep, 0, r.setRolloutStatus(ctx, webapp, &status)
+	}
+
+	// ── Switch: the Service selector follows status.rollout.activeColor
+	logger.Info("Switching traffic", "name", webapp.Name, "from", active, "to", target)
+	status.ActiveColor = target
+	status.PreviewColor = otherColor(target)
+	status.ScaleDownAt = nil
+	var requeueAfter time.Duration
+	if active != "" {
+		requeueAfter = scaleDownDelay(webapp)
+		scaleDownAt := metav1.NewTime(time.Now().Add(requeueAfter))
+		status.ScaleDownAt = &scaleDownAt
+	}
+	if err := r.setRolloutStatus(ctx, webapp, &status); err != nil {
+		return nil, 0, err
+	}
+	r.event(webapp, corev1.EventTypeNormal, "TrafficSwitched",
+		fmt.Sprintf("Service %s now targets the %s color", webapp.Name, target))
+	return previewDep, requeueAfter, nil
+}
+
+// applyColor writes the ConfigMaps and the Deployment of one color with the
+// current spec, at the full replica count.
+func (r *WebAppReconciler) applyColor(ctx context.Context, webapp *webappv1.WebApp, color, hash string) (*appsv1.Deployment, error) {
+	name := colorDeploymentName(webapp, color)
+	if err := r.applyContent(ctx, webapp, name); err != nil {
+		return nil, err
+	}
+	desired := deploymentForWebApp(webapp, name, colorLabels(webapp, color), webapp.Spec.Replicas)
+	desired.Spec.Template.Annotations[rolloutHashAnnotation] = hash
+	return r.applyDeployment(ctx, webapp, desired)
+}
+
+// restartDeployment stamps the restart requested with AnnotationRestartedAt on a
+// live Deployment the rollout otherwise leaves alone, such as the active color
+// while another one comes up, which restarts its Pods in place.
+func (r *WebAppReconciler) restartDeployment(ctx context.Context, webapp *webappv1.WebApp, dep *appsv1.Deployment) error {
+	restartedAt, ok := webapp.Annotations[webappv1.AnnotationRestartedAt]
+	if !ok || dep == nil || dep.Spec.Template.Annotations[webappv1.AnnotationRestartedAt] == restartedAt {
+		return nil
+	}
+	log.FromContext(ctx).Info("Restarting Deployment", "name", dep.Name, "restartedAt", restartedAt)
+	if dep.Spec.Template.Annotations == nil {
+		dep.Spec.Template.Annotations = map[string]string{}
+	}
+	dep.Spec.Template.Annotations[webappv1.AnnotationRestartedAt] = restartedAt
+	return r.Update(ctx, dep)
+}
+
+// scaleDownPreview scales the standby color to zero once its scale-down delay
+// has passed. It returns how long is left to wait, if anything.
+func (r *WebAppReconciler) scaleDownPreview(ctx context.Context, webapp *webappv1.WebApp, status *webappv1.RolloutStatus) (time.Duration, error) {
+	if status.ScaleDownAt != nil {
+		if remaining := time.Until(status.ScaleDownAt.Time); remaining > 0 {
+			return remaining, nil
+		}
+	}
+
+	preview, err := r.getDeployment(ctx, webapp, colorDeploymentName(webapp, status.PreviewColor))
+	if err != nil {
+		return 0, err
+	}
+	if preview != nil && preview.Spec.Replicas != nil && *preview.Spec.Replicas != 0 {
+		log.FromContext(ctx).Info("Scaling down previous color", "name", preview.Name)
+		zero := int32(0)
+		preview.Spec.Replicas = &zero
+		if err := r.Update(ctx, preview); err != nil {
+			return 0, err
+		}
+	}
+	status.ScaleDownAt = nil
+	return 0, nil
+}
+
+// reconcilePreviewService keeps "<name>-preview" pointed at the BlueGreen preview
+// color, and removes it when the WebApp uses another strategy.
+func (r *WebAppReconciler) reconcilePreviewService(ctx context.Context, webapp *webappv1.WebApp) error {
+	name := webapp.Name + "-preview"
+
+	if rolloutStrategy(webapp) != webappv1.RolloutStrategyBlueGreen {
+		existing := &corev1.Service{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, existing)
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !metav1.IsControlledBy(existing, webapp) {
+			return nil
+		}
+		log.FromContext(ctx).Info("Deleting preview Service", "name", name)
+		return client.IgnoreNotFound(r.Delete(ctx, existing))
+	}
+
+	preview := colorBlue
+	if webapp.Status.Rollout != nil && webapp.Status.Rollout.PreviewColor != "" {
+		preview = webapp.Status.Rollout.PreviewColor
+	}
+	desired := serviceForWebApp(webapp, name, corev1.ServiceTypeClusterIP, colorLabels(webapp, preview))
+	return r.applyService(ctx, webapp, desired)
+}
+
+// serviceSelectorForWebApp returns the main Service selector: every WebApp Pod,
+// or only the active color once a BlueGreen rollout has picked one.
+func serviceSelectorForWebApp(webapp *webappv1.WebApp) map[string]string {
+	if rolloutStrategy(webapp) == webappv1.RolloutStrategyBlueGreen &&
+		webapp.Status.Rollout != nil && webapp.Status.Rollout.ActiveColor != "" {
+		return colorLabels(webapp, webapp.Status.Rollout.ActiveColor)
+	}
+	return labelsForWebApp(webapp.Name)
+}
+
+// setRolloutStatus persists status.rollout when it changed. It is written right
+// away, because the Service selector of the next step is derived from it.
+func (r *WebAppReconciler) setRolloutStatus(ctx context.Context, webapp *webappv1.WebApp, status *webappv1.RolloutStatus) error {
+	if equality.Semantic.DeepEqual(webapp.Status.Rollout, status) {
+		return nil
+	}
+	webapp.Status.Rollout = status
+	return r.persistStatus(ctx, webapp)
+}
+
+// deleteStaleWorkloads removes the WebApp's Deployments, and the ConfigMaps they
+// mount, except the named ones. It cleans up after a rollout strategy change.
+func (r *WebAppReconciler) deleteStaleWorkloads(ctx context.Context, webapp *webappv1.WebApp, keep ...string) error {
+	logger := log.FromContext(ctx)
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments,
+		client.InNamespace(webapp.Namespace),
+		client.MatchingLabels{"app.kubernetes.io/instance": webapp.Name}); err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		dep := &deployments.Items[i]
+		if slices.Contains(keep, dep.Name) || !metav1.IsControlledBy(dep, webapp) {
+			continue
+		}
+		logger.Info("Deleting stale Deployment", "name", dep.Name)
+		if err := r.Delete(ctx, dep); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		for _, suffix := range []string{"-html", "-nginx"} {
+			cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: dep.Name + suffix, Namespace: webapp.Namespace}}
+			if err := r.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getDeployment returns the named Deployment, or nil if it does not exist.
+func (r *WebAppReconciler) getDeployment(ctx context.Context, webapp *webappv1.WebApp, name string) (*appsv1.Deployment, error) {
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, dep)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+// deploymentReady reports whether every desired replica runs the latest template and is available.
+func deploymentReady(dep *appsv1.Deployment) bool {
+	if dep == nil || dep.Spec.Replicas == nil {
+		return false
+	}
+	want := *dep.Spec.Replicas
+	return dep.Status.ObservedGeneration >= dep.Generation &&
+		dep.Status.Replicas == want &&
+		dep.Status.UpdatedReplicas == want &&
+		dep.Status.ReadyReplicas == want &&
+		dep.Status.AvailableReplicas == want
+}
+
+// rolloutHash fingerprints everything a new color has to pick up: the pod
+// template and the content of both ConfigMaps. The replica count is excluded,
+// so scaling never triggers a rollout, and so is the restart timestamp, which
+// restartDeployment rolls onto the live Deployments in place.
+func rolloutHash(webapp *webappv1.WebApp) string {
+	h := sha256.New()
+	template := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 0).Spec.Template
+	delete(template.Annotations, webappv1.AnnotationRestartedAt)
+	for _, v := range []interface{}{
+		template,
+		htmlConfigMapForWebApp(webapp, "").Data,
+		nginxConfigMapForWebApp(webapp, "").Data,
+	} {
+		// json.Marshal sorts map keys, so the encoding is stable
+		b, _ := json.Marshal(v)
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// scaleDownDelay returns how long the previous color is kept after a switch.
+func scaleDownDelay(webapp *webappv1.WebApp) time.Duration {
+	if webapp.Spec.Rollout == nil || webapp.Spec.Rollout.BlueGreen == nil {
+		return defaultScaleDownDelay
+	}
+	return time.Duration(webapp.Spec.Rollout.BlueGreen.ScaleDownDelaySeconds) * time.Second
+}
+
+// colorDeploymentName returns the name of the Deployment running the given color.
+func colorDeploymentName(webapp *webappv1.WebApp, color string) string {
+	return webapp.Name + "-" + color
+}
+
+// colorLabels returns the selector labels of the given color's Pods.
+func colorLabels(webapp *webappv1.WebApp, color string) map[string]string {
+	labels := labelsForWebApp(webapp.Name)
+	labels[colorLabel] = color
+	return labels
+}
+
+// otherColor returns the color that is not c.
+func otherColor(c string) string {
+	if c == colorBlue {
+		return colorGreen
+	}
+	return colorBlue
+}
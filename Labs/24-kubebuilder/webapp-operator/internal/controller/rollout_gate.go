@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/pkg/schedule"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// gateRollout holds a new revision back while no rollout window is open or the
+// spec is not approved. It returns the WebApp to reconcile the children from -
+// carrying the spec of the last applied revision while held - and, when held by
+// a window, how long until the next one opens. Scaling and other unversioned
+// fields are never held.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) gateRollout(ctx context.Context, webapp *webappv1.WebApp) (*webappv1.WebApp, time.Duration, error) {
+	rollout := webapp.Spec.Rollout
+	if rollout == nil || (len(rollout.Windows) == 0 && !rollout.RequireApproval) {
+		return webapp, 0, r.removeCondition(ctx, webapp, webappv1.ConditionTypeRolloutBlocked)
+	}
+
+	name, _, err := revisionFor(webapp)
+	if err != nil {
+		return nil, 0, err
+	}
+	revisions, err := r.listRevisions(ctx, webapp)
+	if err != nil {
+		return nil, 0, err
+	}
+	// The newest revision is the one applied last; a new WebApp has nothing to hold
+	if len(revisions) == 0 || revisions[len(revisions)-1].Name == name {
+		return webapp, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeRolloutBlocked,
+			metav1.ConditionFalse, "NoPendingChanges", "the applied revision matches the spec")
+	}
+	applied := revisions[len(revisions)-1]
+
+	reason, message, requeueAfter := rolloutBlockReason(webapp, time.Now())
+	if reason == "" {
+		return webapp, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeRolloutBlocked,
+			metav1.ConditionFalse, "RolloutAllowed", "the new revision is rolling out")
+	}
+
+	log.FromContext(ctx).Info("Holding rollout", "name", webapp.Name, "reason", reason, "revision", applied.Revision)
+	if err := r.setCondition(ctx, webapp, webappv1.ConditionTypeRolloutBlocked, metav1.ConditionTrue, reason, message); err != nil {
+		return nil, 0, err
+	}
+
+	var snapshot webappv1.WebAppSpec
+	if err := json.Unmarshal(applied.Data.Raw, &snapshot); err != nil {
+		return nil, 0, fmt.Errorf("decoding revision %d: %w", applied.Revision, err)
+	}
+	held := webapp.DeepCopy()
+	held.Spec = withUnversioned(snapshot, webapp.Spec)
+	return held, requeueAfter, nil
+}
+
+// rolloutBlockReason returns why a new revision may not roll out at now, or ""
+// if it may. For a closed window it also returns the time until the next opening.
+func rolloutBlockReason(webapp *webappv1.WebApp, now time.Time) (string, string, time.Duration) {
+	rollout := webapp.Spec.Rollout
+
+	generation := strconv.FormatInt(webapp.Generation, 10)
+	if rollout.RequireApproval && webapp.Annotations[webappv1.AnnotationApprovedGeneration] != generation {
+		return "AwaitingApproval", fmt.Sprintf("generation %d needs approval: annotate the WebApp with %s=%s",
+			webapp.Generation, webappv1.AnnotationApprovedGeneration, generation), 0
+	}
+
+	if len(rollout.Windows) == 0 {
+		return "", "", 0
+	}
+	var next time.Time
+	for _, w := range rollout.Windows {
+		open, opens, err := windowState(w, now)
+		if err != nil {
+			// The webhook rejects invalid windows; skip any that slipped through
+			continue
+		}
+		if open {
+			return "", "", 0
+		}
+		if !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+	if next.IsZero() {
+		return "OutsideWindow", "no rollout window will open", 0
+	}
+	return "OutsideWindow", fmt.Sprintf("held until the next rollout window opens at %s",
+		next.UTC().Format(time.RFC3339)), next.Sub(now)
+}
+
+// windowState reports whether the window is open at now and, if not, when it opens next.
+func windowState(w webappv1.RolloutWindow, now time.Time) (bool, time.Time, error) {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	sched, err := schedule.Parse(w.Schedule)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	// Open if the window started within the last duration
+	local := now.In(loc)
+	if start := sched.Next(local.Add(-duration)); !start.IsZero() && !start.After(local) {
+		return true, time.Time{}, nil
+	}
+	return false, sched.Next(local), nil
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+	"codewizard.io/webapp-operator/pkg/schedule"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileSchedule reports the entry of spec.schedule that is due and the
+// next one in status.schedule. It runs on the spec the rollout gate let
+// through, and returns the WebApp with the due entry in place of the home
+// page, for the remaining steps to serve, or contentMissing while the Markdown
+// it references does not exist, and how long until the next entry is due, so
+// the WebApp is reconciled again right then. The entry is never written back,
+// so revisions and rollbacks keep the schedule as written.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileSchedule(ctx context.Context, webapp *webappv1.WebApp) (_ *webappv1.WebApp, contentMissing bool, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepSchedule, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileSchedule", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	if len(webapp.Spec.Schedule) == 0 {
+		if webapp.Status.Schedule == nil {
+			return webapp, false, 0, nil
+		}
+		webapp.Status.Schedule = nil
+		return webapp, false, 0, r.persistStatus(ctx, webapp)
+	}
+
+	now := time.Now()
+	status, active := scheduleStatus(webapp.Spec.Schedule, now)
+	var requeueAfter time.Duration
+	if status.NextAt != nil {
+		requeueAfter = status.NextAt.Sub(now)
+	}
+
+	if !equality.Semantic.DeepEqual(webapp.Status.Schedule, status) {
+		if previous := webapp.Status.Schedule; active >= 0 && (previous == nil || previous.Active == nil || int(*previous.Active) != active) {
+			entry := webapp.Spec.Schedule[active]
+			log.FromContext(ctx).Info("Publishing scheduled content", "name", webapp.Name, "entry", active, "at", entry.At)
+			r.event(webapp, corev1.EventTypeNormal, "ScheduledContentPublished",
+				fmt.Sprintf("serving schedule entry %d, due at %s %s", active, entry.At, entry.TimeZone))
+		}
+		webapp.Status.Schedule = status
+		if err := r.persistStatus(ctx, webapp); err != nil {
+			return nil, false, 0, err
+		}
+	}
+	if active < 0 {
+		return webapp, false, requeueAfter, nil
+	}
+
+	// The content is copied by value, leaving the fetched WebApp untouched
+	entry := webapp.Spec.Schedule[active]
+	scheduled := webapp.DeepCopy()
+	content := webappv1.ContentSpec{}
+	if webapp.Spec.Content != nil {
+		content = *webapp.Spec.Content
+	}
+	if entry.ContentRef != nil {
+		ref := *entry.ContentRef
+		content.Markdown = &webappv1.MarkdownContent{ConfigMapRef: &ref}
+	} else {
+		scheduled.Spec.Message = entry.Message
+		content.Markdown = nil
+	}
+	scheduled.Spec.Content = &content
+
+	// Content referenced by the entry is read like the Markdown of spec.content
+	scheduled, contentMissing, err = r.reconcileContent(ctx, scheduled)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	return scheduled, contentMissing, requeueAfter, nil
+}
+
+// scheduleStatus returns the status of the schedule at now and the index of
+// the entry due, or -1 if none is due yet.
+func scheduleStatus(entries []webappv1.ScheduledContent, now time.Time) (*webappv1.ScheduleStatus, int) {
+	status := &webappv1.ScheduleStatus{}
+	active := -1
+	for i, entry := range entries {
+		at, err := schedule.At(entry.At, entry.TimeZone)
+		if err != nil {
+			// The webhook rejects invalid times; skip any that slipped through
+			continue
+		}
+		index := int32(i)
+		if !at.After(now) {
+			active = i
+			status.Active, status.ActiveSince = &index, &metav1.Time{Time: at}
+		} else if status.Next == nil {
+			status.Next, status.NextAt = &index, &metav1.Time{Time: at}
+		}
+	}
+	return status, active
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// testsFailedAnnotation marks a ControllerRevision whose smoke tests failed,
+	// so automatic rollbacks never return to it.
+	testsFailedAnnotation = "apps.codewizard.io/tests-failed"
+	// testsComponent labels the smoke-test Jobs and their Pods.
+	testsComponent = "smoke-tests"
+	// testsBackoffLimit retries failing checks. The retries also cover the delay
+	// before an updated ConfigMap reaches the running nginx Pods.
+	testsBackoffLimit = 3
+)
+
+// testsScript defines the check function run by the smoke-test Job. The check
+// parameters are passed as environment variables, so nothing from the spec is
+// ever interpolated into the script.
+const testsScript = `fail=0
+check() {
+  code=$(curl -s -o /tmp/body -w '%{http_code}' --max-time 10 "$1")
+  if [ "$code" != "$2" ]; then
+    echo "FAIL $1: got status $code, want $2"; fail=1; return
+  fi
+  if [ -n "$3" ] && ! grep -qF -- "$3" /tmp/body; then
+    echo "FAIL $1: body does not contain \"$3\""; fail=1; return
+  fi
+  if [ -n "$4" ] && ! grep -qE -- "$4" /tmp/body; then
+    echo "FAIL $1: body does not match /$4/"; fail=1; return
+  fi
+  echo "PASS $1"
+}
+`
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileTests runs the smoke tests once the current revision has rolled out,
+// and reports the outcome in the TestsPassed condition. When the tests fail and
+// rollbackOnFailure is set, it requests a rollback to the newest earlier
+// revision whose tests did not fail.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileTests(ctx context.Context, webapp *webappv1.WebApp, deployment *appsv1.Deployment, revision int64) (err error) {
+	defer metrics.ObserveStep(metrics.StepTests, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileTests", webapp)
+	defer func() { tracing.End(span, err) }()
+	logger := log.FromContext(ctx)
+
+	if webapp.Spec.Tests == nil {
+		return r.removeCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed)
+	}
+
+	// The revision is only recorded once rolled out; until then it is the previous one
+	if !rolloutComplete(webapp, deployment) {
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed, metav1.ConditionUnknown, "RolloutInProgress",
+			"waiting for the rollout to complete")
+	}
+
+	name := fmt.Sprintf("%s-tests-%d", webapp.Name, revision)
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, job)
+	if errors.IsNotFound(err) {
+		if err := r.startTests(ctx, webapp, name); err != nil {
+			return err
+		}
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed, metav1.ConditionUnknown, "TestsRunning",
+			fmt.Sprintf("running smoke tests of revision %d", revision))
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case jobHasCondition(job, batchv1.JobComplete):
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed, metav1.ConditionTrue, "TestsPassed",
+			fmt.Sprintf("revision %d passed %d checks", revision, len(webapp.Spec.Tests.Checks)))
+	case jobHasCondition(job, batchv1.JobFailed):
+		message := fmt.Sprintf("revision %d failed its smoke tests; see the logs of Job %s", revision, name)
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeTestsPassed); cond != nil &&
+			cond.Status == metav1.ConditionFalse && cond.Message == message {
+			// Already handled
+			return nil
+		}
+		logger.Info("Smoke tests failed", "name", webapp.Name, "revision", revision, "job", name)
+		r.event(webapp, corev1.EventTypeWarning, "TestsFailed", message)
+		if err := r.rollbackFailedRevision(ctx, webapp, revision); err != nil {
+			return err
+		}
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed, metav1.ConditionFalse, "TestsFailed", message)
+	default:
+		return r.setCondition(ctx, webapp, webappv1.ConditionTypeTestsPassed, metav1.ConditionUnknown, "TestsRunning",
+			fmt.Sprintf("running smoke tests of revision %d", revision))
+	}
+}
+
+// startTests creates the smoke-test Job and deletes the Jobs of earlier revisions.
+func (r *WebAppReconciler) startTests(ctx context.Context, webapp *webappv1.WebApp, name string) error {
+	job := testsJobForWebApp(webapp, name)
+	if err := ctrl.SetControllerReference(webapp, job, r.Scheme); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Starting smoke tests", "name", webapp.Name, "job", name)
+	if err := r.Create(ctx, job); err != nil {
+		return err
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(webapp.Namespace), client.MatchingLabels(job.Labels)); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		old := &jobs.Items[i]
+		if old.Name == name || !metav1.IsControlledBy(old, webapp) {
+			continue
+		}
+		if err := r.Delete(ctx, old, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackFailedRevision marks the revision as failed and, when rollbackOnFailure
+// is set, requests a rollback to the newest earlier revision that did not fail.
+func (r *WebAppReconciler) rollbackFailedRevision(ctx context.Context, webapp *webappv1.WebApp, revision int64) error {
+	revisions, err := r.listRevisions(ctx, webapp)
+	if err != nil {
+		return err
+	}
+
+	var target *appsv1.ControllerRevision
+	for i := range revisions {
+		rev := &revisions[i]
+		if rev.Revision == revision && rev.Annotations[testsFailedAnnotation] != "true" {
+			if rev.Annotations == nil {
+				rev.Annotations = map[string]string{}
+			}
+			rev.Annotations[testsFailedAnnotation] = "true"
+			if err := r.Update(ctx, rev); err != nil {
+				return err
+			}
+		}
+		// revisions are sorted oldest first
+		if rev.Revision < revision && rev.Annotations[testsFailedAnnotation] != "true" {
+			target = rev
+		}
+	}
+
+	if !webapp.Spec.Tests.RollbackOnFailure {
+		return nil
+	}
+	if target == nil {
+		r.event(webapp, corev1.EventTypeWarning, "RollbackSkipped", "no earlier revision passed its smoke tests")
+		return nil
+	}
+	log.FromContext(ctx).Info("Rolling back after failed smoke tests", "name", webapp.Name, "revision", target.Revision)
+	return r.updateWebApp(ctx, webapp, func(w *webappv1.WebApp) {
+		w.Spec.RollbackTo = &target.Revision
+	})
+}
+
+// testsJobForWebApp returns the Job running the WebApp's smoke tests against its Service.
+func testsJobForWebApp(webapp *webappv1.WebApp, name string) *batchv1.Job {
+	var script strings.Builder
+	script.WriteString(testsScript)
+	var env []corev1.EnvVar
+	for i, check := range webapp.Spec.Tests.Checks {
+		prefix := fmt.Sprintf("CHECK_%d_", i)
+		env = append(env,
+			corev1.EnvVar{Name: prefix + "URL", Value: fmt.Sprintf("http://%s.%s.svc:%d%s",
+				webapp.Name, webapp.Namespace, webapp.Spec.Port, check.Path)},
+			corev1.EnvVar{Name: prefix + "STATUS", Value: fmt.Sprint(check.ExpectedStatus)},
+			corev1.EnvVar{Name: prefix + "BODY_CONTAINS", Value: check.BodyContains},
+			corev1.EnvVar{Name: prefix + "BODY_REGEX", Value: check.BodyRegex},
+		)
+		fmt.Fprintf(&script, "check \"$%[1]sURL\" \"$%[1]sSTATUS\" \"$%[1]sBODY_CONTAINS\" \"$%[1]sBODY_REGEX\"\n", prefix)
+	}
+	script.WriteString("exit $fail\n")
+
+	labels := labelsForWebApp(webapp.Name)
+	labels["app.kubernetes.io/component"] = testsComponent
+	backoffLimit := int32(testsBackoffLimit)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					// Not the WebApp selector labels, so the Service never routes to the test Pod
+					Labels: map[string]string{
+						"app.kubernetes.io/instance":  webapp.Name,
+						"app.kubernetes.io/component": testsComponent,
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "smoke-tests",
+							Image:   webapp.Spec.Tests.Image,
+							Command: []string{"/bin/sh", "-c", script.String()},
+							Env:     env,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// rolloutComplete reports whether every replica of the serving Deployment runs
+// the current spec and serves the current content. Only BlueGreen and Canary
+// Deployments carry a rollout hash.
+func rolloutComplete(webapp *webappv1.WebApp, deployment *appsv1.Deployment) bool {
+	if !deploymentReady(deployment) || deployment.Spec.Template.Annotations[contentHashAnnotation] != contentHash(webapp) {
+		return false
+	}
+	hash, ok := deployment.Spec.Template.Annotations[rolloutHashAnnotation]
+	return !ok || hash == rolloutHash(webapp)
+}
+
+// jobHasCondition reports whether the Job has the given condition set to True.
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == conditionType && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
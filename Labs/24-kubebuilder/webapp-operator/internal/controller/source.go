@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/gitsource"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+const (
+	// gitCommitAnnotation records the served commit on the pod template, so a
+	// new commit rolls the Pods.
+	gitCommitAnnotation = "apps.codewizard.io/git-commit"
+	// htmlRoot is the served directory: where the init containers of the
+	// sources fill the html volume, mounted at the same path in the nginx container.
+	htmlRoot = "/usr/share/nginx/html"
+	// gitSyncLink is the symlink to the checked-out worktree inside htmlRoot.
+	gitSyncLink = "current"
+	// gitResolveTimeout bounds a single ref lookup.
+	gitResolveTimeout = 30 * time.Second
+	// defaultGitInterval applies when spec.source.git.interval does not parse.
+	defaultGitInterval = time.Minute
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileSource resolves the git source ref to a commit and records it in
+// status.source. It returns the WebApp with that commit pinned in
+// spec.source.git.commit, for the remaining steps to serve: the commit is then
+// part of the versioned spec, held by the rollout gate and recorded in the
+// revisions. A lookup failure keeps serving the last resolved commit and is
+// reported in the SourceSynced condition. It also returns when to resolve the
+// ref again.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileSource(ctx context.Context, webapp *webappv1.WebApp) (_ *webappv1.WebApp, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepSource, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileSource", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	git := gitSource(webapp)
+	if git == nil {
+		if webapp.Status.Source != nil {
+			webapp.Status.Source = nil
+			if err := r.persistStatus(ctx, webapp); err != nil {
+				return nil, 0, err
+			}
+		}
+		return webapp, 0, r.removeCondition(ctx, webapp, webappv1.ConditionTypeSourceSynced)
+	}
+	if git.Commit != "" {
+		return webapp, 0, r.pinnedSource(ctx, webapp, git)
+	}
+	interval, err := time.ParseDuration(git.Interval)
+	if err != nil || interval <= 0 {
+		interval = defaultGitInterval
+	}
+	// Each sync writes the status, which triggers another reconcile
+	if due := nextSync(webapp, git, interval); due > 0 {
+		return withPinnedCommit(webapp), due, nil
+	}
+
+	commit, err := r.resolveGitRef(ctx, webapp, git)
+	if err != nil {
+		message := fmt.Sprintf("resolving %s at %s: %v", git.Ref, git.URL, err)
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced); cond == nil || cond.Message != message {
+			log.FromContext(ctx).Info("Git source sync failed", "name", webapp.Name, "error", err.Error())
+			r.event(webapp, corev1.EventTypeWarning, "SourceSyncFailed", message)
+		}
+		if err := r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceSynced, metav1.ConditionFalse, "SyncFailed", message); err != nil {
+			return nil, 0, err
+		}
+		return withPinnedCommit(webapp), interval, nil
+	}
+
+	previous := ""
+	if webapp.Status.Source != nil {
+		previous = webapp.Status.Source.Commit
+	}
+	if commit != previous {
+		log.FromContext(ctx).Info("Git source moved", "name", webapp.Name, "ref", git.Ref, "commit", commit)
+		r.event(webapp, corev1.EventTypeNormal, "SourceUpdated", fmt.Sprintf("%s resolved to commit %s", git.Ref, commit))
+	}
+	webapp.Status.Source = &webappv1.SourceStatus{
+		URL:          git.URL,
+		Ref:          git.Ref,
+		Commit:       commit,
+		LastSyncTime: &metav1.Time{Time: time.Now()},
+	}
+	if err := r.persistStatus(ctx, webapp); err != nil {
+		return nil, 0, err
+	}
+	if err := r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceSynced, metav1.ConditionTrue, "Synced",
+		fmt.Sprintf("serving commit %s of %s", commit, git.Ref)); err != nil {
+		return nil, 0, err
+	}
+	// Pinned after the status writes, so the copy carries the latest resourceVersion
+	return withPinnedCommit(webapp), interval, nil
+}
+
+// pinnedSource records the commit pinned in the spec in status.source, without
+// resolving the ref.
+func (r *WebAppReconciler) pinnedSource(ctx context.Context, webapp *webappv1.WebApp, git *webappv1.GitSource) error {
+	if status := webapp.Status.Source; status == nil || status.URL != git.URL || status.Ref != git.Ref || status.Commit != git.Commit {
+		webapp.Status.Source = &webappv1.SourceStatus{
+			URL:          git.URL,
+			Ref:          git.Ref,
+			Commit:       git.Commit,
+			LastSyncTime: &metav1.Time{Time: time.Now()},
+		}
+		if err := r.persistStatus(ctx, webapp); err != nil {
+			return err
+		}
+	}
+	return r.setCondition(ctx, webapp, webappv1.ConditionTypeSourceSynced, metav1.ConditionTrue, "Pinned",
+		fmt.Sprintf("serving pinned commit %s", git.Commit))
+}
+
+// withPinnedCommit returns the WebApp with the commit last resolved from the
+// ref pinned in spec.source.git.commit, or the WebApp itself if the spec pins
+// a commit already or the ref has not been resolved yet. The git source is
+// copied by value, leaving the fetched WebApp untouched.
+func withPinnedCommit(webapp *webappv1.WebApp) *webappv1.WebApp {
+	git, status := gitSource(webapp), webapp.Status.Source
+	if git == nil || git.Commit != "" || status == nil || status.Commit == "" || status.URL != git.URL || status.Ref != git.Ref {
+		return webapp
+	}
+	pinned := webapp.DeepCopy()
+	source, pinnedGit := *webapp.Spec.Source, *git
+	pinnedGit.Commit = status.Commit
+	source.Git = &pinnedGit
+	pinned.Spec.Source = &source
+	return pinned
+}
+
+// nextSync returns how long until the ref is due to be resolved again, or
+// zero if it is due now, e.g. because the URL or ref changed.
+func nextSync(webapp *webappv1.WebApp, git *webappv1.GitSource, interval time.Duration) time.Duration {
+	status := webapp.Status.Source
+	if status == nil || status.LastSyncTime == nil || status.URL != git.URL || status.Ref != git.Ref {
+		return 0
+	}
+	if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced); cond == nil || cond.Status != metav1.ConditionTrue {
+		return 0
+	}
+	return max(time.Until(status.LastSyncTime.Add(interval)), 0)
+}
+
+// resolveGitRef looks up the commit of the git source ref, with the
+// credentials from the referenced Secret. The Secret is read uncached: the
+// operator may only get Secrets, not list or watch them.
+func (r *WebAppReconciler) resolveGitRef(ctx context.Context, webapp *webappv1.WebApp, git *webappv1.GitSource) (string, error) {
+	// The webhook rejects file URLs as well; a lookup would read the operator's own filesystem
+	if u, err := url.Parse(git.URL); err == nil && u.Scheme == "file" {
+		return "", fmt.Errorf("unsupported repository URL scheme %q", u.Scheme)
+	}
+	var creds *gitsource.Credentials
+	if git.SecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, types.NamespacedName{Name: git.SecretRef.Name, Namespace: webapp.Namespace}, secret); err != nil {
+			return "", fmt.Errorf("reading credentials: %w", err)
+		}
+		creds = &gitsource.Credentials{
+			Username: string(secret.Data["username"]),
+			Password: string(secret.Data["password"]),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitResolveTimeout)
+	defer cancel()
+	return gitsource.Resolve(ctx, git.URL, git.Ref, creds)
+}
+
+// gitSource returns the WebApp's git source, or nil if it serves the message page.
+func gitSource(webapp *webappv1.WebApp) *webappv1.GitSource {
+	if webapp.Spec.Source == nil {
+		return nil
+	}
+	return webapp.Spec.Source.Git
+}
+
+// gitRevision returns what the Pods check out: the pinned commit, or the ref
+// itself until it has been resolved once.
+func gitRevision(webapp *webappv1.WebApp) string {
+	git := gitSource(webapp)
+	if git.Commit != "" {
+		return git.Commit
+	}
+	return git.Ref
+}
+
+// siteRoot returns the directory nginx serves.
+func siteRoot(webapp *webappv1.WebApp) string {
+	git := gitSource(webapp)
+	if git == nil || webapp.Spec.Build != nil {
+		return htmlRoot
+	}
+	return path.Join(htmlRoot, gitSyncLink, git.Subdirectory)
+}
+
+// withGitSource replaces the html ConfigMap volume of the pod template with
+// an emptyDir the git-sync init container clones the commit into. With a
+// build, the Pods serve the build output instead.
+func withGitSource(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	if gitSource(webapp) == nil || webapp.Spec.Build != nil {
+		return
+	}
+	template.Annotations[gitCommitAnnotation] = gitRevision(webapp)
+	emptyHTMLVolume(template)
+
+	container := gitSyncContainer(webapp, htmlRoot, gitSyncLink)
+	container.VolumeMounts = []corev1.VolumeMount{{Name: "html", MountPath: htmlRoot}}
+	template.Spec.InitContainers = append(template.Spec.InitContainers, container)
+}
+
+// gitSyncContainer returns a container cloning the source commit into root
+// and linking it as link, with the credentials of the git source.
+func gitSyncContainer(webapp *webappv1.WebApp, root, link string) corev1.Container {
+	git := gitSource(webapp)
+	container := corev1.Container{
+		Name:            "git-sync",
+		Image:           git.Image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			"--repo=" + git.URL,
+			"--ref=" + gitRevision(webapp),
+			"--root=" + root,
+			"--link=" + link,
+			"--depth=1",
+			"--one-time",
+		},
+	}
+	if git.SecretRef != nil {
+		for _, env := range []struct{ name, key string }{
+			{"GITSYNC_USERNAME", "username"},
+			{"GITSYNC_PASSWORD", "password"},
+		} {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name: env.name,
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: *git.SecretRef,
+					Key:                  env.key,
+				}},
+			})
+		}
+	}
+	return container
+}
+
+// emptyHTMLVolume replaces the html ConfigMap volume of the pod template with
+// an emptyDir, for an init container to fill.
+func emptyHTMLVolume(template *corev1.PodTemplateSpec) {
+	for i := range template.Spec.Volumes {
+		if template.Spec.Volumes[i].Name == "html" {
+			template.Spec.Volumes[i].VolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/upload"
+)
+
+const (
+	// uploadContainer is the init container unpacking the uploaded tarball.
+	uploadContainer = "unpack-upload"
+	// uploadChunksDir is where the chunk ConfigMaps are mounted.
+	uploadChunksDir = "/upload"
+)
+
+// uploadScript joins the chunks, verifies the digest and unpacks the tarball.
+// Files are made readable to the nginx workers whatever their mode in the tarball.
+const uploadScript = `set -eu
+actual=$(cat "$UPLOAD_CHUNKS"/chunk-* | sha256sum | cut -d' ' -f1)
+if [ "$actual" != "$UPLOAD_SHA256" ]; then
+  echo "checksum mismatch: the upload has sha256 $actual, want $UPLOAD_SHA256" >&2
+  exit 65
+fi
+cat "$UPLOAD_CHUNKS"/chunk-* | tar -xzo -f - -C "$UPLOAD_DEST"
+chmod -R a+rX "$UPLOAD_DEST"
+`
+
+// uploadSource returns the WebApp's upload source, or nil if it has none.
+func uploadSource(webapp *webappv1.WebApp) *webappv1.UploadSource {
+	if webapp.Spec.Source == nil {
+		return nil
+	}
+	return webapp.Spec.Source.Upload
+}
+
+// withUploadSource replaces the html ConfigMap volume of the pod template with
+// an emptyDir the init container unpacks the uploaded tarball into. Until the
+// first upload, the Pods serve the message page.
+func withUploadSource(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	uploaded := uploadSource(webapp)
+	if uploaded == nil || uploaded.Revision == 0 {
+		return
+	}
+	emptyHTMLVolume(template)
+
+	// The chunk names change with every upload, which rolls the Pods
+	chunks := make([]corev1.VolumeProjection, 0, uploaded.Chunks)
+	for i := 0; i < int(uploaded.Chunks); i++ {
+		chunks = append(chunks, corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: upload.ChunkName(webapp.Name, uploaded.Revision, uploaded.SHA256, i)},
+			Items:                []corev1.KeyToPath{{Key: upload.ChunkKey, Path: fmt.Sprintf("chunk-%03d", i)}},
+		}})
+	}
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name:         "upload",
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: chunks}},
+	})
+
+	template.Spec.InitContainers = append(template.Spec.InitContainers, corev1.Container{
+		Name:            uploadContainer,
+		Image:           uploaded.Image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c"},
+		Args:            []string{uploadScript},
+		Env: []corev1.EnvVar{
+			{Name: "UPLOAD_SHA256", Value: uploaded.SHA256},
+			{Name: "UPLOAD_CHUNKS", Value: uploadChunksDir},
+			{Name: "UPLOAD_DEST", Value: htmlRoot},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "html", MountPath: htmlRoot},
+			{Name: "upload", MountPath: uploadChunksDir, ReadOnly: true},
+		},
+	})
+}
+
+// uploadChunks lists the chunk ConfigMaps of the WebApp's uploads.
+func (r *WebAppReconciler) uploadChunks(ctx context.Context, webapp *webappv1.WebApp) ([]corev1.ConfigMap, error) {
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(webapp.Namespace), client.MatchingLabels(upload.ChunkLabels(webapp.Name))); err != nil {
+		return nil, err
+	}
+	var chunks []corev1.ConfigMap
+	for _, chunk := range list.Items {
+		if metav1.IsControlledBy(&chunk, webapp) {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// pruneUploadChunks deletes the chunks of the uploads neither the spec nor a
+// retained revision refers to, so every revision can still be rolled back to.
+// Chunks newer than any referenced upload belong to an upload in progress.
+func (r *WebAppReconciler) pruneUploadChunks(ctx context.Context, webapp *webappv1.WebApp) error {
+	revisions, err := r.listRevisions(ctx, webapp)
+	if err != nil {
+		return err
+	}
+
+	referenced := map[int64]bool{}
+	var newest int64
+	refer := func(uploaded *webappv1.UploadSource) {
+		if uploaded != nil {
+			referenced[uploaded.Revision] = true
+			newest = max(newest, uploaded.Revision)
+		}
+	}
+	refer(uploadSource(webapp))
+	for _, rev := range revisions {
+		var spec webappv1.WebAppSpec
+		if err := json.Unmarshal(rev.Data.Raw, &spec); err != nil {
+			return fmt.Errorf("decoding revision %d: %w", rev.Revision, err)
+		}
+		if spec.Source != nil {
+			refer(spec.Source.Upload)
+		}
+	}
+
+	if newest == 0 {
+		// The WebApp never served an upload
+		return nil
+	}
+
+	chunks, err := r.uploadChunks(ctx, webapp)
+	if err != nil {
+		return err
+	}
+	for i := range chunks {
+		revision, ok := upload.ChunkRevision(&chunks[i])
+		if !ok || referenced[revision] || revision > newest {
+			continue
+		}
+		log.FromContext(ctx).Info("Pruning upload chunk", "name", chunks[i].Name, "upload", revision)
+		if err := r.Delete(ctx, &chunks[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
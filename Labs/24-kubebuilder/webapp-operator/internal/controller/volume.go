@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
+)
+
+// volumeRequeue is how often the claim is checked while it is not bound, or
+// conflicts with the replicas, since claims the operator did not create are
+// not watched.
+const volumeRequeue = 30 * time.Second
+
+// ─────────────────────────────────────────────────────────────────────────────
+// reconcileVolume creates the claim of a volume source from its template, and
+// reports in the VolumeReady condition whether the claim is bound and its
+// access mode fits the replicas. It returns whether the claim conflicts with
+// the replicas, which leaves the Deployment alone, and when to look again.
+// ─────────────────────────────────────────────────────────────────────────────
+func (r *WebAppReconciler) reconcileVolume(ctx context.Context, webapp *webappv1.WebApp) (_ bool, _ time.Duration, err error) {
+	defer metrics.ObserveStep(metrics.StepSource, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileVolume", webapp)
+	defer func() { tracing.End(span, err) }()
+
+	volume := volumeSource(webapp)
+	if volume == nil {
+		return false, 0, r.removeCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady)
+	}
+	if volume.ClaimTemplate != nil {
+		if err := r.ensureVolumeClaim(ctx, webapp); err != nil {
+			return false, 0, fmt.Errorf("creating volume claim: %w", err)
+		}
+	}
+
+	name := volumeClaimName(webapp)
+	claim := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, claim); errors.IsNotFound(err) {
+		return false, volumeRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady, metav1.ConditionFalse,
+			"ClaimNotFound", fmt.Sprintf("PersistentVolumeClaim %s does not exist", name))
+	} else if err != nil {
+		return false, 0, err
+	}
+
+	if conflict := accessModeConflict(claim, webapp.Spec.Replicas, volume.ReadWriteOncePolicy); conflict != "" {
+		if cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeVolumeReady); cond == nil || cond.Message != conflict {
+			log.FromContext(ctx).Info("Volume claim does not fit the replicas", "name", webapp.Name, "claim", name)
+			r.event(webapp, corev1.EventTypeWarning, "AccessModeConflict", conflict)
+		}
+		return true, volumeRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady,
+			metav1.ConditionFalse, "AccessModeConflict", conflict)
+	}
+
+	switch claim.Status.Phase {
+	case corev1.ClaimBound:
+		return false, 0, r.setCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady, metav1.ConditionTrue, "Bound",
+			fmt.Sprintf("serving PersistentVolumeClaim %s, bound to %s", name, claim.Spec.VolumeName))
+	case corev1.ClaimLost:
+		return false, volumeRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady, metav1.ConditionFalse, "ClaimLost",
+			fmt.Sprintf("PersistentVolumeClaim %s lost its volume %s", name, claim.Spec.VolumeName))
+	default:
+		// Claims of a WaitForFirstConsumer class only bind once a Pod uses them
+		return false, volumeRequeue, r.setCondition(ctx, webapp, webappv1.ConditionTypeVolumeReady, metav1.ConditionFalse, "Pending",
+			fmt.Sprintf("PersistentVolumeClaim %s is not bound yet", name))
+	}
+}
+
+// accessModeConflict explains why the replicas cannot share the claim under
+// the ReadWriteOnce policy, or returns "" if they can.
+func accessModeConflict(claim *corev1.PersistentVolumeClaim, replicas int32, policy webappv1.ReadWriteOncePolicy) string {
+	modes := claim.Spec.AccessModes
+	if claim.Status.Phase == corev1.ClaimBound {
+		modes = claim.Status.AccessModes
+	}
+	if replicas <= 1 || slices.Contains(modes, corev1.ReadWriteMany) || slices.Contains(modes, corev1.ReadOnlyMany) {
+		return ""
+	}
+	if slices.Contains(modes, corev1.ReadWriteOncePod) && !slices.Contains(modes, corev1.ReadWriteOnce) {
+		return fmt.Sprintf("PersistentVolumeClaim %s is ReadWriteOncePod, which only one of the %d replicas can mount",
+			claim.Name, replicas)
+	}
+	if policy == webappv1.ReadWriteOncePolicySameNode {
+		return ""
+	}
+	return fmt.Sprintf("PersistentVolumeClaim %s is ReadWriteOnce, which only one node can mount, but %d replicas are requested; "+
+		"use a ReadWriteMany claim or set readWriteOncePolicy to SameNode", claim.Name, replicas)
+}
+
+// ensureVolumeClaim creates the claim from the template if it does not exist.
+// Its spec is never updated, since most of it is immutable. An existing claim
+// has passed reconcileOwnership, which adopts it only under the Adopt policy.
+func (r *WebAppReconciler) ensureVolumeClaim(ctx context.Context, webapp *webappv1.WebApp) error {
+	claim := volumeClaimForWebApp(webapp)
+	err := r.Get(ctx, client.ObjectKeyFromObject(claim), &corev1.PersistentVolumeClaim{})
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	if err := ctrl.SetControllerReference(webapp, claim, r.Scheme); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Creating volume claim", "name", claim.Name)
+	return r.Create(ctx, claim)
+}
+
+// volumeSource returns the WebApp's volume source, or nil if it has none.
+func volumeSource(webapp *webappv1.WebApp) *webappv1.VolumeSource {
+	if webapp.Spec.Source == nil {
+		return nil
+	}
+	return webapp.Spec.Source.Volume
+}
+
+// volumeClaimName returns the name of the claim served by the volume source.
+func volumeClaimName(webapp *webappv1.WebApp) string {
+	if volume := volumeSource(webapp); volume.ClaimName != "" {
+		return volume.ClaimName
+	}
+	return webapp.Name + "-content"
+}
+
+// volumeClaimForWebApp returns the claim created from the volume source template.
+func volumeClaimForWebApp(webapp *webappv1.WebApp) *corev1.PersistentVolumeClaim {
+	template := volumeSource(webapp).ClaimTemplate
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      volumeClaimName(webapp),
+			Namespace: webapp.Namespace,
+			Labels:    labelsForWebApp(webapp.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: template.StorageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: template.Size},
+			},
+		},
+	}
+	if template.AccessMode != "" {
+		claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{template.AccessMode}
+	}
+	return claim
+}
+
+// withVolumeSource replaces the html ConfigMap volume of the pod template with
+// the claim, mounted read-only. With the SameNode policy, the Pods require
+// each other's node.
+func withVolumeSource(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	volume := volumeSource(webapp)
+	if volume == nil {
+		return
+	}
+
+	for i := range template.Spec.Volumes {
+		if template.Spec.Volumes[i].Name == "html" {
+			template.Spec.Volumes[i].VolumeSource = corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: volumeClaimName(webapp), ReadOnly: true},
+			}
+		}
+	}
+	for i := range template.Spec.Containers {
+		for j := range template.Spec.Containers[i].VolumeMounts {
+			if mount := &template.Spec.Containers[i].VolumeMounts[j]; mount.Name == "html" {
+				mount.SubPath = volume.SubPath
+				mount.ReadOnly = true
+			}
+		}
+	}
+
+	if volume.ReadWriteOncePolicy == webappv1.ReadWriteOncePolicySameNode {
+		withSameNode(webapp, template)
+	}
+}
+
+// withSameNode requires the Pods of the template onto the node of the other
+// WebApp Pods, so they can share a ReadWriteOnce claim.
+func withSameNode(webapp *webappv1.WebApp, template *corev1.PodTemplateSpec) {
+	if template.Spec.Affinity == nil {
+		template.Spec.Affinity = &corev1.Affinity{}
+	}
+	template.Spec.Affinity.PodAffinity = &corev1.PodAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: labelsForWebApp(webapp.Name)},
+			TopologyKey:   corev1.LabelHostname,
+		}},
+	}
+}
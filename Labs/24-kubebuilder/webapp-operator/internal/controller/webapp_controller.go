@@ -4,29 +4,56 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/tracing"
 )
 
 const webappFinalizer = "apps.codewizard.io/finalizer"
 
+// replacedSelectorAnnotation records, on a Deployment that replaced one with
+// another selector, the selector of the ReplicaSets left to prune.
+const replacedSelectorAnnotation = "apps.codewizard.io/replaced-selector"
+
 // WebAppReconciler reconciles a WebApp object.
 type WebAppReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// APIReader reads objects straight from the API server, for kinds the
+	// operator must not cache, such as Secrets. Defaults to the Client.
+	APIReader client.Reader
+
+	// Recorder emits Kubernetes events on WebApps. It is optional.
+	Recorder record.EventRecorder
+
+	// Finalizers are the cleanup hooks run, in order, before a WebApp is deleted.
+	Finalizers []Finalizer
+
+	// FinalizerTimeout is how long cleanup hooks may block deletion before they
+	// are skipped. Defaults to 10 minutes.
+	FinalizerTimeout time.Duration
 }
 
 // RBAC markers - controller-gen turns these into config/rbac/role.yaml
@@ -35,25 +62,38 @@ type WebAppReconciler struct {
 //+kubebuilder:rbac:groups=apps.codewizard.io,resources=webapps/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apps.codewizard.io,resources=webapps/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is the main reconciliation loop.
 // It is called whenever a WebApp CR, or any resource it owns, changes.
-func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
+	// The generation is added to the span once the WebApp has been fetched
+	ctx, span := tracing.Start(ctx, "Reconcile", &metav1.ObjectMeta{Name: req.Name, Namespace: req.Namespace})
+	defer func() { tracing.End(span, err) }()
+
 	// ── Step 1: Fetch the WebApp instance ─────────────────────────────────────
 	webapp := &webappv1.WebApp{}
 	if err := r.Get(ctx, req.NamespacedName, webapp); err != nil {
 		if errors.IsNotFound(err) {
 			// Object was deleted before we could reconcile - nothing to do.
 			logger.Info("WebApp not found, likely deleted", "name", req.Name)
+			metrics.ForgetWebApp(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, fmt.Errorf("fetching WebApp: %w", err)
 	}
+	span.SetAttributes(tracing.Attributes(webapp)...)
 
 	// ── Step 2: Finalizer handling ─────────────────────────────────────────────
 	if webapp.DeletionTimestamp.IsZero() {
@@ -70,7 +110,18 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		// Object IS being deleted - run cleanup before Kubernetes removes it
 		if controllerutil.ContainsFinalizer(webapp, webappFinalizer) {
 			logger.Info("Running finalizer cleanup", "name", webapp.Name)
-			// Add any external resource cleanup here (e.g., cloud DNS, certificates)
+			requeueAfter, err := r.runFinalizers(ctx, webapp)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("running cleanup hooks: %w", err)
+			}
+			if requeueAfter > 0 {
+				// A hook failed - keep the finalizer and retry with backoff
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
+			// Release the children the deletion policy keeps before the GC sees the WebApp go
+			if err := r.applyDeletionPolicy(ctx, webapp); err != nil {
+				return ctrl.Result{}, fmt.Errorf("applying deletion policy: %w", err)
+			}
 
 			// Remove finalizer - Kubernetes will then delete the object
 			controllerutil.RemoveFinalizer(webapp, webappFinalizer)
@@ -82,64 +133,191 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// ── Step 3: Short-circuit when paused ─────────────────────────────────────
+	// Only the WebApp status is written: what resuming would change
 	if webapp.Spec.Paused {
 		logger.Info("WebApp is paused, skipping reconciliation", "name", webapp.Name)
+		if err := r.reportPendingChanges(ctx, webapp); err != nil {
+			return ctrl.Result{}, fmt.Errorf("reporting pending changes: %w", err)
+		}
 		return ctrl.Result{}, nil
 	}
+	if err := r.clearPendingChanges(ctx, webapp); err != nil {
+		return ctrl.Result{}, fmt.Errorf("clearing pending changes: %w", err)
+	}
 
 	logger.Info("Reconciling WebApp",
 		"name", webapp.Name,
 		"namespace", webapp.Namespace,
 		"replicas", webapp.Spec.Replicas)
 
-	// ── Step 4: Reconcile ConfigMap (HTML content) ────────────────────────────
-	if err := r.reconcileConfigMap(ctx, webapp); err != nil {
-		return ctrl.Result{}, fmt.Errorf("reconciling ConfigMap: %w", err)
+	// ── Step 4: Roll back to a recorded revision on request ───────────────────
+	rolledBack, err := r.rollback(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("rolling back: %w", err)
+	}
+	if rolledBack {
+		// The restored spec is reconciled on the resulting update event
+		return ctrl.Result{}, nil
+	}
+
+	// ── Step 5: Resolve the git source to the commit to serve ─────────────────
+	webapp, sourceRequeue, err := r.reconcileSource(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("syncing git source: %w", err)
+	}
+
+	// ── Step 6: Read the Markdown content to render ───────────────────────────
+	webapp, contentMissing, err := r.reconcileContent(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("reading content: %w", err)
+	}
+	if contentMissing {
+		// The children keep serving the last content until the ConfigMap watch
+		// reconciles the Markdown appearing
+		return ctrl.Result{}, nil
+	}
+
+	// ── Step 7: Hold new revisions outside rollout windows or without approval
+	// While held, the remaining steps reconcile the last applied spec
+	webapp, gateRequeue, err := r.gateRollout(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("gating rollout: %w", err)
 	}
+	// The revision records spec.schedule, not the entry served from it
+	applied := webapp
 
-	// ── Step 5: Reconcile Deployment ──────────────────────────────────────────
-	deployment, err := r.reconcileDeployment(ctx, webapp)
+	// ── Step 8: Build the pinned commit with the static site generator ────────
+	buildConflict, buildRequeue, err := r.reconcileBuild(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("building site: %w", err)
+	}
+	if buildConflict {
+		return ctrl.Result{RequeueAfter: buildRequeue}, nil
+	}
+
+	// ── Step 9: Apply the scheduled content that is due ───────────────────────
+	webapp, contentMissing, scheduleRequeue, err := r.reconcileSchedule(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("applying schedule: %w", err)
+	}
+	if contentMissing {
+		return ctrl.Result{RequeueAfter: scheduleRequeue}, nil
+	}
+
+	// ── Step 10: Refuse to write to resources the WebApp does not own ─────────
+	conflicted, err := r.reconcileOwnership(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("checking child ownership: %w", err)
+	}
+	if conflicted {
+		return ctrl.Result{RequeueAfter: nameConflictRequeue}, nil
+	}
+
+	// ── Step 11: Check the claim of the volume source fits the replicas ───────
+	volumeConflict, claimRequeue, err := r.reconcileVolume(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("checking volume source: %w", err)
+	}
+	if volumeConflict {
+		return ctrl.Result{RequeueAfter: claimRequeue}, nil
+	}
+
+	// ── Step 12: Reconcile ConfigMap (HTML content) ───────────────────────────
+	// BlueGreen and Canary write a ConfigMap pair per Deployment in their Deployment step
+	if rolloutStrategy(webapp) == webappv1.RolloutStrategyRollingUpdate {
+		if err := r.reconcileConfigMap(ctx, webapp); err != nil {
+			return ctrl.Result{}, fmt.Errorf("reconciling ConfigMap: %w", err)
+		}
+	}
+
+	// ── Step 13: Reconcile Deployment(s) for the rollout strategy ─────────────
+	deployment, requeueAfter, err := r.reconcileWorkloads(ctx, webapp)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("reconciling Deployment: %w", err)
 	}
 
-	// ── Step 6: Reconcile Service ─────────────────────────────────────────────
+	// ── Step 14: Reconcile Service ────────────────────────────────────────────
 	if err := r.reconcileService(ctx, webapp); err != nil {
 		return ctrl.Result{}, fmt.Errorf("reconciling Service: %w", err)
 	}
 
-	// ── Step 7: Update Status ─────────────────────────────────────────────────
-	if err := r.updateStatus(ctx, webapp, deployment); err != nil {
+	// ── Step 15: Report whether the maintenance page is served ────────────────
+	if err := r.reconcileMaintenance(ctx, webapp); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reporting maintenance: %w", err)
+	}
+
+	// ── Step 16: Reconcile ServiceMonitor (only if the Prometheus Operator is installed)
+	if err := r.reconcileServiceMonitor(ctx, webapp); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconciling ServiceMonitor: %w", err)
+	}
+
+	// ── Step 17: Report out-of-band edits left in place by driftPolicy Report
+	if err := r.reconcileDrift(ctx, webapp); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reporting drift: %w", err)
+	}
+
+	// ── Step 18: Report whether the Pods verified the archive source ──────────
+	verifyRequeue, err := r.reconcileArchiveVerification(ctx, webapp)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("checking archive verification: %w", err)
+	}
+
+	// ── Step 19: Record the applied spec as a revision once rolled out ────────
+	revision, err := r.recordRevision(ctx, webapp, applied, deployment)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("recording revision: %w", err)
+	}
+
+	// ── Step 20: Smoke-test the rolled-out revision ───────────────────────────
+	if err := r.reconcileTests(ctx, webapp, deployment, revision); err != nil {
+		return ctrl.Result{}, fmt.Errorf("running smoke tests: %w", err)
+	}
+
+	// ── Step 21: Update Status ────────────────────────────────────────────────
+	if err := r.updateStatus(ctx, webapp, deployment, revision); err != nil {
 		return ctrl.Result{}, fmt.Errorf("updating status: %w", err)
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: earliest(requeueAfter, gateRequeue, sourceRequeue, verifyRequeue, claimRequeue, scheduleRequeue)}, nil
+}
+
+// earliest returns the shortest of the requeue delays, where zero means none.
+func earliest(delays ...time.Duration) time.Duration {
+	var first time.Duration
+	for _, d := range delays {
+		if first == 0 || (d != 0 && d < first) {
+			first = d
+		}
+	}
+	return first
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
-// reconcileConfigMap ensures the HTML ConfigMap exists and is up-to-date.
+// reconcileConfigMap ensures the HTML and nginx ConfigMaps exist and are up-to-date.
 // ─────────────────────────────────────────────────────────────────────────────
-func (r *WebAppReconciler) reconcileConfigMap(ctx context.Context, webapp *webappv1.WebApp) error {
-	logger := log.FromContext(ctx)
+func (r *WebAppReconciler) reconcileConfigMap(ctx context.Context, webapp *webappv1.WebApp) (err error) {
+	defer metrics.ObserveStep(metrics.StepConfigMap, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileConfigMap", webapp)
+	defer func() { tracing.End(span, err) }()
 
-	desired := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      webapp.Name + "-html",
-			Namespace: webapp.Namespace,
-			Labels:    labelsForWebApp(webapp.Name),
-		},
-		Data: map[string]string{
-			"index.html": fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head><title>%s</title></head>
-<body>
-  <h1>%s</h1>
-  <p>Managed by the <strong>WebApp Operator</strong> | Instance: <strong>%s</strong></p>
-</body>
-</html>`, webapp.Spec.Message, webapp.Spec.Message, webapp.Name),
-		},
+	return r.applyContent(ctx, webapp, webapp.Name)
+}
+
+// applyContent writes the html and nginx ConfigMaps mounted by the named Deployment.
+func (r *WebAppReconciler) applyContent(ctx context.Context, webapp *webappv1.WebApp, deploymentName string) error {
+	if err := r.applyConfigMap(ctx, webapp, htmlConfigMapForWebApp(webapp, deploymentName+"-html")); err != nil {
+		return err
 	}
 
+	// The nginx server configuration lives in its own ConfigMap so it is never
+	// served as content from the html root
+	return r.applyConfigMap(ctx, webapp, nginxConfigMapForWebApp(webapp, deploymentName+"-nginx"))
+}
+
+// applyConfigMap creates the ConfigMap, or updates its data when it drifted from desired.
+func (r *WebAppReconciler) applyConfigMap(ctx context.Context, webapp *webappv1.WebApp, desired *corev1.ConfigMap) error {
+	logger := log.FromContext(ctx)
+
 	// Owner reference: ConfigMap is garbage-collected when the WebApp CR is deleted
 	if err := ctrl.SetControllerReference(webapp, desired, r.Scheme); err != nil {
 		return err
@@ -155,8 +333,13 @@ func (r *WebAppReconciler) reconcileConfigMap(ctx context.Context, webapp *webap
 		return err
 	}
 
+	if drifted := keptDrift(webapp, existing, configMapChanges(desired, existing)); len(drifted) > 0 {
+		logger.Info("Keeping drifted ConfigMap fields", "name", existing.Name, "fields", drifted)
+		keepDriftedConfigMap(desired, existing, drifted)
+	}
+
 	// Update only if the content changed
-	if existing.Data["index.html"] != desired.Data["index.html"] {
+	if !equality.Semantic.DeepEqual(existing.Data, desired.Data) {
 		existing.Data = desired.Data
 		logger.Info("Updating ConfigMap", "name", existing.Name)
 		return r.Update(ctx, existing)
@@ -168,16 +351,24 @@ func (r *WebAppReconciler) reconcileConfigMap(ctx context.Context, webapp *webap
 // ─────────────────────────────────────────────────────────────────────────────
 // reconcileDeployment ensures the nginx Deployment exists and matches spec.
 // ─────────────────────────────────────────────────────────────────────────────
-func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *webappv1.WebApp) (*appsv1.Deployment, error) {
-	logger := log.FromContext(ctx)
+func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *webappv1.WebApp) (_ *appsv1.Deployment, err error) {
+	defer metrics.ObserveStep(metrics.StepDeployment, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileDeployment", webapp)
+	defer func() { tracing.End(span, err) }()
 
-	labels := labelsForWebApp(webapp.Name)
-	replicas := webapp.Spec.Replicas
+	desired := deploymentForWebApp(webapp, webapp.Name, stableLabels(webapp), webapp.Spec.Replicas)
+	return r.applyDeployment(ctx, webapp, desired)
+}
+
+// deploymentForWebApp returns the nginx Deployment with the given name, selector
+// labels, and replica count. It mounts the "<name>-html" and "<name>-nginx" ConfigMaps,
+// and the maintenance ConfigMap of the WebApp.
+func deploymentForWebApp(webapp *webappv1.WebApp, name string, labels map[string]string, replicas int32) *appsv1.Deployment {
 	maxUnavailable := intstr.FromInt32(webapp.Spec.MaxUnavailable)
 
-	desired := &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      webapp.Name,
+			Name:      name,
 			Namespace: webapp.Namespace,
 			Labels:    labels,
 		},
@@ -191,7 +382,16 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 				},
 			},
 			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// Changing the nginx config rolls the Pods, since nginx only reads it at startup.
+					// Changing the content does too, so a finished rollout serves it: the
+					// kubelet only refreshes mounted ConfigMaps on its next sync
+					Annotations: map[string]string{
+						nginxConfigHashAnnotation: nginxConfigHash(webapp),
+						contentHashAnnotation:     contentHash(webapp),
+					},
+				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
@@ -206,11 +406,16 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 									Name:      "html",
 									MountPath: "/usr/share/nginx/html",
 								},
+								{
+									Name:      "nginx-conf",
+									MountPath: nginxConfigDir,
+									ReadOnly:  true,
+								},
 							},
 							ReadinessProbe: &corev1.Probe{
 								ProbeHandler: corev1.ProbeHandler{
 									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/",
+										Path: healthPath,
 										Port: intstr.FromInt32(webapp.Spec.Port),
 									},
 								},
@@ -220,7 +425,7 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 							LivenessProbe: &corev1.Probe{
 								ProbeHandler: corev1.ProbeHandler{
 									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/",
+										Path: healthPath,
 										Port: intstr.FromInt32(webapp.Spec.Port),
 									},
 								},
@@ -235,7 +440,17 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 							VolumeSource: corev1.VolumeSource{
 								ConfigMap: &corev1.ConfigMapVolumeSource{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: webapp.Name + "-html",
+										Name: name + "-html",
+									},
+								},
+							},
+						},
+						{
+							Name: "nginx-conf",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: name + "-nginx",
 									},
 								},
 							},
@@ -246,6 +461,40 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 		},
 	}
 
+	// Every color mounts the shared maintenance ConfigMap, so toggling
+	// maintenance reaches the running Pods without changing the template
+	volume, mount := maintenanceVolume(webapp)
+	pod := &deployment.Spec.Template.Spec
+	pod.Volumes = append(pod.Volumes, volume)
+	pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, mount)
+
+	if monitoringEnabled(webapp) {
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, exporterContainer(webapp))
+	}
+
+	// A new commit, archive digest, build or upload changes the template, which rolls every Pod
+	withGitSource(webapp, &deployment.Spec.Template)
+	withArchiveSource(webapp, &deployment.Spec.Template)
+	withBuild(webapp, &deployment.Spec.Template)
+	withVolumeSource(webapp, &deployment.Spec.Template)
+	withUploadSource(webapp, &deployment.Spec.Template)
+
+	// A new restart timestamp changes the template, which rolls every Pod of the
+	// Deployment in place; it is left out of the rollout hash, so it never
+	// starts a BlueGreen or Canary rollout
+	if restartedAt, ok := webapp.Annotations[webappv1.AnnotationRestartedAt]; ok {
+		deployment.Spec.Template.Annotations[webappv1.AnnotationRestartedAt] = restartedAt
+	}
+
+	return deployment
+}
+
+// applyDeployment creates the Deployment, or updates its replicas and pod template
+// when they drifted from desired. A Deployment selector is immutable, so one
+// created with other selector labels is replaced by replaceDeployment.
+func (r *WebAppReconciler) applyDeployment(ctx context.Context, webapp *webappv1.WebApp, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	logger := log.FromContext(ctx)
+
 	if err := ctrl.SetControllerReference(webapp, desired, r.Scheme); err != nil {
 		return nil, err
 	}
@@ -257,36 +506,45 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 		if err := r.Create(ctx, desired); err != nil {
 			return nil, err
 		}
+		// A recorded DeploymentName means we created it before and someone removed it
+		if webapp.Status.DeploymentName == desired.Name {
+			metrics.ChildRecreations.WithLabelValues(webapp.Namespace, webapp.Name, "Deployment").Inc()
+		}
 		return desired, nil
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Reconcile mutable fields: replicas, image, and port
-	needsUpdate := false
-	if *existing.Spec.Replicas != replicas {
-		existing.Spec.Replicas = &replicas
-		needsUpdate = true
+	if !equality.Semantic.DeepEqual(existing.Spec.Selector, desired.Spec.Selector) {
+		return r.replaceDeployment(ctx, webapp, existing, desired)
+	}
+	if selector, ok := existing.Annotations[replacedSelectorAnnotation]; ok && deploymentReady(existing) {
+		if err := r.pruneReplacedReplicaSets(ctx, existing, selector); err != nil {
+			return nil, err
+		}
 	}
-	containers := existing.Spec.Template.Spec.Containers
-	if len(containers) == 0 {
-		logger.Error(nil, "Deployment has no containers", "name", existing.Name)
-		return existing, nil
+
+	if drifted := keptDrift(webapp, existing, deploymentChanges(desired, existing)); len(drifted) > 0 {
+		logger.Info("Keeping drifted Deployment fields", "name", existing.Name, "fields", drifted)
+		keepDriftedDeployment(desired, existing, drifted)
 	}
-	if containers[0].Image != webapp.Spec.Image {
-		existing.Spec.Template.Spec.Containers[0].Image = webapp.Spec.Image
+
+	// Reconcile mutable fields: replicas and the pod template (image, port, sidecars, volumes)
+	needsUpdate := false
+	if *existing.Spec.Replicas != *desired.Spec.Replicas {
+		existing.Spec.Replicas = desired.Spec.Replicas
 		needsUpdate = true
 	}
-	if len(containers[0].Ports) > 0 && containers[0].Ports[0].ContainerPort != webapp.Spec.Port {
-		existing.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort = webapp.Spec.Port
+	if podTemplateChanged(&desired.Spec.Template, &existing.Spec.Template) {
+		existing.Spec.Template = desired.Spec.Template
 		needsUpdate = true
 	}
 
 	if needsUpdate {
 		logger.Info("Updating Deployment",
 			"name", existing.Name,
-			"replicas", replicas,
+			"replicas", *desired.Spec.Replicas,
 			"image", webapp.Spec.Image)
 		if err := r.Update(ctx, existing); err != nil {
 			return nil, err
@@ -296,23 +554,83 @@ func (r *WebAppReconciler) reconcileDeployment(ctx context.Context, webapp *weba
 	return existing, nil
 }
 
+// replaceDeployment swaps the Deployment for one with the desired selector
+// without downtime: the old Deployment is deleted orphaning its ReplicaSets, whose
+// Pods keep serving until the new Deployment is ready, when
+// pruneReplacedReplicaSets removes them.
+func (r *WebAppReconciler) replaceDeployment(ctx context.Context, webapp *webappv1.WebApp, existing, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	log.FromContext(ctx).Info("Replacing Deployment with a changed selector", "name", existing.Name)
+	r.event(webapp, corev1.EventTypeNormal, "SelectorChanged",
+		fmt.Sprintf("replacing Deployment %s, whose selector changed", existing.Name))
+	if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationOrphan)); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	desired.Annotations[replacedSelectorAnnotation] = metav1.FormatLabelSelector(existing.Spec.Selector)
+	if err := r.Create(ctx, desired); err != nil {
+		return nil, err
+	}
+	return desired, nil
+}
+
+// pruneReplacedReplicaSets deletes the ReplicaSets orphaned by replaceDeployment
+// once their replacement is ready, then drops the annotation that recorded them.
+// ReplicaSets the new Deployment adopted, or that other Deployments control,
+// are left alone.
+func (r *WebAppReconciler) pruneReplacedReplicaSets(ctx context.Context, dep *appsv1.Deployment, selector string) error {
+	old, err := labels.Parse(selector)
+	if err != nil {
+		return fmt.Errorf("annotation %s: %w", replacedSelectorAnnotation, err)
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := r.List(ctx, replicaSets, client.InNamespace(dep.Namespace), client.MatchingLabelsSelector{Selector: old}); err != nil {
+		return err
+	}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		// The garbage collector drops the reference to the deleted Deployment asynchronously
+		if owner := metav1.GetControllerOf(rs); owner != nil &&
+			(owner.Kind != "Deployment" || owner.Name != dep.Name || owner.UID == dep.UID) {
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting replaced ReplicaSet", "name", rs.Name, "deployment", dep.Name)
+		if err := r.Delete(ctx, rs, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	delete(dep.Annotations, replacedSelectorAnnotation)
+	return r.Update(ctx, dep)
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // reconcileService ensures the Service exists and matches spec.
 // ─────────────────────────────────────────────────────────────────────────────
-func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv1.WebApp) error {
-	logger := log.FromContext(ctx)
+func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv1.WebApp) (err error) {
+	defer metrics.ObserveStep(metrics.StepService, time.Now())
+	ctx, span := tracing.Start(ctx, "reconcileService", webapp)
+	defer func() { tracing.End(span, err) }()
 
-	labels := labelsForWebApp(webapp.Name)
-	svcType := corev1.ServiceType(webapp.Spec.ServiceType)
+	desired := serviceForWebApp(webapp, webapp.Name, corev1.ServiceType(webapp.Spec.ServiceType), serviceSelectorForWebApp(webapp))
+	if err := r.applyService(ctx, webapp, desired); err != nil {
+		return err
+	}
+
+	// BlueGreen additionally exposes the standby color on a preview Service
+	return r.reconcilePreviewService(ctx, webapp)
+}
 
+// serviceForWebApp returns a Service with the given name, type, and Pod selector.
+func serviceForWebApp(webapp *webappv1.WebApp, name string, svcType corev1.ServiceType, selector map[string]string) *corev1.Service {
 	desired := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      webapp.Name,
+			Name:      name,
 			Namespace: webapp.Namespace,
-			Labels:    labels,
+			Labels:    labelsForWebApp(webapp.Name),
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: labels,
+			Selector: selector,
 			Type:     svcType,
 			Ports: []corev1.ServicePort{
 				{
@@ -324,6 +642,21 @@ func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv
 			},
 		},
 	}
+	if monitoringEnabled(webapp) {
+		desired.Spec.Ports = append(desired.Spec.Ports, corev1.ServicePort{
+			Name:       metricsPortName,
+			Port:       exporterPort,
+			TargetPort: intstr.FromString(metricsPortName),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+	return desired
+}
+
+// applyService creates the Service, recreates it when its type changed, or
+// updates its ports and selector when they drifted from desired.
+func (r *WebAppReconciler) applyService(ctx context.Context, webapp *webappv1.WebApp, desired *corev1.Service) error {
+	logger := log.FromContext(ctx)
 
 	if err := ctrl.SetControllerReference(webapp, desired, r.Scheme); err != nil {
 		return err
@@ -339,6 +672,12 @@ func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv
 		return err
 	}
 
+	if drifted := keptDrift(webapp, existing, serviceChanges(desired, existing)); len(drifted) > 0 {
+		logger.Info("Keeping drifted Service fields", "name", existing.Name, "fields", drifted)
+		keepDriftedService(desired, existing, drifted)
+	}
+	svcType := desired.Spec.Type
+
 	// ServiceType is effectively immutable - recreate if changed
 	if existing.Spec.Type != svcType {
 		logger.Info("Recreating Service due to type change",
@@ -346,14 +685,19 @@ func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv
 		if err := r.Delete(ctx, existing); err != nil {
 			return err
 		}
+		metrics.ChildRecreations.WithLabelValues(webapp.Namespace, webapp.Name, "Service").Inc()
 		return r.Create(ctx, desired)
 	}
 
-	// Reconcile port changes
-	if len(existing.Spec.Ports) > 0 && existing.Spec.Ports[0].Port != webapp.Spec.Port {
-		existing.Spec.Ports[0].Port = webapp.Spec.Port
-		existing.Spec.Ports[0].TargetPort = intstr.FromInt32(webapp.Spec.Port)
-		logger.Info("Updating Service port", "name", existing.Name, "port", webapp.Spec.Port)
+	// Reconcile port changes (including the optional metrics port) and the selector.
+	// Both go out in a single update, so a blue/green switch is atomic.
+	portsChanged := servicePortsChanged(desired.Spec.Ports, existing.Spec.Ports)
+	selectorChanged := !equality.Semantic.DeepEqual(desired.Spec.Selector, existing.Spec.Selector)
+	if portsChanged || selectorChanged {
+		existing.Spec.Ports = withAllocatedNodePorts(desired.Spec.Ports, existing.Spec.Ports)
+		existing.Spec.Selector = desired.Spec.Selector
+		logger.Info("Updating Service", "name", existing.Name,
+			"port", webapp.Spec.Port, "selector", desired.Spec.Selector)
 		return r.Update(ctx, existing)
 	}
 
@@ -363,7 +707,11 @@ func (r *WebAppReconciler) reconcileService(ctx context.Context, webapp *webappv
 // ─────────────────────────────────────────────────────────────────────────────
 // updateStatus computes and persists the WebApp status.
 // ─────────────────────────────────────────────────────────────────────────────
-func (r *WebAppReconciler) updateStatus(ctx context.Context, webapp *webappv1.WebApp, deployment *appsv1.Deployment) error {
+func (r *WebAppReconciler) updateStatus(ctx context.Context, webapp *webappv1.WebApp, deployment *appsv1.Deployment, revision int64) (err error) {
+	defer metrics.ObserveStep(metrics.StepStatus, time.Now())
+	ctx, span := tracing.Start(ctx, "updateStatus", webapp)
+	defer func() { tracing.End(span, err) }()
+
 	// Work on a DeepCopy to avoid mutating the cached object
 	updated := webapp.DeepCopy()
 
@@ -374,6 +722,11 @@ func (r *WebAppReconciler) updateStatus(ctx context.Context, webapp *webappv1.We
 	updated.Status.ReadyReplicas = ready
 	updated.Status.DeploymentName = deployment.Name
 	updated.Status.ServiceName = webapp.Name
+	updated.Status.CurrentRevision = revision
+	if restartedAt, err := time.Parse(time.RFC3339, webapp.Annotations[webappv1.AnnotationRestartedAt]); err == nil {
+		t := metav1.NewTime(restartedAt)
+		updated.Status.LastRestartedAt = &t
+	}
 
 	// Populate the in-cluster URL from the Service ClusterIP
 	logger := log.FromContext(ctx)
@@ -413,11 +766,23 @@ func (r *WebAppReconciler) updateStatus(ctx context.Context, webapp *webappv1.We
 	}
 	meta.SetStatusCondition(&updated.Status.Conditions, availableCond)
 
+	// Export the observed state so dashboards can alert on Degraded WebApps
+	metrics.SetPhase(webapp.Namespace, webapp.Name, string(updated.Status.Phase))
+	metrics.DesiredReplicas.WithLabelValues(webapp.Namespace, webapp.Name).Set(float64(webapp.Spec.Replicas))
+	metrics.ReadyReplicas.WithLabelValues(webapp.Namespace, webapp.Name).Set(float64(ready))
+
 	// Only call Status().Update() when something actually changed
 	if updated.Status.Phase != webapp.Status.Phase ||
 		updated.Status.AvailableReplicas != webapp.Status.AvailableReplicas ||
 		updated.Status.ReadyReplicas != webapp.Status.ReadyReplicas ||
+		updated.Status.DeploymentName != webapp.Status.DeploymentName ||
+		updated.Status.CurrentRevision != webapp.Status.CurrentRevision ||
+		!updated.Status.LastRestartedAt.Equal(webapp.Status.LastRestartedAt) ||
 		updated.Status.URL != webapp.Status.URL {
+		if !updated.Status.LastRestartedAt.Equal(webapp.Status.LastRestartedAt) {
+			r.event(webapp, corev1.EventTypeNormal, "Restarted",
+				fmt.Sprintf("Pods restarted at %s", updated.Status.LastRestartedAt.Format(time.RFC3339)))
+		}
 		return r.Status().Update(ctx, updated)
 	}
 
@@ -435,13 +800,112 @@ func (r *WebAppReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ConfigMap{}).
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		// Re-render Markdown content when the ConfigMap it is read from changes
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.webAppsReadingConfigMap)).
 		Complete(r)
 }
 
+// webAppsReadingConfigMap maps a ConfigMap to the WebApps whose Markdown
+// content, current or scheduled, it holds.
+func (r *WebAppReconciler) webAppsReadingConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	webapps := &webappv1.WebAppList{}
+	if err := r.List(ctx, webapps, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Listing WebApps for ConfigMap", "configMap", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range webapps.Items {
+		if readsConfigMap(&webapps.Items[i], obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&webapps.Items[i])})
+		}
+	}
+	return requests
+}
+
+// readsConfigMap reports whether the WebApp renders Markdown from the named ConfigMap.
+func readsConfigMap(webapp *webappv1.WebApp, name string) bool {
+	if md := markdownContent(webapp); md != nil && md.ConfigMapRef != nil && md.ConfigMapRef.Name == name {
+		return true
+	}
+	for _, entry := range webapp.Spec.Schedule {
+		if entry.ContentRef != nil && entry.ContentRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Helpers
 // ─────────────────────────────────────────────────────────────────────────────
 
+// event records a Kubernetes event on the WebApp when a Recorder is configured.
+func (r *WebAppReconciler) event(webapp *webappv1.WebApp, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(webapp, eventType, reason, message)
+	}
+}
+
+// apiReader returns the reader for objects that are not cached.
+func (r *WebAppReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// setCondition persists the condition on the WebApp status when it changed.
+func (r *WebAppReconciler) setCondition(ctx context.Context, webapp *webappv1.WebApp, conditionType string, status metav1.ConditionStatus, reason, message string) error {
+	if cond := meta.FindStatusCondition(webapp.Status.Conditions, conditionType); cond != nil &&
+		cond.Status == status && cond.Reason == reason && cond.Message == message {
+		return nil
+	}
+	meta.SetStatusCondition(&webapp.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: webapp.Generation,
+	})
+	return r.persistStatus(ctx, webapp)
+}
+
+// removeCondition persists the removal of the condition from the WebApp status, if present.
+func (r *WebAppReconciler) removeCondition(ctx context.Context, webapp *webappv1.WebApp, conditionType string) error {
+	if meta.RemoveStatusCondition(&webapp.Status.Conditions, conditionType) {
+		return r.persistStatus(ctx, webapp)
+	}
+	return nil
+}
+
+// persistStatus writes the WebApp status. The response carries the stored
+// spec, so the in-memory spec - possibly held back by a rollout gate - is restored.
+func (r *WebAppReconciler) persistStatus(ctx context.Context, webapp *webappv1.WebApp) error {
+	spec := webapp.DeepCopy().Spec
+	err := r.Status().Update(ctx, webapp)
+	webapp.Spec = spec
+	return err
+}
+
+// updateWebApp applies mutate to the stored WebApp and to the in-memory copy.
+// The stored object is re-read first, so a spec held back by a rollout gate is
+// never written over the user's spec.
+func (r *WebAppReconciler) updateWebApp(ctx context.Context, webapp *webappv1.WebApp, mutate func(*webappv1.WebApp)) error {
+	latest := &webappv1.WebApp{}
+	if err := r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, latest); err != nil {
+		return err
+	}
+	mutate(latest)
+	if err := r.Update(ctx, latest); err != nil {
+		return err
+	}
+	mutate(webapp)
+	webapp.ResourceVersion = latest.ResourceVersion
+	return nil
+}
+
 // labelsForWebApp returns the standard label set applied to all child resources.
 func labelsForWebApp(name string) map[string]string {
 	return map[string]string{
@@ -450,3 +914,57 @@ func labelsForWebApp(name string) map[string]string {
 		"app.kubernetes.io/managed-by": "webapp-operator",
 	}
 }
+
+// stableLabels returns the selector labels of the plain Deployment's Pods. Under
+// Canary they carry the stable track, so the stable selector never matches the
+// canary Pods; the other strategies keep the plain labels and selector.
+func stableLabels(webapp *webappv1.WebApp) map[string]string {
+	labels := labelsForWebApp(webapp.Name)
+	if rolloutStrategy(webapp) == webappv1.RolloutStrategyCanary {
+		labels[trackLabel] = trackStable
+	}
+	return labels
+}
+
+// podTemplateChanged reports whether the existing pod template differs from desired.
+// DeepDerivative ignores fields the API server defaulted, so the slice lengths are
+// compared explicitly to catch removed containers or volumes.
+func podTemplateChanged(desired, existing *corev1.PodTemplateSpec) bool {
+	if len(desired.Spec.Containers) != len(existing.Spec.Containers) ||
+		len(desired.Spec.InitContainers) != len(existing.Spec.InitContainers) ||
+		len(desired.Spec.Volumes) != len(existing.Spec.Volumes) {
+		return true
+	}
+	return !equality.Semantic.DeepDerivative(*desired, *existing)
+}
+
+// servicePortsChanged reports whether the Service ports differ in name, port, target, or protocol.
+func servicePortsChanged(desired, existing []corev1.ServicePort) bool {
+	if len(desired) != len(existing) {
+		return true
+	}
+	for i := range desired {
+		if desired[i].Name != existing[i].Name ||
+			desired[i].Port != existing[i].Port ||
+			desired[i].TargetPort != existing[i].TargetPort ||
+			desired[i].Protocol != existing[i].Protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// withAllocatedNodePorts copies already-allocated NodePorts onto the desired ports
+// with the same name, so updating a NodePort Service does not reshuffle them.
+func withAllocatedNodePorts(desired, existing []corev1.ServicePort) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, len(desired))
+	copy(ports, desired)
+	for i := range ports {
+		for _, e := range existing {
+			if e.Name == ports[i].Name {
+				ports[i].NodePort = e.NodePort
+			}
+		}
+	}
+	return ports
+}
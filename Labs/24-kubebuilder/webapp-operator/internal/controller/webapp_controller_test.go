@@ -1,17 +1,54 @@
 package controller
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	appsv1 "k8s.io/api/apps/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/apimachinery/pkg/util/managedfields/managedfieldstest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	webappv1 "codewizard.io/webapp-operator/api/v1"
+	"codewizard.io/webapp-operator/internal/metrics"
+	"codewizard.io/webapp-operator/internal/upload"
 )
 
 // Test constants
@@ -22,10 +59,116 @@ const (
 	interval            = time.Millisecond * 250
 )
 
+// testScheme returns a scheme with the WebApp and the kinds of its children.
+func testScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	Expect(webappv1.AddToScheme(scheme)).To(Succeed())
+	Expect(appsv1.AddToScheme(scheme)).To(Succeed())
+	Expect(batchv1.AddToScheme(scheme)).To(Succeed())
+	Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+// testClientBuilder returns a fake client builder over testScheme holding
+// objs, with the WebApp status served as a subresource.
+func testClientBuilder(objs ...client.Object) *fake.ClientBuilder {
+	return fake.NewClientBuilder().
+		WithScheme(testScheme()).
+		WithObjects(objs...).
+		WithStatusSubresource(&webappv1.WebApp{})
+}
+
+// newTestReconciler returns a reconciler backed by a fake client holding objs.
+func newTestReconciler(objs ...client.Object) *WebAppReconciler {
+	c := testClientBuilder(objs...).Build()
+	return &WebAppReconciler{Client: c, Scheme: c.Scheme()}
+}
+
+// withManagedFields has the fake client record managedFields the way the API
+// server does: each create and update is attributed to its field owner, the
+// operator's FieldManager unless the write sets another one.
+func withManagedFields(builder *fake.ClientBuilder) *fake.ClientBuilder {
+	record := func(c client.WithWatch, live, obj client.Object, manager string) error {
+		gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+		if err != nil {
+			return err
+		}
+		// The field manager checks the version of both objects
+		live, typed := live.DeepCopyObject().(client.Object), obj.DeepCopyObject().(client.Object)
+		live.GetObjectKind().SetGroupVersionKind(gvk)
+		typed.GetObjectKind().SetGroupVersionKind(gvk)
+		out, err := managedfieldstest.NewFakeFieldManager(managedfields.NewDeducedTypeConverter(), gvk).Update(live, typed, manager)
+		if err != nil {
+			return err
+		}
+		recorded, err := meta.Accessor(out)
+		if err != nil {
+			return err
+		}
+		obj.SetManagedFields(recorded.GetManagedFields())
+		return nil
+	}
+	return builder.WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			options := (&client.CreateOptions{FieldManager: FieldManager}).ApplyOptions(opts)
+			gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+			if err != nil {
+				return err
+			}
+			empty, err := c.Scheme().New(gvk)
+			if err != nil {
+				return err
+			}
+			if err := record(c, empty.(client.Object), obj, options.FieldManager); err != nil {
+				return err
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			options := (&client.UpdateOptions{FieldManager: FieldManager}).ApplyOptions(opts)
+			live := obj.DeepCopyObject().(client.Object)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+				return err
+			}
+			if err := record(c, live, obj, options.FieldManager); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+}
+
 var _ = Describe("WebApp Controller", func() {
 	ctx := context.Background()
 
+	// markReady fakes the Deployment controller reporting every replica ready.
+	markReady := func(r *WebAppReconciler, name string) {
+		dep := &appsv1.Deployment{}
+		Expect(r.Get(ctx, types.NamespacedName{Name: name, Namespace: testWebAppNamespace}, dep)).To(Succeed())
+		want := *dep.Spec.Replicas
+		dep.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: dep.Generation,
+			Replicas:           want,
+			UpdatedReplicas:    want,
+			ReadyReplicas:      want,
+			AvailableReplicas:  want,
+		}
+		Expect(r.Status().Update(ctx, dep)).To(Succeed())
+	}
+
+	// reconcileWebApp runs Reconcile until the WebApp carries its finalizer and
+	// its children are applied.
+	reconcileWebApp := func(r *WebAppReconciler, name string) {
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: testWebAppNamespace}}
+		for i := 0; i < 2; i++ {
+			_, err := r.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
 	Context("When creating a WebApp CR", func() {
+		BeforeEach(requireEnvtest)
+
 		It("should create a Deployment, Service, and ConfigMap", func() {
 			By("Creating the WebApp CR")
 			webapp := &webappv1.WebApp{
@@ -194,4 +337,1890 @@ var _ = Describe("WebApp Controller", func() {
 			}
 		})
 	})
+
+	Context("When exporting operator metrics", func() {
+		It("should report desired replicas and the current phase", func() {
+			By("Reconciling the WebApp")
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "metrics-webapp",
+					Namespace: testWebAppNamespace,
+				},
+				Spec: webappv1.WebAppSpec{
+					Replicas:       3,
+					Image:          "nginx:1.25.3",
+					Message:        "Hello from the metrics test",
+					Port:           80,
+					ServiceType:    "ClusterIP",
+					MaxUnavailable: 1,
+				},
+			}
+			r := newTestReconciler(webapp)
+			reconcileWebApp(r, webapp.Name)
+
+			By("Asserting the desired replicas gauge matches the spec")
+			Expect(testutil.ToFloat64(metrics.DesiredReplicas.WithLabelValues(testWebAppNamespace, webapp.Name))).To(Equal(float64(3)))
+
+			By("Asserting exactly one phase is marked as current")
+			var total float64
+			for _, phase := range []webappv1.WebAppPhase{
+				webappv1.WebAppPhasePending,
+				webappv1.WebAppPhaseRunning,
+				webappv1.WebAppPhaseDegraded,
+				webappv1.WebAppPhaseFailed,
+			} {
+				total += testutil.ToFloat64(metrics.WebAppPhase.WithLabelValues(testWebAppNamespace, webapp.Name, string(phase)))
+			}
+			Expect(total).To(Equal(float64(1)))
+
+			By("Asserting the reconcile steps were timed")
+			Expect(testutil.CollectAndCount(metrics.ReconcileStepDuration)).To(BeNumerically(">=", 4))
+		})
+	})
+
+	Context("When monitoring is enabled", func() {
+		It("should inject the exporter sidecar and expose a metrics port", func() {
+			By("Reconciling a WebApp with monitoring enabled")
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "monitored-webapp",
+					Namespace: testWebAppNamespace,
+				},
+				Spec: webappv1.WebAppSpec{
+					Replicas:       1,
+					Image:          "nginx:1.25.3",
+					Message:        "Hello from the monitoring test",
+					Port:           80,
+					ServiceType:    "ClusterIP",
+					MaxUnavailable: 1,
+					Monitoring: &webappv1.MonitoringSpec{
+						Enabled:       true,
+						ExporterImage: "nginx/nginx-prometheus-exporter:1.1.0",
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			reconcileWebApp(r, webapp.Name)
+			key := types.NamespacedName{Name: webapp.Name, Namespace: testWebAppNamespace}
+
+			By("Checking the Deployment runs nginx and the exporter")
+			containerNames := func() []string {
+				dep := &appsv1.Deployment{}
+				Expect(r.Get(ctx, key, dep)).To(Succeed())
+				var names []string
+				for _, c := range dep.Spec.Template.Spec.Containers {
+					names = append(names, c.Name)
+				}
+				return names
+			}
+			Expect(containerNames()).To(ConsistOf("nginx", "metrics-exporter"))
+
+			By("Checking the Service exposes the metrics port")
+			svc := &corev1.Service{}
+			Expect(r.Get(ctx, key, svc)).To(Succeed())
+			var ports []string
+			for _, p := range svc.Spec.Ports {
+				ports = append(ports, p.Name)
+			}
+			Expect(ports).To(ConsistOf("http", "metrics"))
+
+			By("Checking the generated nginx config enables stub_status")
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-nginx", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+			Expect(cm.Data["default.conf"]).To(ContainSubstring("stub_status"))
+
+			By("Disabling monitoring and checking the sidecar is removed")
+			Expect(r.Get(ctx, key, webapp)).To(Succeed())
+			webapp.Spec.Monitoring.Enabled = false
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			reconcileWebApp(r, webapp.Name)
+			Expect(containerNames()).To(ConsistOf("nginx"))
+		})
+	})
+
+	Context("When tracing reconciles", func() {
+		var exporter *tracetest.InMemoryExporter
+
+		BeforeEach(func() {
+			exporter = tracetest.NewInMemoryExporter()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		})
+
+		It("should record a span for every reconcile step", func() {
+			By("Reconciling the WebApp")
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "traced-webapp",
+					Namespace: testWebAppNamespace,
+				},
+				Spec: webappv1.WebAppSpec{
+					Replicas:       1,
+					Image:          "nginx:1.25.3",
+					Message:        "Hello from the tracing test",
+					Port:           80,
+					ServiceType:    "ClusterIP",
+					MaxUnavailable: 1,
+				},
+			}
+			r := newTestReconciler(webapp)
+			reconcileWebApp(r, webapp.Name)
+
+			By("Asserting the spans carry the WebApp identity")
+			var names []string
+			for _, span := range exporter.GetSpans() {
+				for _, attr := range span.Attributes {
+					if attr.Key == "webapp.name" && attr.Value.AsString() == webapp.Name {
+						names = append(names, span.Name)
+					}
+				}
+			}
+			Expect(names).To(ContainElements(
+				"Reconcile",
+				"reconcileConfigMap",
+				"reconcileDeployment",
+				"reconcileService",
+				"updateStatus",
+			))
+		})
+
+		AfterEach(func() {
+			otel.SetTracerProvider(noop.NewTracerProvider())
+		})
+	})
+
+	Context("When running cleanup hooks on deletion", func() {
+		// newDeletingReconciler returns a reconciler backed by a fake client that
+		// holds a WebApp already marked for deletion.
+		newDeletingReconciler := func(annotations map[string]string, hooks ...Finalizer) (*WebAppReconciler, *webappv1.WebApp) {
+
+			deletedAt := metav1.Now()
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "finalized-webapp",
+					Namespace:         testWebAppNamespace,
+					Annotations:       annotations,
+					Finalizers:        []string{webappFinalizer},
+					DeletionTimestamp: &deletedAt,
+				},
+				Spec: webappv1.WebAppSpec{Replicas: 1, Image: "nginx:1.25.3", Message: "bye"},
+			}
+			r := newTestReconciler(webapp)
+			r.Finalizers = hooks
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, webapp)).To(Succeed())
+			return r, webapp
+		}
+
+		It("should run hooks in order and stop at the first failure", func() {
+			var calls []string
+			first := FinalizerFunc{HookName: "dns", Fn: func(context.Context, *webappv1.WebApp) error {
+				calls = append(calls, "dns")
+				return nil
+			}}
+			second := FinalizerFunc{HookName: "registry", Fn: func(context.Context, *webappv1.WebApp) error {
+				calls = append(calls, "registry")
+				return errors.New("registry unavailable")
+			}}
+			third := FinalizerFunc{HookName: "archive", Fn: func(context.Context, *webappv1.WebApp) error {
+				calls = append(calls, "archive")
+				return nil
+			}}
+			r, webapp := newDeletingReconciler(nil, first, second, third)
+
+			requeue, err := r.runFinalizers(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(Equal(finalizerBaseBackoff))
+			Expect(calls).To(Equal([]string{"dns", "registry"}))
+			Expect(webapp.Status.Finalizers).To(HaveLen(2))
+			Expect(webapp.Status.Finalizers[0].State).To(Equal(webappv1.FinalizerHookSucceeded))
+			Expect(webapp.Status.Finalizers[1].State).To(Equal(webappv1.FinalizerHookFailed))
+			Expect(webapp.Status.Finalizers[1].Message).To(Equal("registry unavailable"))
+
+			By("Retrying only the hooks that have not succeeded yet")
+			calls = nil
+			requeue, err = r.runFinalizers(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(Equal(2 * finalizerBaseBackoff))
+			Expect(calls).To(Equal([]string{"registry"}))
+		})
+
+		It("should skip pending hooks when the escape-hatch annotation is set", func() {
+			hook := FinalizerFunc{HookName: "stuck", Fn: func(context.Context, *webappv1.WebApp) error {
+				Fail("hook must not run when skipped")
+				return nil
+			}}
+			r, webapp := newDeletingReconciler(map[string]string{webappv1.AnnotationSkipFinalizers: "true"}, hook)
+
+			requeue, err := r.runFinalizers(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(BeZero())
+			Expect(webapp.Status.Finalizers).To(ConsistOf(HaveField("State", webappv1.FinalizerHookSkipped)))
+		})
+
+		It("should drop the metric series with the built-in hook", func() {
+			r, webapp := newDeletingReconciler(nil, ForgetMetrics)
+			metrics.DesiredReplicas.WithLabelValues(webapp.Namespace, webapp.Name).Set(2)
+
+			_, err := r.runFinalizers(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Status.Finalizers).To(ConsistOf(HaveField("State", webappv1.FinalizerHookSucceeded)))
+			Expect(metrics.DesiredReplicas.DeleteLabelValues(webapp.Namespace, webapp.Name)).To(BeFalse())
+		})
+
+		It("should cap the retry backoff", func() {
+			Expect(finalizerBackoff(1)).To(Equal(finalizerBaseBackoff))
+			Expect(finalizerBackoff(3)).To(Equal(4 * finalizerBaseBackoff))
+			Expect(finalizerBackoff(100)).To(Equal(finalizerMaxBackoff))
+		})
+	})
+
+	Context("When applying the deletion policy", func() {
+		// newPolicyReconciler returns a reconciler backed by a fake client that holds
+		// a WebApp with the given policy and a controlled Deployment and Service.
+		newPolicyReconciler := func(policy webappv1.DeletionPolicy) (*WebAppReconciler, *webappv1.WebApp) {
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "retained-webapp",
+					Namespace: testWebAppNamespace,
+					UID:       "retained-webapp-uid",
+				},
+				Spec: webappv1.WebAppSpec{DeletionPolicy: policy},
+			}
+			meta := func() metav1.ObjectMeta {
+				return metav1.ObjectMeta{
+					Name:      webapp.Name,
+					Namespace: webapp.Namespace,
+					Labels:    labelsForWebApp(webapp.Name),
+				}
+			}
+			dep := &appsv1.Deployment{ObjectMeta: meta()}
+			svc := &corev1.Service{ObjectMeta: meta()}
+			claim := &corev1.PersistentVolumeClaim{ObjectMeta: meta()}
+			claim.Name = webapp.Name + "-content"
+			scheme := testScheme()
+			Expect(ctrl.SetControllerReference(webapp, dep, scheme)).To(Succeed())
+			Expect(ctrl.SetControllerReference(webapp, svc, scheme)).To(Succeed())
+			Expect(ctrl.SetControllerReference(webapp, claim, scheme)).To(Succeed())
+
+			return newTestReconciler(webapp, dep, svc, claim), webapp
+		}
+
+		It("should release only the Service with RetainService", func() {
+			r, webapp := newPolicyReconciler(webappv1.DeletionPolicyRetainService)
+			Expect(r.applyDeletionPolicy(ctx, webapp)).To(Succeed())
+
+			key := types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}
+			svc := &corev1.Service{}
+			Expect(r.Get(ctx, key, svc)).To(Succeed())
+			Expect(svc.OwnerReferences).To(BeEmpty())
+			Expect(svc.Labels).NotTo(HaveKey("app.kubernetes.io/managed-by"))
+			Expect(svc.Labels).To(HaveKeyWithValue("app.kubernetes.io/instance", webapp.Name))
+
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(metav1.IsControlledBy(dep, webapp)).To(BeTrue())
+		})
+
+		It("should release every child with Orphan", func() {
+			r, webapp := newPolicyReconciler(webappv1.DeletionPolicyOrphan)
+			Expect(r.applyDeletionPolicy(ctx, webapp)).To(Succeed())
+
+			key := types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(dep.OwnerReferences).To(BeEmpty())
+			svc := &corev1.Service{}
+			Expect(r.Get(ctx, key, svc)).To(Succeed())
+			Expect(svc.OwnerReferences).To(BeEmpty())
+			claim := &corev1.PersistentVolumeClaim{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-content", Namespace: webapp.Namespace}, claim)).To(Succeed())
+			Expect(claim.OwnerReferences).To(BeEmpty())
+		})
+
+		It("should leave every child owned with Delete", func() {
+			r, webapp := newPolicyReconciler(webappv1.DeletionPolicyDelete)
+			Expect(r.applyDeletionPolicy(ctx, webapp)).To(Succeed())
+
+			svc := &corev1.Service{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, svc)).To(Succeed())
+			Expect(metav1.IsControlledBy(svc, webapp)).To(BeTrue())
+		})
+	})
+
+	Context("When rolling out with BlueGreen", func() {
+		It("should switch traffic only once the new color is ready", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "bluegreen-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 2,
+					Image:    "nginx:1.25.3",
+					Message:  "v1",
+					Port:     80,
+					Rollout: &webappv1.RolloutSpec{
+						Strategy:  webappv1.RolloutStrategyBlueGreen,
+						BlueGreen: &webappv1.BlueGreenStrategy{ScaleDownDelaySeconds: 60},
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			blue, green := webapp.Name+"-blue", webapp.Name+"-green"
+
+			By("Bringing up the first version on blue")
+			_, _, err := r.reconcileBlueGreen(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Status.Rollout.ActiveColor).To(BeEmpty())
+			markReady(r, blue)
+			_, requeue, err := r.reconcileBlueGreen(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(BeZero())
+			Expect(webapp.Status.Rollout.ActiveColor).To(Equal(colorBlue))
+			Expect(serviceSelectorForWebApp(webapp)).To(HaveKeyWithValue(colorLabel, colorBlue))
+
+			By("Bringing up a new message on green while blue keeps serving")
+			webapp.Spec.Message = "v2"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			active, _, err := r.reconcileBlueGreen(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(active.Name).To(Equal(blue))
+			Expect(webapp.Status.Rollout.ActiveColor).To(Equal(colorBlue))
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: green + "-html", Namespace: webapp.Namespace}, cm)).To(Succeed())
+			Expect(cm.Data["index.html"]).To(ContainSubstring("v2"))
+			Expect(r.Get(ctx, types.NamespacedName{Name: blue + "-html", Namespace: webapp.Namespace}, cm)).To(Succeed())
+			Expect(cm.Data["index.html"]).To(ContainSubstring("v1"))
+
+			By("Switching to green once it is ready")
+			markReady(r, green)
+			active, requeue, err = r.reconcileBlueGreen(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(active.Name).To(Equal(green))
+			Expect(requeue).To(Equal(60 * time.Second))
+			Expect(webapp.Status.Rollout.ActiveColor).To(Equal(colorGreen))
+			Expect(webapp.Status.Rollout.PreviewColor).To(Equal(colorBlue))
+			Expect(webapp.Status.Rollout.ScaleDownAt).NotTo(BeNil())
+
+			By("Scaling blue down after the delay")
+			past := metav1.NewTime(time.Now().Add(-time.Second))
+			webapp.Status.Rollout.ScaleDownAt = &past
+			_, _, err = r.reconcileBlueGreen(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: blue, Namespace: webapp.Namespace}, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(BeZero())
+			Expect(webapp.Status.Rollout.ScaleDownAt).To(BeNil())
+		})
+	})
+
+	Context("When rolling out with Canary", func() {
+		It("should shift replicas step by step and honour manual gates and aborts", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "canary-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 4,
+					Image:    "nginx:1.25.3",
+					Message:  "v1",
+					Port:     80,
+					Rollout: &webappv1.RolloutSpec{
+						Strategy: webappv1.RolloutStrategyCanary,
+						Canary: &webappv1.CanaryStrategy{Steps: []webappv1.CanaryStep{
+							{Weight: 25, Manual: true},
+							{Weight: 50, Pause: "1h"},
+						}},
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			stable, canary := webapp.Name, webapp.Name+"-canary"
+			replicasOf := func(name string) int32 {
+				dep := &appsv1.Deployment{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, dep)).To(Succeed())
+				return *dep.Spec.Replicas
+			}
+
+			By("Deploying the first version straight to stable")
+			_, _, err := r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			markReady(r, stable)
+			_, _, err = r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Status.Rollout).To(BeNil())
+
+			By("Starting a canary at 25% for a new message")
+			webapp.Spec.Message = "v2"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicasOf(canary)).To(Equal(int32(1)))
+			Expect(replicasOf(stable)).To(Equal(int32(4)))
+			markReady(r, canary)
+			_, requeue, err := r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(BeZero())
+			Expect(replicasOf(stable)).To(Equal(int32(3)))
+			Expect(*webapp.Status.Rollout.CurrentStep).To(BeZero())
+			Expect(webapp.Status.Rollout.CanaryWeight).To(Equal(int32(25)))
+
+			By("Passing the manual gate with the promote annotation")
+			webapp.Annotations = map[string]string{webappv1.AnnotationPromoteCanary: "true"}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Annotations).NotTo(HaveKey(webappv1.AnnotationPromoteCanary))
+			Expect(*webapp.Status.Rollout.CurrentStep).To(Equal(int32(1)))
+			Expect(replicasOf(canary)).To(Equal(int32(2)))
+			markReady(r, canary)
+			_, requeue, err = r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeue).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(replicasOf(stable)).To(Equal(int32(2)))
+
+			By("Aborting the rollout")
+			webapp.Annotations = map[string]string{webappv1.AnnotationAbortRollout: "true"}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileCanary(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Status.Rollout.Aborted).To(BeTrue())
+			Expect(replicasOf(stable)).To(Equal(int32(4)))
+			Expect(r.Get(ctx, types.NamespacedName{Name: canary, Namespace: webapp.Namespace}, &appsv1.Deployment{})).NotTo(Succeed())
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: stable + "-html", Namespace: webapp.Namespace}, cm)).To(Succeed())
+			Expect(cm.Data["index.html"]).To(ContainSubstring("v1"))
+		})
+
+		It("should adopt a RollingUpdate Deployment only when its content matches too", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "switched-canary-webapp", Namespace: testWebAppNamespace},
+				Spec:       webappv1.WebAppSpec{Replicas: 2, Image: "nginx:1.25.3", Message: "v1", Port: 80},
+			}
+			r := newTestReconciler(webapp)
+			Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+			stable, err := r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Adopting the Deployment when template and content match")
+			webapp.Spec.Rollout = &webappv1.RolloutSpec{
+				Strategy: webappv1.RolloutStrategyCanary,
+				Canary:   &webappv1.CanaryStrategy{Steps: []webappv1.CanaryStep{{Weight: 50, Manual: true}}},
+			}
+			adopted, err := r.stableRuns(ctx, stable, webapp, rolloutHash(webapp))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(adopted).To(BeTrue())
+
+			By("Rolling a canary when only the content changed with the switch")
+			webapp.Spec.Message = "v2"
+			adopted, err = r.stableRuns(ctx, stable, webapp, rolloutHash(webapp))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(adopted).To(BeFalse())
+		})
+
+		It("should keep each track's selector clear of the others' Pods", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "selector-webapp", Namespace: testWebAppNamespace},
+				Spec:       webappv1.WebAppSpec{Replicas: 2, Image: "nginx:1.25.3", Message: "hi", Port: 80},
+			}
+
+			By("Keeping the plain selector outside Canary")
+			Expect(stableLabels(webapp)).To(Equal(labelsForWebApp(webapp.Name)))
+
+			By("Selecting no Pod of another track or color under Canary")
+			webapp.Spec.Rollout = &webappv1.RolloutSpec{
+				Strategy: webappv1.RolloutStrategyCanary,
+				Canary:   &webappv1.CanaryStrategy{Steps: []webappv1.CanaryStep{{Weight: 50, Manual: true}}},
+			}
+			selectors := []map[string]string{
+				stableLabels(webapp),
+				colorLabels(webapp, colorBlue),
+				colorLabels(webapp, colorGreen),
+			}
+			canary := labelsForWebApp(webapp.Name)
+			canary[trackLabel] = trackCanary
+			selectors = append(selectors, canary)
+			for i, selector := range selectors {
+				for j, pod := range selectors {
+					Expect(labels.SelectorFromSet(selector).Matches(labels.Set(pod))).To(Equal(i == j))
+				}
+			}
+
+			By("Replacing a Deployment created with another selector, orphaning its Pods")
+			scheme := testScheme()
+			legacy := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 2)
+			Expect(ctrl.SetControllerReference(webapp, legacy, scheme)).To(Succeed())
+			orphaned := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name: webapp.Name + "-5d9c", Namespace: webapp.Namespace, Labels: labelsForWebApp(webapp.Name),
+			}}
+			canaryRS := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name: webapp.Name + "-canary-7f4b", Namespace: webapp.Namespace, Labels: canary,
+			}}
+			canaryDep := deploymentForWebApp(webapp, webapp.Name+"-"+trackCanary, canary, 1)
+			canaryDep.UID = "canary-uid"
+			Expect(ctrl.SetControllerReference(canaryDep, canaryRS, scheme)).To(Succeed())
+			r := newTestReconciler(webapp, legacy, orphaned, canaryRS)
+			stable, err := r.applyStable(ctx, webapp, rolloutHash(webapp))
+			Expect(err).NotTo(HaveOccurred())
+			live := &appsv1.Deployment{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(stable), live)).To(Succeed())
+			Expect(live.Spec.Selector.MatchLabels).To(HaveKeyWithValue(trackLabel, trackStable))
+			Expect(live.Annotations).To(HaveKey(replacedSelectorAnnotation))
+
+			By("Keeping the orphaned ReplicaSet until its replacement is ready")
+			_, err = r.applyStable(ctx, webapp, rolloutHash(webapp))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(orphaned), &appsv1.ReplicaSet{})).To(Succeed())
+
+			By("Pruning it, and only it, once the new Deployment is ready")
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(stable), live)).To(Succeed())
+			live.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2}
+			Expect(r.Status().Update(ctx, live)).To(Succeed())
+			_, err = r.applyStable(ctx, webapp, rolloutHash(webapp))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(r.Get(ctx, client.ObjectKeyFromObject(orphaned), &appsv1.ReplicaSet{}))).To(BeTrue())
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(canaryRS), &appsv1.ReplicaSet{})).To(Succeed())
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(stable), live)).To(Succeed())
+			Expect(live.Annotations).NotTo(HaveKey(replacedSelectorAnnotation))
+		})
+	})
+
+	Context("When recording revisions", func() {
+		It("should snapshot each spec, roll back on request, and prune old revisions", func() {
+			limit := int32(1)
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "revisioned-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas:             2,
+					Image:                "nginx:1.25.3",
+					Message:              "v1",
+					Port:                 80,
+					RevisionHistoryLimit: &limit,
+				},
+			}
+			r := newTestReconciler(webapp)
+
+			By("Recording a revision per distinct spec")
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(1)))
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(1)))
+			webapp.Spec.Message = "v2"
+			webapp.Spec.Image = "nginx:1.26.0"
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(2)))
+
+			By("Leaving scaling out of revisions")
+			webapp.Spec.Replicas = 5
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(2)))
+
+			By("Restoring revision 1 through spec.rollbackTo")
+			target := int64(1)
+			webapp.Spec.RollbackTo = &target
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.rollback(ctx, webapp)).To(BeTrue())
+			Expect(webapp.Spec.Message).To(Equal("v1"))
+			Expect(webapp.Spec.Image).To(Equal("nginx:1.25.3"))
+			Expect(webapp.Spec.Replicas).To(Equal(int32(5)))
+			Expect(webapp.Spec.RollbackTo).To(BeNil())
+
+			By("Renumbering the restored revision as the newest")
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(3)))
+
+			By("Pruning beyond the history limit")
+			webapp.Spec.Message = "v3"
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(4)))
+			revisions, err := r.listRevisions(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revisions).To(HaveLen(2))
+			Expect(revisions[0].Revision).To(Equal(int64(3)))
+
+			By("Rejecting an unknown revision from the annotation")
+			webapp.Annotations = map[string]string{webappv1.AnnotationRollbackTo: "1"}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.rollback(ctx, webapp)).To(BeTrue())
+			Expect(webapp.Spec.Message).To(Equal("v3"))
+			Expect(webapp.Annotations).NotTo(HaveKey(webappv1.AnnotationRollbackTo))
+		})
+
+		It("should record a spec only once it has rolled out", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "rolling-webapp", Namespace: testWebAppNamespace},
+				Spec:       webappv1.WebAppSpec{Replicas: 1, Image: "nginx:1.25.3", Message: "v1", Port: 80},
+			}
+			r := newTestReconciler(webapp)
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(1)))
+			webapp.Status.CurrentRevision = 1
+
+			By("Keeping the previous revision current while the new spec rolls out")
+			webapp.Spec.Message = "v2"
+			deployment := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 1)
+			deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 0, ReadyReplicas: 1, AvailableReplicas: 1}
+			Expect(r.recordRevision(ctx, webapp, webapp, deployment)).To(Equal(int64(1)))
+			revisions, err := r.listRevisions(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revisions).To(HaveLen(1))
+
+			By("Recording the new spec once every replica runs it")
+			deployment.Status.UpdatedReplicas = 1
+			Expect(r.recordRevision(ctx, webapp, webapp, deployment)).To(Equal(int64(2)))
+		})
+	})
+
+	Context("When smoke-testing a rollout", func() {
+		It("should run the checks in a Job and roll back when they fail", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "tested-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1,
+					Image:    "nginx:1.25.3",
+					Message:  "v1",
+					Port:     8080,
+					Tests: &webappv1.TestsSpec{
+						Image:             "curlimages/curl:8.5.0",
+						RollbackOnFailure: true,
+						Checks: []webappv1.HTTPCheck{
+							{Path: "/", ExpectedStatus: 200, BodyContains: "v2"},
+						},
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(1)))
+			webapp.Spec.Message = "v2"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(2)))
+
+			deployment := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 1)
+			deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+
+			By("Waiting for the rollout before testing")
+			deployment.Status.ReadyReplicas = 0
+			Expect(r.reconcileTests(ctx, webapp, deployment, 2)).To(Succeed())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeTestsPassed).Reason).To(Equal("RolloutInProgress"))
+
+			By("Waiting for the Pods to serve the current content")
+			deployment.Status.ReadyReplicas = 1
+			served := webapp.DeepCopy()
+			served.Spec.Message = "v1"
+			current := deployment.Spec.Template
+			deployment.Spec.Template = deploymentForWebApp(served, webapp.Name, labelsForWebApp(webapp.Name), 1).Spec.Template
+			Expect(r.reconcileTests(ctx, webapp, deployment, 2)).To(Succeed())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeTestsPassed).Reason).To(Equal("RolloutInProgress"))
+			Expect(r.Get(ctx, types.NamespacedName{Name: "tested-webapp-tests-2", Namespace: webapp.Namespace}, &batchv1.Job{})).
+				To(Satisfy(apierrors.IsNotFound))
+
+			By("Starting a test Job once the rollout completed")
+			deployment.Spec.Template = current
+			Expect(r.reconcileTests(ctx, webapp, deployment, 2)).To(Succeed())
+			job := &batchv1.Job{}
+			jobKey := types.NamespacedName{Name: "tested-webapp-tests-2", Namespace: webapp.Namespace}
+			Expect(r.Get(ctx, jobKey, job)).To(Succeed())
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "CHECK_0_URL", Value: "http://tested-webapp.default.svc:8080/"}))
+			Expect(container.Command[2]).To(ContainSubstring(`check "$CHECK_0_URL"`))
+			Expect(job.Spec.Template.Labels).NotTo(HaveKey("app.kubernetes.io/name"))
+
+			By("Rolling back to the previous revision when the Job fails")
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+			Expect(r.Status().Update(ctx, job)).To(Succeed())
+			Expect(r.reconcileTests(ctx, webapp, deployment, 2)).To(Succeed())
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeTestsPassed)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(webapp.Spec.RollbackTo).To(HaveValue(Equal(int64(1))))
+			revisions, err := r.listRevisions(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(revisions[1].Annotations).To(HaveKeyWithValue(testsFailedAnnotation, "true"))
+		})
+	})
+
+	Context("When restarting through the restartedAt annotation", func() {
+		It("should stamp the pod template and record the restart time", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "restarted-webapp",
+					Namespace:   testWebAppNamespace,
+					Annotations: map[string]string{webappv1.AnnotationRestartedAt: "2024-05-01T10:00:00Z"},
+				},
+				Spec: webappv1.WebAppSpec{Replicas: 1, Image: "nginx:1.25.3", Message: "hi", Port: 80},
+			}
+			dep := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 1)
+			Expect(dep.Spec.Template.Annotations).To(HaveKeyWithValue(webappv1.AnnotationRestartedAt, "2024-05-01T10:00:00Z"))
+
+			r := newTestReconciler(webapp)
+			Expect(r.updateStatus(ctx, webapp, dep, 1)).To(Succeed())
+
+			updated := &webappv1.WebApp{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, updated)).To(Succeed())
+			Expect(updated.Status.LastRestartedAt).NotTo(BeNil())
+			Expect(updated.Status.LastRestartedAt.UTC()).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+		})
+
+		It("should restart the live Deployments in place rather than start a rollout", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "restarted-bluegreen", Namespace: testWebAppNamespace},
+				Spec:       webappv1.WebAppSpec{Replicas: 1, Image: "nginx:1.25.3", Message: "hi", Port: 80},
+			}
+			hash := rolloutHash(webapp)
+			active := deploymentForWebApp(webapp, colorDeploymentName(webapp, colorBlue), colorLabels(webapp, colorBlue), 1)
+			r := newTestReconciler(active)
+
+			By("Keeping the restart timestamp out of the rollout hash")
+			webapp.Annotations = map[string]string{webappv1.AnnotationRestartedAt: "2024-05-01T10:00:00Z"}
+			Expect(rolloutHash(webapp)).To(Equal(hash))
+
+			By("Stamping the timestamp on a Deployment the rollout leaves alone")
+			Expect(r.restartDeployment(ctx, webapp, active)).To(Succeed())
+			live := &appsv1.Deployment{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(active), live)).To(Succeed())
+			Expect(live.Spec.Template.Annotations).To(HaveKeyWithValue(webappv1.AnnotationRestartedAt, "2024-05-01T10:00:00Z"))
+		})
+	})
+
+	Context("When gating rollouts", func() {
+		It("should open windows on schedule and hold new revisions until allowed", func() {
+			By("Evaluating a weekday window in its time zone")
+			window := webappv1.RolloutWindow{Schedule: "0 22 * * 1-5", Duration: "2h", TimeZone: "Europe/Berlin"}
+			berlin, err := time.LoadLocation("Europe/Berlin")
+			Expect(err).NotTo(HaveOccurred())
+			open, _, err := windowState(window, time.Date(2024, 5, 6, 23, 30, 0, 0, berlin)) // Monday
+			Expect(err).NotTo(HaveOccurred())
+			Expect(open).To(BeTrue())
+			open, opens, err := windowState(window, time.Date(2024, 5, 4, 12, 0, 0, 0, berlin)) // Saturday
+			Expect(err).NotTo(HaveOccurred())
+			Expect(open).To(BeFalse())
+			Expect(opens.Equal(time.Date(2024, 5, 6, 22, 0, 0, 0, berlin))).To(BeTrue())
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "gated-webapp", Namespace: testWebAppNamespace, Generation: 2},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1,
+					Image:    "nginx:1.25.3",
+					Message:  "v1",
+					Port:     80,
+					Rollout:  &webappv1.RolloutSpec{RequireApproval: true},
+				},
+			}
+			r := newTestReconciler(webapp)
+			Expect(r.reconcileRevision(ctx, webapp)).To(Equal(int64(1)))
+
+			By("Holding an unapproved change on the applied spec, but not its scaling")
+			webapp.Spec.Message = "v2"
+			webapp.Spec.Replicas = 3
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			held, requeueAfter, err := r.gateRollout(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(held.Spec.Message).To(Equal("v1"))
+			Expect(held.Spec.Replicas).To(Equal(int32(3)))
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeRolloutBlocked)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal("AwaitingApproval"))
+
+			By("Releasing the change once its generation is approved")
+			webapp.Annotations = map[string]string{webappv1.AnnotationApprovedGeneration: "2"}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			held, _, err = r.gateRollout(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(held.Spec.Message).To(Equal("v2"))
+			Expect(meta.IsStatusConditionFalse(webapp.Status.Conditions, webappv1.ConditionTypeRolloutBlocked)).To(BeTrue())
+
+			By("Requeueing until the next window when none is open")
+			webapp.Spec.Rollout = &webappv1.RolloutSpec{Windows: []webappv1.RolloutWindow{
+				{Schedule: fmt.Sprintf("0 %d * * *", (time.Now().UTC().Hour()+2)%24), Duration: "30m", TimeZone: "UTC"},
+			}}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			held, requeueAfter, err = r.gateRollout(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(held.Spec.Message).To(Equal("v1"))
+			Expect(requeueAfter).To(BeNumerically(">", time.Hour))
+			Expect(requeueAfter).To(BeNumerically("<=", 2*time.Hour))
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeRolloutBlocked).Reason).To(Equal("OutsideWindow"))
+		})
+	})
+
+	Context("When paused", func() {
+		It("should report what resuming would change without touching the children", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "paused-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas:    2,
+					Image:       "nginx:1.25.3",
+					Message:     "v1",
+					Port:        80,
+					ServiceType: "ClusterIP",
+				},
+			}
+			r := newTestReconciler(webapp)
+			Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+			_, err := r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.reconcileService(ctx, webapp)).To(Succeed())
+
+			By("Reporting no changes while the children match the spec")
+			webapp.Spec.Paused = true
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.reportPendingChanges(ctx, webapp)).To(Succeed())
+			Expect(webapp.Status.PendingChanges).To(BeEmpty())
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypePaused)).To(BeTrue())
+
+			By("Listing the changed fields per child")
+			servedHash := contentHash(webapp)
+			webapp.Spec.Replicas = 3
+			webapp.Spec.Image = "nginx:1.26.0"
+			webapp.Spec.Message = "v2"
+			webapp.Spec.ServiceType = "NodePort"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.reportPendingChanges(ctx, webapp)).To(Succeed())
+			Expect(webapp.Status.PendingChanges).To(ConsistOf(
+				webappv1.PendingChange{Kind: "ConfigMap", Name: "paused-webapp-html", Action: "Update",
+					Fields: []string{"data[index.html]: changed"}},
+				webappv1.PendingChange{Kind: "Deployment", Name: "paused-webapp", Action: "Update",
+					Fields: []string{"spec.replicas: 2 -> 3", "spec.template.spec.containers[nginx].image: nginx:1.25.3 -> nginx:1.26.0",
+						"spec.template.metadata.annotations[" + contentHashAnnotation + "]: " + servedHash + " -> " + contentHash(webapp)}},
+				webappv1.PendingChange{Kind: "Service", Name: "paused-webapp", Action: "Update",
+					Fields: []string{"spec.type: ClusterIP -> NodePort"}},
+			))
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(Equal(int32(2)))
+
+			By("Clearing the report on resume")
+			Expect(r.clearPendingChanges(ctx, webapp)).To(Succeed())
+			Expect(webapp.Status.PendingChanges).To(BeEmpty())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypePaused)).To(BeNil())
+		})
+	})
+
+	Context("When reporting drift", func() {
+		It("should leave fields written by other managers in place and report who wrote them", func() {
+			Expect(managedPath("spec.template.spec.containers[nginx].image: a -> b")).To(Equal(
+				[]string{"f:spec", "f:template", "f:spec", "f:containers", `k:{"name":"nginx"}`, "f:image"}))
+			Expect(managedPath("data[index.html]: changed")).To(Equal([]string{"f:data", "f:index.html"}))
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "drifting-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas:    2,
+					Image:       "nginx:1.25.3",
+					Message:     "hi",
+					Port:        80,
+					ServiceType: "ClusterIP",
+					DriftPolicy: webappv1.DriftPolicyReport,
+				},
+			}
+			c := withManagedFields(testClientBuilder(webapp)).Build()
+			r := &WebAppReconciler{Client: c, Scheme: c.Scheme()}
+			_, err := r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Scaling the Deployment out-of-band")
+			key := types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			five := int32(5)
+			dep.Spec.Replicas = &five
+			Expect(r.Update(ctx, dep, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+			By("Keeping the edit and reporting it")
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(Equal(int32(5)))
+			Expect(r.reconcileDrift(ctx, webapp)).To(Succeed())
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeDrifted)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("Deployment drifting-webapp: spec.replicas: 5 -> 2 (by kubectl-edit)"))
+			Expect(testutil.ToFloat64(metrics.DriftedFields.WithLabelValues(webapp.Namespace, webapp.Name, "Deployment"))).To(Equal(1.0))
+
+			By("Applying the other changes around the drifted field")
+			webapp.Spec.Image = "nginx:1.25.4"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(Equal(int32(5)))
+			Expect(dep.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25.4"))
+
+			By("Restoring the desired state under Enforce")
+			webapp.Spec.DriftPolicy = webappv1.DriftPolicyEnforce
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(*dep.Spec.Replicas).To(Equal(int32(2)))
+			Expect(r.reconcileDrift(ctx, webapp)).To(Succeed())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeDrifted)).To(BeNil())
+		})
+	})
+
+	Context("When a child's name is already taken", func() {
+		It("should refuse unowned resources unless adoption is requested", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "colliding-webapp", Namespace: testWebAppNamespace, UID: "webapp-uid"},
+				Spec:       webappv1.WebAppSpec{Replicas: 1, Image: "nginx:1.25.3", Message: "hi", Port: 80},
+			}
+			foreign := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "colliding-webapp-html", Namespace: testWebAppNamespace},
+				Data:       map[string]string{"index.html": "someone else's page"},
+			}
+			r := newTestReconciler(webapp, foreign)
+
+			By("Reporting the conflict and leaving the resource alone")
+			conflicted, err := r.reconcileOwnership(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflicted).To(BeTrue())
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeNameConflict)
+			Expect(cond.Message).To(ContainSubstring("ConfigMap colliding-webapp-html exists and is not owned by the WebApp"))
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(foreign), cm)).To(Succeed())
+			Expect(cm.OwnerReferences).To(BeEmpty())
+
+			By("Adopting it once requested")
+			webapp.Spec.AdoptionPolicy = webappv1.AdoptionPolicyAdopt
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			conflicted, err = r.reconcileOwnership(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflicted).To(BeFalse())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeNameConflict)).To(BeNil())
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(foreign), cm)).To(Succeed())
+			Expect(metav1.IsControlledBy(cm, webapp)).To(BeTrue())
+		})
+
+		It("should refuse an unowned claim named like the volume claim", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "claiming-webapp", Namespace: testWebAppNamespace, UID: "webapp-uid"},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80,
+					Source: &webappv1.SourceSpec{Volume: &webappv1.VolumeSource{
+						ClaimTemplate: &webappv1.VolumeClaimTemplate{Size: resource.MustParse("1Gi"), AccessMode: corev1.ReadWriteOnce},
+					}},
+				},
+			}
+			foreign := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "claiming-webapp-content", Namespace: testWebAppNamespace},
+			}
+			r := newTestReconciler(webapp, foreign)
+
+			conflicted, err := r.reconcileOwnership(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflicted).To(BeTrue())
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeNameConflict)
+			Expect(cond.Message).To(ContainSubstring("PersistentVolumeClaim claiming-webapp-content exists and is not owned by the WebApp"))
+			claim := &corev1.PersistentVolumeClaim{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(foreign), claim)).To(Succeed())
+			Expect(claim.OwnerReferences).To(BeEmpty())
+		})
+	})
+
+	Context("When serving a git repository", func() {
+		It("should resolve the ref, clone the commit into the Pods, and roll out new commits", func() {
+			if _, err := exec.LookPath("git"); err != nil {
+				Skip("git is not installed")
+			}
+			dir := GinkgoT().TempDir()
+			git := func(args ...string) string {
+				cmd := exec.Command("git", args...)
+				cmd.Dir = dir
+				cmd.Env = append(os.Environ(),
+					"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+					"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+				out, err := cmd.CombinedOutput()
+				Expect(err).NotTo(HaveOccurred(), string(out))
+				return strings.TrimSpace(string(out))
+			}
+			commit := func(content string) string {
+				Expect(os.WriteFile(filepath.Join(dir, "work", "site", "index.html"), []byte(content), 0o644)).To(Succeed())
+				git("-C", "work", "add", ".")
+				git("-C", "work", "commit", "-q", "-m", content)
+				git("-C", "work", "push", "-q", "origin", "HEAD:main")
+				return git("-C", "work", "rev-parse", "HEAD")
+			}
+			git("init", "-q", "--bare", "site.git")
+			git("init", "-q", "work")
+			git("-C", "work", "remote", "add", "origin", filepath.Join(dir, "site.git"))
+			Expect(os.Mkdir(filepath.Join(dir, "work", "site"), 0o755)).To(Succeed())
+			first := commit("first")
+			// Serve the ref advertisement of the smart HTTP protocol
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				refs, err := exec.Command("git", "upload-pack", "--stateless-rpc", "--advertise-refs", filepath.Join(dir, "site.git")).Output()
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+				_, _ = fmt.Fprintf(w, "001e# service=git-upload-pack\n0000%s", refs)
+			}))
+			DeferCleanup(srv.Close)
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Source: &webappv1.SourceSpec{Git: &webappv1.GitSource{
+						URL:          srv.URL + "/site.git",
+						Ref:          "main",
+						Subdirectory: "site",
+						Interval:     "1m",
+						Image:        "registry.k8s.io/git-sync/git-sync:v4.2.1",
+					}},
+				},
+			}
+			r := newTestReconciler(webapp)
+			key := types.NamespacedName{Name: webapp.Name, Namespace: testWebAppNamespace}
+
+			By("Resolving the branch to its commit")
+			pinned, requeueAfter, err := r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(time.Minute))
+			Expect(webapp.Status.Source.Commit).To(Equal(first))
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced)).To(BeTrue())
+
+			By("Pinning the commit in the versioned spec, leaving the WebApp's own spec alone")
+			Expect(pinned.Spec.Source.Git.Commit).To(Equal(first))
+			Expect(webapp.Spec.Source.Git.Commit).To(BeEmpty())
+			firstRevision, _, err := revisionFor(pinned)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cloning that commit into the served directory")
+			Expect(r.reconcileConfigMap(ctx, pinned)).To(Succeed())
+			_, err = r.reconcileDeployment(ctx, pinned)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			template := dep.Spec.Template
+			Expect(template.Annotations).To(HaveKeyWithValue(gitCommitAnnotation, first))
+			Expect(template.Spec.InitContainers).To(HaveLen(1))
+			Expect(template.Spec.InitContainers[0].Args).To(ContainElement("--ref=" + first))
+			Expect(template.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-nginx", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+			Expect(cm.Data[nginxConfigKey]).To(ContainSubstring("root   /usr/share/nginx/html/current/site;"))
+
+			By("Waiting for the interval before polling again")
+			second := commit("second")
+			pinned, requeueAfter, err = r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeNumerically(">", 0))
+			Expect(webapp.Status.Source.Commit).To(Equal(first))
+			Expect(pinned.Spec.Source.Git.Commit).To(Equal(first))
+
+			By("Rolling out the new commit once it is found")
+			webapp.Status.Source.LastSyncTime = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+			Expect(r.Status().Update(ctx, webapp)).To(Succeed())
+			pinned, _, err = r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webapp.Status.Source.Commit).To(Equal(second))
+			secondRevision, _, err := revisionFor(pinned)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secondRevision).NotTo(Equal(firstRevision), "a new commit is a new revision, for the rollout gate to hold")
+			_, err = r.reconcileDeployment(ctx, pinned)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, key, dep)).To(Succeed())
+			Expect(dep.Spec.Template.Annotations).To(HaveKeyWithValue(gitCommitAnnotation, second))
+
+			By("Keeping the last commit when the ref cannot be resolved")
+			webapp.Spec.Source.Git.Ref = "missing"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Message).To(ContainSubstring("ref not found"))
+			Expect(webapp.Status.Source.Commit).To(Equal(second))
+
+			By("Refusing to read repositories on the operator's filesystem")
+			webapp.Spec.Source.Git.URL, webapp.Spec.Source.Git.Ref = "file://"+filepath.Join(dir, "site.git"), "main"
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Message).To(ContainSubstring(`unsupported repository URL scheme "file"`))
+
+			By("Serving a commit pinned in the spec without resolving the ref")
+			webapp.Spec.Source.Git.Commit = first
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			pinned, requeueAfter, err = r.reconcileSource(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(pinned.Spec.Source.Git.Commit).To(Equal(first))
+			Expect(webapp.Status.Source.Commit).To(Equal(first))
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceSynced)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal("Pinned"))
+		})
+	})
+
+	Context("When serving an archive", func() {
+		It("should verify the digest in an init container and report mismatches", func() {
+			var archive bytes.Buffer
+			gz := gzip.NewWriter(&archive)
+			tw := tar.NewWriter(gz)
+			page := []byte("<h1>built site</h1>")
+			Expect(tw.WriteHeader(&tar.Header{Name: "index.html", Mode: 0o644, Size: int64(len(page))})).To(Succeed())
+			_, err := tw.Write(page)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tw.Close()).To(Succeed())
+			Expect(gz.Close()).To(Succeed())
+			sum := sha256.Sum256(archive.Bytes())
+			digest := hex.EncodeToString(sum[:])
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write(archive.Bytes())
+			}))
+			defer server.Close()
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "archive-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Source: &webappv1.SourceSpec{Archive: &webappv1.ArchiveSource{
+						URL: server.URL + "/site.tar.gz", SHA256: digest, Image: "curlimages/curl:8.5.0",
+					}},
+				},
+			}
+			r := newTestReconciler(webapp)
+
+			By("Fetching the archive in an init container")
+			Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: testWebAppNamespace}, dep)).To(Succeed())
+			template := dep.Spec.Template
+			Expect(template.Annotations).To(HaveKeyWithValue(archiveDigestAnnotation, digest))
+			Expect(template.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+			Expect(template.Spec.InitContainers).To(HaveLen(1))
+			fetch := template.Spec.InitContainers[0]
+			Expect(fetch.Name).To(Equal(archiveContainer))
+
+			if _, err := exec.LookPath("curl"); err == nil {
+				By("Running the fetch script against a local server")
+				run := func(sha string) (string, int) {
+					dest := GinkgoT().TempDir()
+					cmd := exec.Command("sh", "-c", fetch.Args[0])
+					cmd.Env = append(os.Environ(), "ARCHIVE_URL="+server.URL+"/site.tar.gz",
+						"ARCHIVE_SHA256="+sha, "ARCHIVE_DEST="+dest)
+					out, _ := cmd.CombinedOutput()
+					GinkgoWriter.Printf("%s", out)
+					return dest, cmd.ProcessState.ExitCode()
+				}
+				dest, code := run(digest)
+				Expect(code).To(Equal(0))
+				Expect(os.ReadFile(filepath.Join(dest, "index.html"))).To(Equal(page))
+				_, code = run(strings.Repeat("0", 64))
+				Expect(code).To(Equal(archiveMismatchExitCode))
+			}
+
+			By("Waiting for a Pod to verify the archive")
+			requeueAfter, err := r.reconcileArchiveVerification(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(archiveVerifyRequeue))
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceVerified)
+			Expect(cond.Status).To(Equal(metav1.ConditionUnknown))
+
+			By("Reporting a digest mismatch from the Pod status")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "archive-webapp-1", Namespace: testWebAppNamespace,
+					Labels:      labelsForWebApp(webapp.Name),
+					Annotations: map[string]string{archiveDigestAnnotation: digest},
+				},
+				// The failed init container waits to be restarted
+				Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  archiveContainer,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: archiveMismatchExitCode, Message: "checksum mismatch: site.tar.gz has sha256 abc\n",
+					}},
+				}}},
+			}
+			Expect(r.Create(ctx, pod)).To(Succeed())
+			_, err = r.reconcileArchiveVerification(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeSourceVerified)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("ChecksumMismatch"))
+			Expect(cond.Message).To(ContainSubstring("site.tar.gz has sha256 abc"))
+
+			By("Reporting the archive verified once a retry unpacked it")
+			pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+			Expect(r.Status().Update(ctx, pod)).To(Succeed())
+			requeueAfter, err = r.reconcileArchiveVerification(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypeSourceVerified)).To(BeTrue())
+		})
+	})
+
+	Context("When building the site", func() {
+		It("should build each commit in a Job and serve only successful builds", func() {
+			first, second := strings.Repeat("1", 40), strings.Repeat("2", 40)
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "built-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Source: &webappv1.SourceSpec{Git: &webappv1.GitSource{
+						URL: "https://git.example.com/site.git", Ref: "main", Subdirectory: "docs",
+						Interval: "1m", Image: "registry.k8s.io/git-sync/git-sync:v4.2.1",
+					}},
+					Build: &webappv1.BuildSpec{
+						Image:   "hugomods/hugo:0.121.2",
+						Command: []string{"hugo", "--destination", "$(OUTPUT_DIR)"},
+						Storage: &webappv1.BuildStorage{Size: resource.MustParse("1Gi"), AccessMode: corev1.ReadWriteOnce},
+					},
+				},
+				Status: webappv1.WebAppStatus{Source: &webappv1.SourceStatus{
+					URL: "https://git.example.com/site.git", Ref: "main", Commit: first,
+				}},
+			}
+			r := newTestReconciler(webapp)
+			depKey := types.NamespacedName{Name: webapp.Name, Namespace: testWebAppNamespace}
+			reconcileBuild := func() bool {
+				conflict, _, err := r.reconcileBuild(ctx, webapp)
+				Expect(err).NotTo(HaveOccurred())
+				return conflict
+			}
+			finish := func(conditionType batchv1.JobConditionType) {
+				job := &batchv1.Job{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Status.Build.JobName, Namespace: testWebAppNamespace}, job)).To(Succeed())
+				job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: corev1.ConditionTrue}}
+				Expect(r.Status().Update(ctx, job)).To(Succeed())
+				Expect(reconcileBuild()).To(BeFalse())
+			}
+
+			By("Starting a build Job for the commit")
+			Expect(reconcileBuild()).To(BeFalse())
+			Expect(r.Get(ctx, types.NamespacedName{Name: "built-webapp-builds", Namespace: testWebAppNamespace},
+				&corev1.PersistentVolumeClaim{})).To(Succeed())
+			Expect(webapp.Status.Build.Phase).To(Equal(webappv1.BuildPhaseRunning))
+			Expect(webapp.Status.Build.Commit).To(Equal(first))
+			Expect(webapp.Status.Build.Logs).To(ContainSubstring("job/" + webapp.Status.Build.JobName))
+			job := &batchv1.Job{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Status.Build.JobName, Namespace: testWebAppNamespace}, job)).To(Succeed())
+			build := job.Spec.Template.Spec.Containers[0]
+			Expect(build.WorkingDir).To(Equal("/workspace/src/docs"))
+			Expect(build.Env).To(ContainElement(corev1.EnvVar{Name: "OUTPUT_DIR", Value: "/builds/" + webapp.Status.Build.ID}))
+			Expect(job.Spec.Template.Spec.InitContainers[1].Args).To(ContainElement("--ref=" + first))
+			Expect(job.Spec.Template.Labels).NotTo(HaveKey("app.kubernetes.io/name"))
+
+			By("Holding the Deployment until the build succeeds")
+			Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+			_, err := r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, depKey, dep)).To(Succeed())
+			Expect(dep.Spec.Template.Annotations).NotTo(HaveKey(buildAnnotation))
+			Expect(dep.Spec.Template.Spec.InitContainers).To(BeEmpty())
+
+			By("Serving the build once it succeeded")
+			finish(batchv1.JobComplete)
+			firstBuild := webapp.Status.Build.ID
+			Expect(webapp.Status.Build.Phase).To(Equal(webappv1.BuildPhaseSucceeded))
+			Expect(webapp.Status.Build.Duration).NotTo(BeNil())
+			Expect(webapp.Status.Build.LastSuccessfulID).To(Equal(firstBuild))
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypeBuildSucceeded)).To(BeTrue())
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, depKey, dep)).To(Succeed())
+			Expect(dep.Spec.Template.Annotations).To(HaveKeyWithValue(buildAnnotation, firstBuild))
+			Expect(dep.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("built-webapp-builds"))
+			Expect(dep.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPath).To(Equal(firstBuild))
+
+			By("Keeping the last successful build when the next one fails")
+			webapp.Status.Source.Commit = second
+			Expect(r.Status().Update(ctx, webapp)).To(Succeed())
+			Expect(reconcileBuild()).To(BeFalse())
+			Expect(webapp.Status.Build.Commit).To(Equal(second))
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Status.Build.JobName, Namespace: testWebAppNamespace}, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.InitContainers[0].Env).To(ContainElement(corev1.EnvVar{Name: "KEEP_IDS", Value: firstBuild}))
+			finish(batchv1.JobFailed)
+			Expect(webapp.Status.Build.Phase).To(Equal(webappv1.BuildPhaseFailed))
+			Expect(webapp.Status.Build.LastSuccessfulID).To(Equal(firstBuild))
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeBuildSucceeded)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Message).To(ContainSubstring("still serving the build of commit " + first))
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Get(ctx, depKey, dep)).To(Succeed())
+			Expect(dep.Spec.Template.Annotations).To(HaveKeyWithValue(buildAnnotation, firstBuild))
+
+			By("Refusing to serve a ReadWriteOnce claim to replicas on several nodes")
+			webapp.Spec.Replicas = 2
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(reconcileBuild()).To(BeTrue())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeBuildSucceeded)
+			Expect(cond.Reason).To(Equal("AccessModeConflict"))
+
+			By("Scheduling the Pods onto one node with the SameNode policy")
+			webapp.Spec.Build.Storage.ReadWriteOncePolicy = webappv1.ReadWriteOncePolicySameNode
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(reconcileBuild()).To(BeFalse())
+			template := deploymentForWebApp(webapp, webapp.Name, labelsForWebApp(webapp.Name), 2).Spec.Template
+			Expect(template.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+		})
+	})
+
+	Context("When rendering Markdown content", func() {
+		It("should serve sanitized HTML and follow the referenced ConfigMap", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "markdown-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Content: &webappv1.ContentSpec{
+						Theme: webappv1.ThemeDark,
+						Markdown: &webappv1.MarkdownContent{
+							Inline: "---\ntitle: Release notes\n---\n# Hello\n\n<script>alert(1)</script>\n[x](javascript:alert(1))\n",
+						},
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			html := func(webapp *webappv1.WebApp) string {
+				Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+				cm := &corev1.ConfigMap{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: "markdown-webapp-html", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+				return cm.Data["index.html"]
+			}
+
+			By("Rendering inline Markdown without its script")
+			resolved, missing, err := r.reconcileContent(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(BeFalse())
+			page := html(resolved)
+			Expect(page).To(ContainSubstring("<title>Release notes</title>"))
+			Expect(page).To(ContainSubstring("<h1>Hello</h1>"))
+			Expect(page).To(ContainSubstring("background: #0d1117"))
+			Expect(page).NotTo(ContainSubstring("<script>"))
+			Expect(page).NotTo(ContainSubstring("javascript:"))
+			cond := meta.FindStatusCondition(resolved.Status.Conditions, webappv1.ConditionTypeContentReady)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("RawHTMLOmitted"))
+
+			By("Passing raw HTML through when allowed")
+			webapp.Spec.Content.Markdown.AllowRawHTML = true
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			resolved, _, err = r.reconcileContent(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(html(resolved)).To(ContainSubstring("<script>alert(1)</script>"))
+			Expect(meta.IsStatusConditionTrue(resolved.Status.Conditions, webappv1.ConditionTypeContentReady)).To(BeTrue())
+
+			By("Waiting for the referenced ConfigMap")
+			webapp.Spec.Content.Markdown = &webappv1.MarkdownContent{ConfigMapRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site-pages"}, Key: "index.md",
+			}}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, missing, err = r.reconcileContent(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(BeTrue())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeContentReady)
+			Expect(cond.Reason).To(Equal("ConfigMapNotFound"))
+
+			By("Serving the last content meanwhile")
+			reconcileWebApp(r, webapp.Name)
+			cm := &corev1.ConfigMap{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: "markdown-webapp-html", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+			Expect(cm.Data["index.html"]).To(ContainSubstring("<script>alert(1)</script>"))
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(webapp), webapp)).To(Succeed())
+
+			By("Rendering the referenced Markdown, titled by the WebApp without front matter")
+			source := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "site-pages", Namespace: testWebAppNamespace},
+				Data:       map[string]string{"index.md": "Some *news*."},
+			}
+			Expect(r.Create(ctx, source)).To(Succeed())
+			Expect(r.webAppsReadingConfigMap(ctx, source)).To(ConsistOf(reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "markdown-webapp", Namespace: testWebAppNamespace},
+			}))
+			resolved, missing, err = r.reconcileContent(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(BeFalse())
+			page = html(resolved)
+			Expect(page).To(ContainSubstring("<title>markdown-webapp</title>"))
+			Expect(page).To(ContainSubstring("Some <em>news</em>."))
+			Expect(webapp.Spec.Content.Markdown.Inline).To(BeEmpty())
+		})
+	})
+
+	Context("When serving several pages", func() {
+		It("should render each page with a shared navigation menu and a sitemap", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "paged-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Message: "Welcome",
+					BaseURL: "https://www.example.com/",
+					Pages: []webappv1.Page{
+						{Slug: "about", Title: "About us", Body: "We *build* things."},
+						{Slug: "contact", Title: "Contact", Body: "<b>raw</b> mail@example.com"},
+					},
+				},
+			}
+
+			data := htmlConfigMapForWebApp(webapp, "paged-webapp-html").Data
+			Expect(data).To(HaveKey("index.html"))
+			Expect(data["index.html"]).To(ContainSubstring("<h1>Welcome</h1>"))
+			Expect(data["index.html"]).To(ContainSubstring(`<a href="/" aria-current="page">Welcome</a>`))
+			Expect(data["about.html"]).To(ContainSubstring("<title>About us</title>"))
+			Expect(data["about.html"]).To(ContainSubstring("We <em>build</em> things."))
+			Expect(data["about.html"]).To(ContainSubstring(`<a href="/about" aria-current="page">About us</a>`))
+			Expect(data["about.html"]).To(ContainSubstring(`<a href="/contact">Contact</a>`))
+			Expect(data["contact.html"]).NotTo(ContainSubstring("<b>raw</b>"))
+			Expect(data["sitemap.xml"]).To(ContainSubstring("<loc>https://www.example.com/about</loc>"))
+			Expect(data["sitemap.xml"]).To(ContainSubstring("<loc>https://www.example.com/</loc>"))
+			Expect(nginxConfigForWebApp(webapp)).To(ContainSubstring("try_files $uri $uri.html $uri/ =404;"))
+
+			By("Keeping the single message page without pages")
+			webapp.Spec.Pages = nil
+			data = htmlConfigMapForWebApp(webapp, "paged-webapp-html").Data
+			Expect(data).To(HaveLen(1))
+			Expect(data["index.html"]).NotTo(ContainSubstring("<nav>"))
+			Expect(nginxConfigForWebApp(webapp)).NotTo(ContainSubstring("try_files $uri"))
+		})
+	})
+
+	Context("When serving translations", func() {
+		It("should render each locale and pick it from Accept-Language", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "localized-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Message: "Welcome",
+					Pages: []webappv1.Page{
+						{Slug: "about", Title: "About us", Body: "Who we are."},
+						{Slug: "contact", Title: "Contact", Body: "Write to us."},
+					},
+					Content: &webappv1.ContentSpec{
+						Theme:         webappv1.ThemeLight,
+						DefaultLocale: "en",
+						Locales: []webappv1.Locale{
+							{Tag: "de", Message: "Willkommen", Pages: []webappv1.Page{
+								{Slug: "about", Title: "Über uns", Body: "Wer wir sind."},
+							}},
+							{Tag: "pt-BR", Message: "Bem-vindo"},
+						},
+					},
+				},
+			}
+
+			data := htmlConfigMapForWebApp(webapp, "localized-webapp-html").Data
+			Expect(data).To(HaveKey("index.html"))
+			Expect(data["index.html"]).To(ContainSubstring(`<html lang="en">`))
+			Expect(data["index.de.html"]).To(ContainSubstring(`<html lang="de">`))
+			Expect(data["index.de.html"]).To(ContainSubstring("<h1>Willkommen</h1>"))
+			Expect(data["about.de.html"]).To(ContainSubstring("Wer wir sind."))
+			Expect(data["about.de.html"]).To(ContainSubstring(`<a href="/">Willkommen</a>`))
+			Expect(data["contact.de.html"]).To(ContainSubstring("Write to us."))
+			Expect(data["about.pt-BR.html"]).To(ContainSubstring("Who we are."))
+
+			config := nginxConfigForWebApp(webapp)
+			Expect(config).To(ContainSubstring("map $http_accept_language $webapp_locale {"))
+			Expect(config).To(ContainSubstring(`"~*^\s*de(?:[-;,\s]|$)" ".de";`))
+			Expect(config).To(ContainSubstring(`"~*^\s*en(?:[-;,\s]|$)" "";`))
+			Expect(strings.Index(config, `^\s*pt-BR`)).To(BeNumerically("<", strings.Index(config, `^\s*de`)))
+			Expect(strings.Index(config, `^\s*en`)).To(BeNumerically("<", strings.Index(config, `,\s*en`)))
+			Expect(config).To(ContainSubstring("try_files $uri${webapp_locale}.html $uri $uri.html $uri/ =404;"))
+			Expect(config).To(ContainSubstring("add_header Vary Accept-Language;"))
+		})
+	})
+
+	Context("When serving a volume", func() {
+		It("should mount the claim read-only and check it fits the replicas", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "volume-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 2, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Source: &webappv1.SourceSpec{Volume: &webappv1.VolumeSource{
+						ClaimTemplate: &webappv1.VolumeClaimTemplate{
+							Size: resource.MustParse("5Gi"), AccessMode: corev1.ReadWriteOnce,
+						},
+						SubPath:             "site",
+						ReadWriteOncePolicy: webappv1.ReadWriteOncePolicyReject,
+					}},
+				},
+			}
+			r := newTestReconciler(webapp)
+			claimKey := types.NamespacedName{Name: "volume-webapp-content", Namespace: testWebAppNamespace}
+
+			By("Creating the claim and rejecting a ReadWriteOnce claim for two replicas")
+			conflict, requeueAfter, err := r.reconcileVolume(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflict).To(BeTrue())
+			Expect(requeueAfter).To(Equal(volumeRequeue))
+			claim := &corev1.PersistentVolumeClaim{}
+			Expect(r.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("5Gi"))
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeVolumeReady)
+			Expect(cond.Reason).To(Equal("AccessModeConflict"))
+
+			By("Scheduling the Pods onto one node with the SameNode policy")
+			webapp.Spec.Source.Volume.ReadWriteOncePolicy = webappv1.ReadWriteOncePolicySameNode
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			conflict, _, err = r.reconcileVolume(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflict).To(BeFalse())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeVolumeReady)
+			Expect(cond.Reason).To(Equal("Pending"))
+			_, err = r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: testWebAppNamespace}, dep)).To(Succeed())
+			pod := dep.Spec.Template.Spec
+			Expect(pod.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("volume-webapp-content"))
+			Expect(pod.Volumes[0].PersistentVolumeClaim.ReadOnly).To(BeTrue())
+			Expect(pod.Containers[0].VolumeMounts[0].SubPath).To(Equal("site"))
+			Expect(pod.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].TopologyKey).To(Equal(corev1.LabelHostname))
+
+			By("Reporting the claim once it is bound")
+			claim.Status.Phase = corev1.ClaimBound
+			claim.Status.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+			Expect(r.Status().Update(ctx, claim)).To(Succeed())
+			_, requeueAfter, err = r.reconcileVolume(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, webappv1.ConditionTypeVolumeReady)).To(BeTrue())
+
+			By("Reporting a referenced claim that does not exist")
+			webapp.Spec.Source.Volume = &webappv1.VolumeSource{ClaimName: "uploads", ReadWriteOncePolicy: webappv1.ReadWriteOncePolicyReject}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			_, _, err = r.reconcileVolume(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeVolumeReady)
+			Expect(cond.Reason).To(Equal("ClaimNotFound"))
+		})
+	})
+
+	Context("When uploading a site", func() {
+		It("should store a checked tarball and unpack it in an init container", func() {
+			tarball := func(name string) []byte {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				tw := tar.NewWriter(gz)
+				page := []byte("<h1>uploaded site</h1>")
+				Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(page)), Typeflag: tar.TypeReg})).To(Succeed())
+				_, err := tw.Write(page)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tw.Close()).To(Succeed())
+				Expect(gz.Close()).To(Succeed())
+				return buf.Bytes()
+			}
+			put := func(handler http.Handler, token string, body []byte) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPut, "/webapps/default/upload-webapp/content", bytes.NewReader(body))
+				req.Header.Set("Authorization", "Bearer "+token)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec
+			}
+
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "upload-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1,
+					Source: &webappv1.SourceSpec{Upload: &webappv1.UploadSource{Image: "busybox:1.36"}},
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "upload-token", Namespace: testWebAppNamespace},
+				Data:       map[string][]byte{"token": []byte("s3cret")},
+			}
+			c := testClientBuilder(webapp, secret).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						review, ok := obj.(*authnv1.TokenReview)
+						if !ok {
+							return c.Create(ctx, obj, opts...)
+						}
+						// A valid token issued for the API server, not for the endpoint
+						Expect(review.Spec.Audiences).To(Equal([]string{upload.DefaultAudience}))
+						review.Status = authnv1.TokenReviewStatus{Authenticated: true, Audiences: []string{"https://kubernetes.default.svc"}}
+						return nil
+					},
+				}).Build()
+			handler := (&upload.Server{Client: c, Reader: c, Scheme: c.Scheme(), TokenSecret: secret.Name}).Handler()
+
+			By("Rejecting a wrong token and paths leaving the site")
+			Expect(put(handler, "wrong", tarball("index.html")).Code).To(Equal(http.StatusUnauthorized))
+
+			By("Accepting the token only in its Secret's namespace")
+			req := httptest.NewRequest(http.MethodPut, "/webapps/other/upload-webapp/content", bytes.NewReader(tarball("index.html")))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+
+			By("Refusing reviewed tokens issued for another audience")
+			reviewed := (&upload.Server{Client: c, Reader: c, Scheme: c.Scheme()}).Handler()
+			Expect(put(reviewed, "kubernetes-token", tarball("index.html")).Code).To(Equal(http.StatusUnauthorized))
+			Expect(put(handler, "s3cret", tarball("../index.html")).Code).To(Equal(http.StatusBadRequest))
+
+			By("Storing the tarball and bumping the upload revision")
+			body := tarball("index.html")
+			rec = put(handler, "s3cret", body)
+			Expect(rec.Code).To(Equal(http.StatusAccepted))
+			Expect(rec.Header().Get("Location")).To(Equal("/webapps/default/upload-webapp/status"))
+			sum := sha256.Sum256(body)
+			digest := hex.EncodeToString(sum[:])
+			chunk := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: upload.ChunkName("upload-webapp", 1, digest, 0), Namespace: testWebAppNamespace}, chunk)).To(Succeed())
+			Expect(chunk.BinaryData[upload.ChunkKey]).To(Equal(body))
+			Expect(metav1.IsControlledBy(chunk, webapp)).To(BeTrue())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(webapp), webapp)).To(Succeed())
+			uploaded := webapp.Spec.Source.Upload
+			Expect(uploaded.Revision).To(Equal(int64(1)))
+			Expect(uploaded.Chunks).To(Equal(int32(1)))
+			Expect(uploaded.SHA256).To(Equal(digest))
+
+			By("Refusing to overwrite the chunks of an upload, e.g. after a stale read")
+			next := tarball("next.html")
+			nextSum := sha256.Sum256(next)
+			taken := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      upload.ChunkName("upload-webapp", 2, hex.EncodeToString(nextSum[:]), 0),
+					Namespace: testWebAppNamespace,
+				},
+				Data: map[string]string{"served": "true"},
+			}
+			Expect(c.Create(ctx, taken)).To(Succeed())
+			Expect(put(handler, "s3cret", next).Code).To(Equal(http.StatusConflict))
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(taken), taken)).To(Succeed())
+			Expect(taken.Data).To(HaveKeyWithValue("served", "true"))
+			Expect(c.Delete(ctx, taken)).To(Succeed())
+
+			By("Unpacking the chunks in an init container")
+			r := &WebAppReconciler{Client: c, Scheme: c.Scheme()}
+			_, err := r.reconcileDeployment(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			dep := &appsv1.Deployment{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(webapp), dep)).To(Succeed())
+			pod := dep.Spec.Template.Spec
+			Expect(pod.InitContainers).To(HaveLen(1))
+			Expect(pod.InitContainers[0].Name).To(Equal(uploadContainer))
+			Expect(pod.InitContainers[0].Env).To(ContainElement(corev1.EnvVar{Name: "UPLOAD_SHA256", Value: uploaded.SHA256}))
+			var projected *corev1.ProjectedVolumeSource
+			for _, volume := range pod.Volumes {
+				if volume.Name == "upload" {
+					projected = volume.Projected
+				}
+			}
+			Expect(projected).NotTo(BeNil())
+			Expect(projected.Sources[0].ConfigMap.Name).To(Equal(chunk.Name))
+
+			By("Keeping the chunks every retained revision refers to")
+			chunkExists := func(revision int64) bool {
+				chunks, err := r.uploadChunks(ctx, webapp)
+				Expect(err).NotTo(HaveOccurred())
+				for i := range chunks {
+					if rev, _ := upload.ChunkRevision(&chunks[i]); rev == revision {
+						return true
+					}
+				}
+				return false
+			}
+			_, err = r.reconcileRevision(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 2; i <= 5; i++ {
+				Expect(put(handler, "s3cret", tarball(fmt.Sprintf("page-%d.html", i))).Code).To(Equal(http.StatusAccepted))
+				Expect(c.Get(ctx, client.ObjectKeyFromObject(webapp), webapp)).To(Succeed())
+				_, err = r.reconcileRevision(ctx, webapp)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(chunkExists(1)).To(BeTrue())
+
+			By("Pruning the chunks once their revisions are pruned")
+			one := int32(1)
+			webapp.Spec.RevisionHistoryLimit = &one
+			Expect(c.Update(ctx, webapp)).To(Succeed())
+			_, err = r.reconcileRevision(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chunkExists(3)).To(BeFalse())
+			Expect(chunkExists(4)).To(BeTrue())
+			Expect(chunkExists(5)).To(BeTrue())
+
+			By("Releasing the chunks with the Orphan deletion policy")
+			webapp.Spec.DeletionPolicy = webappv1.DeletionPolicyOrphan
+			Expect(r.applyDeletionPolicy(ctx, webapp)).To(Succeed())
+			uploaded = webapp.Spec.Source.Upload
+			Expect(c.Get(ctx, types.NamespacedName{Name: upload.ChunkName("upload-webapp", 5, uploaded.SHA256, 0), Namespace: testWebAppNamespace}, chunk)).To(Succeed())
+			Expect(chunk.OwnerReferences).To(BeEmpty())
+		})
+	})
+
+	Context("When publishing scheduled content", func() {
+		It("should serve the entry that is due and wake up for the next", func() {
+			now := time.Now().UTC()
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "scheduled-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1, Message: "Welcome",
+					Schedule: []webappv1.ScheduledContent{
+						{At: now.Add(-time.Hour).Format("2006-01-02T15:04"), TimeZone: "UTC", Message: "Winter sale starts now"},
+						{At: now.Add(2 * time.Hour).Format("2006-01-02T15:04"), TimeZone: "UTC", ContentRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "announcements"}, Key: "sale-ended.md",
+						}},
+					},
+				},
+			}
+			announcements := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "announcements", Namespace: testWebAppNamespace},
+				Data:       map[string]string{"sale-ended.md": "The sale has *ended*."},
+			}
+			r := newTestReconciler(webapp, announcements)
+			html := func(webapp *webappv1.WebApp) string {
+				Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+				cm := &corev1.ConfigMap{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: "scheduled-webapp-html", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+				return cm.Data["index.html"]
+			}
+
+			By("Serving the due entry and requeueing for the next")
+			scheduled, _, requeueAfter, err := r.reconcileSchedule(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeNumerically("~", 2*time.Hour, time.Minute))
+			Expect(html(scheduled)).To(ContainSubstring("Winter sale starts now"))
+			Expect(webapp.Spec.Message).To(Equal("Welcome"))
+			status := webapp.Status.Schedule
+			Expect(*status.Active).To(Equal(int32(0)))
+			Expect(*status.Next).To(Equal(int32(1)))
+			Expect(status.NextAt.Time).To(BeTemporally("~", now.Add(2*time.Hour), time.Minute))
+			Expect(r.webAppsReadingConfigMap(ctx, announcements)).To(ConsistOf(reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(webapp),
+			}))
+
+			By("Rendering the referenced Markdown once its entry is due")
+			webapp.Spec.Schedule[1].At = now.Add(-time.Minute).Format("2006-01-02T15:04")
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			scheduled, _, requeueAfter, err = r.reconcileSchedule(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(*webapp.Status.Schedule.Active).To(Equal(int32(1)))
+			Expect(webapp.Status.Schedule.Next).To(BeNil())
+			Expect(html(scheduled)).To(ContainSubstring("The sale has <em>ended</em>."))
+			Expect(webapp.Spec.Content).To(BeNil())
+
+			By("Clearing the status once the schedule is removed")
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(webapp), webapp)).To(Succeed())
+			webapp.Spec.Schedule = nil
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			scheduled, _, _, err = r.reconcileSchedule(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled.Status.Schedule).To(BeNil())
+			Expect(html(scheduled)).To(ContainSubstring("Welcome"))
+		})
+
+		It("should publish entries only once the rollout gate lets the schedule through", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "gated-schedule-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1, Message: "Welcome",
+					Rollout: &webappv1.RolloutSpec{RequireApproval: true},
+				},
+			}
+			r := newTestReconciler(webapp)
+			_, err := r.reconcileRevision(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Holding a new schedule until it is approved")
+			webapp.Spec.Schedule = []webappv1.ScheduledContent{
+				{At: time.Now().UTC().Add(-time.Hour).Format("2006-01-02T15:04"), TimeZone: "UTC", Message: "Flash sale"},
+			}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			held, _, err := r.gateRollout(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			scheduled, _, _, err := r.reconcileSchedule(ctx, held)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled.Spec.Message).To(Equal("Welcome"))
+			Expect(scheduled.Status.Schedule).To(BeNil())
+
+			By("Publishing the due entry once approved")
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(webapp), webapp)).To(Succeed())
+			webapp.Annotations = map[string]string{webappv1.AnnotationApprovedGeneration: strconv.FormatInt(webapp.Generation, 10)}
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			applied, _, err := r.gateRollout(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			scheduled, _, _, err = r.reconcileSchedule(ctx, applied)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled.Spec.Message).To(Equal("Flash sale"))
+			Expect(*scheduled.Status.Schedule.Active).To(Equal(int32(0)))
+
+			By("Recording the schedule rather than the entry it serves")
+			_, err = r.reconcileRevision(ctx, applied)
+			Expect(err).NotTo(HaveOccurred())
+			revisions, err := r.listRevisions(ctx, webapp)
+			Expect(err).NotTo(HaveOccurred())
+			var snapshot webappv1.WebAppSpec
+			Expect(json.Unmarshal(revisions[len(revisions)-1].Data.Raw, &snapshot)).To(Succeed())
+			Expect(snapshot.Message).To(Equal("Welcome"))
+			Expect(snapshot.Schedule).To(HaveLen(1))
+		})
+	})
+
+	Context("When in maintenance", func() {
+		It("should answer 503 with the maintenance page outside the allow-list", func() {
+			webapp := &webappv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{Name: "maintenance-webapp", Namespace: testWebAppNamespace},
+				Spec: webappv1.WebAppSpec{
+					Replicas: 1, Image: "nginx:1.25.3", Port: 80, MaxUnavailable: 1, Message: "Welcome",
+					Maintenance: &webappv1.MaintenanceSpec{
+						Enabled:           true,
+						Message:           "Back at 18:00 <UTC>",
+						AllowedCIDRs:      []string{"10.0.0.0/8", "203.0.113.7/32"},
+						RetryAfterSeconds: 120,
+					},
+				},
+			}
+			r := newTestReconciler(webapp)
+			nginx := func() string {
+				Expect(r.reconcileConfigMap(ctx, webapp)).To(Succeed())
+				cm := &corev1.ConfigMap{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-nginx", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+				return cm.Data[nginxConfigKey]
+			}
+			template := func() corev1.PodTemplateSpec {
+				_, err := r.reconcileDeployment(ctx, webapp)
+				Expect(err).NotTo(HaveOccurred())
+				dep := &appsv1.Deployment{}
+				Expect(r.Get(ctx, client.ObjectKeyFromObject(webapp), dep)).To(Succeed())
+				return dep.Spec.Template
+			}
+			maintenanceData := func() map[string]string {
+				Expect(r.reconcileMaintenance(ctx, webapp)).To(Succeed())
+				cm := &corev1.ConfigMap{}
+				Expect(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-maintenance", Namespace: testWebAppNamespace}, cm)).To(Succeed())
+				return cm.Data
+			}
+
+			By("Serving the maintenance page to clients outside the allowed ranges")
+			config := nginx()
+			Expect(config).To(ContainSubstring("geo $webapp_maintenance_allowed {\n    default 0;\n    10.0.0.0/8 1;\n    203.0.113.7/32 1;\n}"))
+			Expect(config).To(ContainSubstring("if (-f /etc/nginx/maintenance/enabled) {\n        set $webapp_maintenance 1;"))
+			Expect(config).To(ContainSubstring("if ($webapp_maintenance) {\n            return 503;"))
+			Expect(config).To(ContainSubstring("error_page 503 @maintenance;"))
+			Expect(config).To(ContainSubstring("add_header Retry-After 120 always;"))
+			data := maintenanceData()
+			Expect(data[maintenancePageKey]).To(ContainSubstring("<h1>Back at 18:00 &lt;UTC&gt;</h1>"))
+			Expect(data).To(HaveKey(maintenanceFlagKey))
+			cond := meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeMaintenance)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Message).To(ContainSubstring("10.0.0.0/8, 203.0.113.7/32"))
+
+			By("Probing the health endpoint and mounting the maintenance ConfigMap")
+			enabled := template()
+			container := enabled.Spec.Containers[0]
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal(healthPath))
+			Expect(container.LivenessProbe.HTTPGet.Path).To(Equal(healthPath))
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "maintenance", MountPath: maintenanceDir, ReadOnly: true}))
+
+			By("Keeping maintenance out of the recorded revisions")
+			Expect(versionedSpec(webapp.Spec).Maintenance).To(BeNil())
+
+			By("Serving the site again once disabled, without rolling the Pods")
+			webapp.Spec.Maintenance.Enabled = false
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(nginx()).To(Equal(config))
+			Expect(template()).To(Equal(enabled))
+			Expect(maintenanceData()).NotTo(HaveKey(maintenanceFlagKey))
+			cond = meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeMaintenance)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("Disabled"))
+
+			By("Deleting the maintenance ConfigMap with the maintenance block")
+			webapp.Spec.Maintenance = nil
+			Expect(r.Update(ctx, webapp)).To(Succeed())
+			Expect(r.reconcileMaintenance(ctx, webapp)).To(Succeed())
+			Expect(apierrors.IsNotFound(r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-maintenance", Namespace: testWebAppNamespace}, &corev1.ConfigMap{}))).To(BeTrue())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, webappv1.ConditionTypeMaintenance)).To(BeNil())
+		})
+	})
 })
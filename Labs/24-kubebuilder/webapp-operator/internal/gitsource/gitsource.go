@@ -0,0 +1,209 @@
+// Package gitsource resolves a branch, tag or commit of a remote git repository
+// to a commit SHA without a git binary, which the operator image does not ship.
+// It reads the ref advertisement of the smart HTTP(S) and git:// protocols.
+// file:// URLs are not supported: they would read the operator's own filesystem.
+package gitsource
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultGitPort is the port of the git:// protocol.
+const defaultGitPort = "9418"
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ErrRefNotFound is returned when the repository has no ref with the given name.
+var ErrRefNotFound = errors.New("ref not found")
+
+// Credentials authenticate HTTP(S) requests with basic auth, e.g. with a
+// username and a personal access token.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// IsCommit reports whether ref is a full commit SHA, which needs no lookup.
+func IsCommit(ref string) bool {
+	return commitPattern.MatchString(ref)
+}
+
+// Resolve returns the commit the ref points to in the repository at repoURL.
+// The ref is a full commit SHA, a branch or tag name, or a full ref name such
+// as "refs/heads/main" or "HEAD". Annotated tags resolve to the tagged commit.
+func Resolve(ctx context.Context, repoURL, ref string, creds *Credentials) (string, error) {
+	if IsCommit(ref) {
+		return ref, nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing repository URL: %w", err)
+	}
+
+	var refs map[string]string
+	switch u.Scheme {
+	case "http", "https":
+		refs, err = httpRefs(ctx, u, creds)
+	case "git":
+		refs, err = daemonRefs(ctx, u)
+	default:
+		return "", fmt.Errorf("unsupported repository URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return "", err
+	}
+	return lookup(refs, ref)
+}
+
+// lookup finds ref among the advertised refs, trying it as given, then as a
+// branch, then as a tag, the way git rev-parse disambiguates.
+func lookup(refs map[string]string, ref string) (string, error) {
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref} {
+		// Annotated tags are advertised with the commit they point to as name^{}
+		if sha, ok := refs[name+"^{}"]; ok {
+			return sha, nil
+		}
+		if sha, ok := refs[name]; ok {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+}
+
+// ── Smart HTTP ──────────────────────────────────────────────────────────────
+
+// httpRefs fetches the ref advertisement of git-upload-pack over HTTP(S).
+func httpRefs(ctx context.Context, u *url.URL, creds *Credentials) (map[string]string, error) {
+	endpoint := *u
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/info/refs"
+	endpoint.RawQuery = "service=git-upload-pack"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("authentication failed: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching refs: %s", resp.Status)
+	case resp.Header.Get("Content-Type") != "application/x-git-upload-pack-advertisement":
+		return nil, errors.New("the server does not speak the smart HTTP protocol")
+	}
+
+	r := bufio.NewReader(resp.Body)
+	// The advertisement starts with a service announcement section
+	if _, err := readSection(r); err != nil {
+		return nil, err
+	}
+	lines, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseAdvertisement(lines)
+}
+
+// ── git:// daemon ───────────────────────────────────────────────────────────
+
+// daemonRefs reads the ref advertisement from a git daemon.
+func daemonRefs(ctx context.Context, u *url.URL) (map[string]string, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultGitPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	request := fmt.Sprintf("git-upload-pack %s\x00host=%s\x00", u.Path, u.Host)
+	if _, err := io.WriteString(conn, pktLine(request)); err != nil {
+		return nil, err
+	}
+	lines, err := readSection(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+	// A flush tells the daemon we want no objects
+	_, _ = io.WriteString(conn, "0000")
+	return parseAdvertisement(lines)
+}
+
+// ── pkt-line ────────────────────────────────────────────────────────────────
+
+// pktLine frames a payload as a pkt-line: four hex digits of length, then the payload.
+func pktLine(payload string) string {
+	return fmt.Sprintf("%04x%s", len(payload)+4, payload)
+}
+
+// readSection reads pkt-lines up to the next flush-pkt.
+func readSection(r *bufio.Reader) ([]string, error) {
+	var lines []string
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, fmt.Errorf("reading ref advertisement: %w", err)
+		}
+		n, err := strconv.ParseUint(string(size[:]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("reading ref advertisement: malformed pkt-line length %q", size)
+		}
+		if n == 0 {
+			return lines, nil
+		}
+		if n < 4 {
+			return nil, fmt.Errorf("reading ref advertisement: malformed pkt-line length %q", size)
+		}
+		payload := make([]byte, n-4)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, fmt.Errorf("reading ref advertisement: %w", err)
+		}
+		line := string(payload)
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, errors.New(strings.TrimSpace(strings.TrimPrefix(line, "ERR ")))
+		}
+		lines = append(lines, line)
+	}
+}
+
+// parseAdvertisement maps ref names to SHAs. The first line carries the
+// capabilities after a NUL byte.
+func parseAdvertisement(lines []string) (map[string]string, error) {
+	refs := map[string]string{}
+	for _, line := range lines {
+		line, _, _ = strings.Cut(strings.TrimSuffix(line, "\n"), "\x00")
+		sha, name, ok := strings.Cut(line, " ")
+		if !ok || !IsCommit(sha) {
+			return nil, fmt.Errorf("malformed ref advertisement line %q", line)
+		}
+		// An empty repository advertises only capabilities^{}
+		if name != "capabilities^{}" {
+			refs[name] = sha
+		}
+	}
+	return refs, nil
+}
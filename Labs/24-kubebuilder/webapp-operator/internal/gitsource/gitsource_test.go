@@ -0,0 +1,175 @@
+package gitsource
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	mainSHA   = "1111111111111111111111111111111111111111"
+	tagSHA    = "2222222222222222222222222222222222222222"
+	peeledSHA = "3333333333333333333333333333333333333333"
+	devSHA    = "4444444444444444444444444444444444444444"
+)
+
+// advertisement returns the refs of the test repository as pkt-lines ending
+// with a flush-pkt, the first line carrying capabilities.
+func advertisement() string {
+	return pktLine(mainSHA+" HEAD\x00multi_ack symref=HEAD:refs/heads/main\n") +
+		pktLine(mainSHA+" refs/heads/main\n") +
+		pktLine(devSHA+" refs/heads/dev\n") +
+		pktLine(tagSHA+" refs/tags/v1\n") +
+		pktLine(peeledSHA+" refs/tags/v1^{}\n") +
+		"0000"
+}
+
+func TestLookup(t *testing.T) {
+	lines, err := readSection(bufio.NewReader(strings.NewReader(advertisement())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := parseAdvertisement(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref, want string
+		wantErr   error
+	}{
+		{ref: "HEAD", want: mainSHA},
+		{ref: "main", want: mainSHA},
+		{ref: "refs/heads/dev", want: devSHA},
+		{ref: "v1", want: peeledSHA},
+		{ref: "missing", wantErr: ErrRefNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := lookup(refs, tt.ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("lookup(%q) error = %v, want %v", tt.ref, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSection(t *testing.T) {
+	tests := []struct {
+		name, input, wantErr string
+	}{
+		{name: "server error", input: pktLine("ERR access denied\n"), wantErr: "access denied"},
+		{name: "malformed length", input: "zzzz", wantErr: "malformed pkt-line length"},
+		{name: "short length", input: "0003", wantErr: "malformed pkt-line length"},
+		{name: "truncated", input: "00ffshort", wantErr: "reading ref advertisement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readSection(bufio.NewReader(strings.NewReader(tt.input)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("readSection() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := parseAdvertisement([]string{"not-a-sha refs/heads/main\n"}); err == nil {
+		t.Error("parseAdvertisement() accepted a malformed line")
+	}
+}
+
+func TestResolveHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "bot" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/site.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		_, _ = w.Write([]byte(pktLine("# service=git-upload-pack\n") + "0000" + advertisement()))
+	}))
+	defer srv.Close()
+
+	got, err := Resolve(context.Background(), srv.URL+"/site.git", "v1", &Credentials{Username: "bot", Password: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != peeledSHA {
+		t.Errorf("Resolve() = %q, want %q", got, peeledSHA)
+	}
+
+	if _, err := Resolve(context.Background(), srv.URL+"/site.git", "main", nil); err == nil ||
+		!strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("Resolve() without credentials error = %v, want an authentication failure", err)
+	}
+}
+
+func TestResolveUnsupportedScheme(t *testing.T) {
+	for _, repoURL := range []string{"file:///var/run/secrets", "ssh://example.com/site.git"} {
+		if _, err := Resolve(context.Background(), repoURL, "main", nil); err == nil ||
+			!strings.Contains(err.Error(), "unsupported repository URL scheme") {
+			t.Errorf("Resolve(%q) error = %v, want an unsupported scheme", repoURL, err)
+		}
+	}
+}
+
+func TestLocalRefs(t *testing.T) {
+	dir := t.TempDir()
+	gitDir := filepath.Join(dir, ".git")
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(gitDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// main is packed and overridden by a loose ref; dev is only packed
+	write("HEAD", "ref: refs/heads/dev\n")
+	write("packed-refs", "# pack-refs with: peeled fully-peeled sorted\n"+
+		tagSHA+" refs/heads/main\n"+
+		devSHA+" refs/heads/dev\n"+
+		tagSHA+" refs/tags/v1\n"+
+		"^"+peeledSHA+"\n")
+	write("refs/heads/main", mainSHA+"\n")
+
+	tests := []struct {
+		ref, want string
+	}{
+		{ref: "main", want: mainSHA},
+		{ref: "HEAD", want: devSHA},
+		{ref: "v1", want: peeledSHA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			refs, err := localRefs(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := lookup(refs, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("lookup(localRefs(), %q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := localRefs(t.TempDir()); err == nil {
+		t.Error("localRefs() of a directory without a repository returned no error")
+	}
+}
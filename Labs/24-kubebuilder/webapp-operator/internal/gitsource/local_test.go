@@ -0,0 +1,102 @@
+package gitsource
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymrefDepth bounds the chain of symbolic refs followed in a local repository.
+const maxSymrefDepth = 5
+
+// localRefs reads the refs of a bare or non-bare repository on disk: loose
+// refs, packed refs, and HEAD. Resolve never reads the local filesystem, so
+// it only backs the tests of lookup against repositories laid out on disk.
+func localRefs(dir string) (map[string]string, error) {
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+		dir = filepath.Join(dir, ".git")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("%s is not a git repository", dir)
+	}
+
+	refs := map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(dir, "packed-refs")); err == nil {
+		var last string
+		for _, line := range strings.Split(string(data), "\n") {
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "^"):
+				// Peeled annotated tag of the previous line
+				if last != "" {
+					refs[last+"^{}"] = strings.TrimPrefix(line, "^")
+				}
+			default:
+				sha, name, ok := strings.Cut(line, " ")
+				if ok && IsCommit(sha) {
+					refs[name], last = sha, name
+				}
+			}
+		}
+	}
+
+	// Loose refs take precedence over packed ones
+	refsDir := filepath.Join(dir, "refs")
+	err := filepath.WalkDir(refsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sha, err := readLocalRef(dir, filepath.ToSlash(rel), 0)
+		if err == nil {
+			refs[filepath.ToSlash(rel)] = sha
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if sha, err := readLocalRef(dir, "HEAD", 0); err == nil {
+		refs["HEAD"] = sha
+	} else if target, ok := symref(dir, "HEAD"); ok {
+		// HEAD may point at a packed branch
+		if sha, ok := refs[target]; ok {
+			refs["HEAD"] = sha
+		}
+	}
+	return refs, nil
+}
+
+// readLocalRef reads a loose ref file, following symbolic refs.
+func readLocalRef(dir, name string, depth int) (string, error) {
+	if depth > maxSymrefDepth {
+		return "", fmt.Errorf("too many levels of symbolic refs at %s", name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(data))
+	if target, ok := strings.CutPrefix(content, "ref: "); ok {
+		return readLocalRef(dir, target, depth+1)
+	}
+	if !IsCommit(content) {
+		return "", fmt.Errorf("malformed ref %s", name)
+	}
+	return content, nil
+}
+
+// symref returns the target of a symbolic ref file.
+func symref(dir, name string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+}
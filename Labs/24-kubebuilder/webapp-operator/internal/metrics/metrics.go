@@ -0,0 +1,143 @@
+// Package metrics defines the operator-specific Prometheus metrics.
+// They are registered on the controller-runtime registry, so they are served
+// on the manager's existing /metrics endpoint next to the built-in metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Reconcile step names used as the "step" label of ReconcileStepDuration.
+const (
+	StepSource         = "source"
+	StepBuild          = "build"
+	StepContent        = "content"
+	StepSchedule       = "schedule"
+	StepConfigMap      = "configmap"
+	StepDeployment     = "deployment"
+	StepService        = "service"
+	StepMaintenance    = "maintenance"
+	StepServiceMonitor = "servicemonitor"
+	StepRevision       = "revision"
+	StepTests          = "tests"
+	StepDrift          = "drift"
+	StepStatus         = "status"
+)
+
+// phases lists every phase a WebApp can report, so the phase gauge always
+// exposes one series per phase (1 for the current phase, 0 for the others).
+var phases = []string{"Pending", "Running", "Degraded", "Failed"}
+
+var (
+	// WebAppPhase is 1 for the phase a WebApp is currently in and 0 otherwise.
+	// Summing by phase yields the number of WebApps in each phase.
+	WebAppPhase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "webapp_operator_webapp_phase",
+			Help: "Current phase of each WebApp (1 for the active phase, 0 otherwise).",
+		},
+		[]string{"namespace", "webapp", "phase"},
+	)
+
+	// DesiredReplicas is the replica count requested in the WebApp spec.
+	DesiredReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "webapp_operator_webapp_desired_replicas",
+			Help: "Number of replicas requested by each WebApp.",
+		},
+		[]string{"namespace", "webapp"},
+	)
+
+	// ReadyReplicas is the number of ready Pods reported by the managed Deployment.
+	ReadyReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "webapp_operator_webapp_ready_replicas",
+			Help: "Number of ready replicas of each WebApp.",
+		},
+		[]string{"namespace", "webapp"},
+	)
+
+	// ReconcileStepDuration tracks how long each reconcile step takes.
+	ReconcileStepDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "webapp_operator_reconcile_step_duration_seconds",
+			Help:    "Duration of each WebApp reconcile step in seconds.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"step"},
+	)
+
+	// ChildRecreations counts child resources the operator had to delete and
+	// create again (e.g. a Service whose type changed, or a deleted Deployment).
+	ChildRecreations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webapp_operator_child_recreations_total",
+			Help: "Number of child resources recreated by the operator.",
+		},
+		[]string{"namespace", "webapp", "kind"},
+	)
+
+	// DriftedFields is the number of child fields edited out-of-band and left in
+	// place because the WebApp's driftPolicy is Report.
+	DriftedFields = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "webapp_operator_drifted_fields",
+			Help: "Number of drifted fields of each WebApp's children, by kind.",
+		},
+		[]string{"namespace", "webapp", "kind"},
+	)
+
+	// WebhookRejections counts admission rejections by the offending field path.
+	WebhookRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webapp_operator_webhook_rejections_total",
+			Help: "Number of WebApp admission requests rejected, by field.",
+		},
+		[]string{"field"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		WebAppPhase,
+		DesiredReplicas,
+		ReadyReplicas,
+		ReconcileStepDuration,
+		ChildRecreations,
+		DriftedFields,
+		WebhookRejections,
+	)
+}
+
+// ObserveStep records the time elapsed since start for the given reconcile step.
+// It is meant to be deferred at the top of each step:
+//
+//	defer metrics.ObserveStep(metrics.StepConfigMap, time.Now())
+func ObserveStep(step string, start time.Time) {
+	ReconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+// SetPhase marks phase as the current phase of the WebApp and clears the others.
+func SetPhase(namespace, name, phase string) {
+	for _, p := range phases {
+		value := 0.0
+		if p == phase {
+			value = 1
+		}
+		WebAppPhase.WithLabelValues(namespace, name, p).Set(value)
+	}
+}
+
+// ForgetWebApp drops every per-WebApp series once the WebApp is deleted,
+// so dashboards do not keep alerting on objects that no longer exist.
+func ForgetWebApp(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "webapp": name}
+	WebAppPhase.DeletePartialMatch(labels)
+	DesiredReplicas.DeletePartialMatch(labels)
+	ReadyReplicas.DeletePartialMatch(labels)
+	ChildRecreations.DeletePartialMatch(labels)
+	DriftedFields.DeletePartialMatch(labels)
+}
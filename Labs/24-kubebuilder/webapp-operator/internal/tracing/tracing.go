@@ -0,0 +1,104 @@
+// Package tracing configures OpenTelemetry tracing for the operator.
+// Spans are always created; they are only exported when an OTLP endpoint is
+// configured through the manager flags, otherwise the global no-op provider drops them.
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TracerName is the instrumentation scope of every span created by the operator.
+const TracerName = "codewizard.io/webapp-operator"
+
+// Options holds the manager flags that control trace export.
+type Options struct {
+	// OTLPEndpoint is the host:port of an OTLP/gRPC collector. Empty disables export.
+	OTLPEndpoint string
+	// Insecure disables TLS towards the collector.
+	Insecure bool
+	// SampleRatio is the fraction of root traces to sample (0.0 - 1.0).
+	SampleRatio float64
+}
+
+// BindFlags registers the tracing flags on the given FlagSet.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.OTLPEndpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP/gRPC trace collector. Tracing export is disabled when empty.")
+	fs.BoolVar(&o.Insecure, "otlp-insecure", false,
+		"Connect to the OTLP collector without TLS.")
+	fs.Float64Var(&o.SampleRatio, "trace-sample-ratio", 1.0,
+		"The fraction of reconciles and webhook calls to trace (0.0 - 1.0).")
+}
+
+// Setup installs the global TracerProvider described by opts and returns its shutdown func.
+// Without an OTLP endpoint the no-op provider is kept and shutdown does nothing.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.OTLPEndpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", "webapp-operator")))
+	if err != nil {
+		return nil, fmt.Errorf("building trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the operator tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Attributes returns the span attributes identifying a WebApp.
+func Attributes(obj metav1.Object) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("webapp.name", obj.GetName()),
+		attribute.String("webapp.namespace", obj.GetNamespace()),
+		attribute.Int64("webapp.generation", obj.GetGeneration()),
+	}
+}
+
+// Start opens a span for the named operation, tagged with the WebApp identity.
+func Start(ctx context.Context, name string, obj metav1.Object) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(Attributes(obj)...))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
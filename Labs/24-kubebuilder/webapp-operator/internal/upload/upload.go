@@ -0,0 +1,494 @@
+// Package upload serves the endpoint publishing a site to a WebApp without
+// kubectl. A PUT of a gzip-compressed tarball to
+// /webapps/<namespace>/<name>/content stores it in ConfigMaps, split below
+// the ConfigMap size limit, and points spec.source.upload of the WebApp at
+// it, which rolls out the Pods. The operator prunes the chunks once no
+// revision of the WebApp refers to them. GET /webapps/<namespace>/<name>/status
+// reports how the rollout is doing.
+//
+// The endpoint is served over TLS. Requests carry a bearer token: the token
+// in the configured Secret of the WebApp's namespace, or, without one, a
+// Kubernetes token issued for the endpoint's audience to a user allowed to
+// update the WebApp (or get it, for the status).
+package upload
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	webappv1 "codewizard.io/webapp-operator/api/v1"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+const (
+	// ChunkKey is the ConfigMap key holding a chunk of the tarball.
+	ChunkKey = "chunk"
+	// DefaultMaxBytes is the default limit of the compressed tarball.
+	DefaultMaxBytes = 8 << 20
+	// DefaultAudience is the default audience of the Kubernetes tokens the
+	// endpoint accepts, e.g. from kubectl create token --audience.
+	DefaultAudience = "webapp-operator-upload"
+
+	// chunkDigestLength is how many hex digits of the digest chunk names carry.
+	chunkDigestLength = 12
+	// chunkSize keeps each ConfigMap well below the 1 MiB limit.
+	chunkSize = 768 << 10
+	// maxUnpackedRatio bounds the unpacked size relative to MaxBytes, against
+	// compression bombs.
+	maxUnpackedRatio = 16
+	// maxEntries bounds the number of files and directories in a tarball.
+	maxEntries = 10000
+
+	// tokenKey is the key of the token in the token Secret.
+	tokenKey = "token"
+	// revisionLabel records the upload revision on the chunk ConfigMaps.
+	revisionLabel = "apps.codewizard.io/upload-revision"
+	// component labels the chunk ConfigMaps.
+	component = "upload"
+	// shutdownTimeout bounds how long running uploads may finish on shutdown.
+	shutdownTimeout = 30 * time.Second
+)
+
+var uploadlog = logf.Log.WithName("upload")
+
+// ChunkName returns the name of the ConfigMap holding chunk i of the given
+// upload revision of the WebApp. The name carries the tarball's digest, so
+// concurrent uploads of the same revision never write the same chunks.
+func ChunkName(webapp string, revision int64, sha256 string, i int) string {
+	return fmt.Sprintf("%s-upload-%d-%.*s-%d", webapp, revision, chunkDigestLength, sha256, i)
+}
+
+// Server serves the upload endpoint. It runs on every replica of the manager.
+type Server struct {
+	// Client writes the ConfigMaps and WebApps, and reviews tokens.
+	Client client.Client
+	// Reader reads the token Secret and the WebApp, bypassing the cache.
+	Reader client.Reader
+	// Scheme sets the WebApp as the owner of the ConfigMaps.
+	Scheme *runtime.Scheme
+
+	// Addr is the address the endpoint binds to.
+	Addr string
+	// CertDir holds the tls.crt and tls.key the endpoint serves, reloaded when
+	// they change, e.g. the webhook server's certificate directory.
+	CertDir string
+	// TokenSecret names the Secret whose "token" key is accepted for the
+	// WebApps of the Secret's own namespace; each namespace holds its own.
+	// Without it, tokens are reviewed by the API server.
+	TokenSecret string
+	// Audience is the audience reviewed tokens must be issued for, so tokens
+	// meant for the API server or other services are refused. Defaults to
+	// DefaultAudience.
+	Audience string
+	// MaxBytes limits the size of the compressed tarball. Defaults to DefaultMaxBytes.
+	MaxBytes int64
+}
+
+var (
+	_ manager.Runnable               = &Server{}
+	_ manager.LeaderElectionRunnable = &Server{}
+)
+
+// Start serves the endpoint over TLS until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	watcher, err := certwatcher.New(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	if err != nil {
+		return fmt.Errorf("loading the serving certificate: %w", err)
+	}
+	go func() {
+		if err := watcher.Start(ctx); err != nil {
+			uploadlog.Error(err, "Watching the serving certificate")
+		}
+	}()
+
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{GetCertificate: watcher.GetCertificate, MinVersion: tls.VersionTLS12},
+	}
+	errc := make(chan error, 1)
+	go func() {
+		uploadlog.Info("Serving uploads", "addr", s.Addr)
+		errc <- srv.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errc:
+		return err
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: any replica can take uploads.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the handler of the endpoint.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /webapps/{namespace}/{name}/content", s.upload)
+	mux.HandleFunc("GET /webapps/{namespace}/{name}/status", s.status)
+	return mux
+}
+
+// requestError is an error answered with its status code.
+type requestError struct {
+	code    int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// fail answers the request with the error, hiding internal errors from the client.
+func fail(w http.ResponseWriter, key types.NamespacedName, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		uploadlog.Error(err, "Handling upload request", "webapp", key.String())
+		reqErr = &requestError{http.StatusInternalServerError, "internal error"}
+	}
+	if reqErr.code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="webapp-operator"`)
+	}
+	http.Error(w, reqErr.message, reqErr.code)
+}
+
+// upload stores the tarball in the request body as the next upload revision
+// of the WebApp and answers with the URL of its status.
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	if err := s.authorize(r, key, "update"); err != nil {
+		fail(w, key, err)
+		return
+	}
+
+	maxBytes := s.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		fail(w, key, &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("the tarball exceeds %d bytes", maxBytes)})
+		return
+	} else if err != nil {
+		fail(w, key, &requestError{http.StatusBadRequest, fmt.Sprintf("reading the tarball: %v", err)})
+		return
+	}
+	if err := validateTarball(body, maxBytes*maxUnpackedRatio); err != nil {
+		fail(w, key, &requestError{http.StatusBadRequest, err.Error()})
+		return
+	}
+
+	// A stale cached revision would make the upload collide with the served one
+	webapp := &webappv1.WebApp{}
+	if err := s.Reader.Get(ctx, key, webapp); apierrors.IsNotFound(err) {
+		fail(w, key, &requestError{http.StatusNotFound, fmt.Sprintf("WebApp %s not found", key)})
+		return
+	} else if err != nil {
+		fail(w, key, err)
+		return
+	}
+	if source := webapp.Spec.Source; source != nil && (source.Git != nil || source.Archive != nil || source.Volume != nil) {
+		fail(w, key, &requestError{http.StatusConflict, fmt.Sprintf("WebApp %s serves another source", key)})
+		return
+	}
+	if content := webapp.Spec.Content; (content != nil && (content.Markdown != nil || len(content.Locales) > 0)) || len(webapp.Spec.Pages) > 0 {
+		fail(w, key, &requestError{http.StatusConflict, fmt.Sprintf("WebApp %s serves rendered content or pages", key)})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	uploaded := webappv1.UploadSource{Image: "busybox:1.36"}
+	if webapp.Spec.Source != nil && webapp.Spec.Source.Upload != nil {
+		uploaded = *webapp.Spec.Source.Upload
+	}
+	uploaded.Revision++
+	uploaded.SHA256 = hex.EncodeToString(sum[:])
+	uploaded.Chunks = int32((len(body) + chunkSize - 1) / chunkSize)
+
+	chunks, err := s.storeChunks(ctx, webapp, uploaded, body)
+	if err != nil {
+		fail(w, key, err)
+		return
+	}
+	if webapp.Spec.Source == nil {
+		webapp.Spec.Source = &webappv1.SourceSpec{}
+	}
+	webapp.Spec.Source.Upload = &uploaded
+	err = s.Client.Update(ctx, webapp)
+	// Nothing refers to the chunks of a rejected update, so a retry starts afresh
+	if apierrors.IsConflict(err) || apierrors.IsInvalid(err) || apierrors.IsForbidden(err) {
+		s.deleteChunks(ctx, chunks)
+	}
+	if apierrors.IsConflict(err) {
+		fail(w, key, &requestError{http.StatusConflict, "the WebApp changed during the upload; retry"})
+		return
+	} else if apierrors.IsInvalid(err) || apierrors.IsForbidden(err) {
+		fail(w, key, &requestError{http.StatusUnprocessableEntity, err.Error()})
+		return
+	} else if err != nil {
+		fail(w, key, err)
+		return
+	}
+	uploadlog.Info("Stored upload", "webapp", key.String(), "revision", uploaded.Revision, "bytes", len(body))
+	statusURL := fmt.Sprintf("/webapps/%s/%s/status", key.Namespace, key.Name)
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"revision":  uploaded.Revision,
+		"sha256":    uploaded.SHA256,
+		"statusURL": statusURL,
+	})
+}
+
+// status reports the served upload revision and the rollout state of the WebApp.
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	if err := s.authorize(r, key, "get"); err != nil {
+		fail(w, key, err)
+		return
+	}
+	webapp := &webappv1.WebApp{}
+	if err := s.Client.Get(r.Context(), key, webapp); apierrors.IsNotFound(err) {
+		fail(w, key, &requestError{http.StatusNotFound, fmt.Sprintf("WebApp %s not found", key)})
+		return
+	} else if err != nil {
+		fail(w, key, err)
+		return
+	}
+
+	var revision int64
+	if webapp.Spec.Source != nil && webapp.Spec.Source.Upload != nil {
+		revision = webapp.Spec.Source.Upload.Revision
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"revision":      revision,
+		"generation":    webapp.Generation,
+		"phase":         webapp.Status.Phase,
+		"url":           webapp.Status.URL,
+		"readyReplicas": webapp.Status.ReadyReplicas,
+		"conditions":    webapp.Status.Conditions,
+	})
+}
+
+// authorize checks the bearer token of the request for the verb on the WebApp.
+func (s *Server) authorize(r *http.Request, key types.NamespacedName, verb string) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return &requestError{http.StatusUnauthorized, "a bearer token is required"}
+	}
+	ctx := r.Context()
+
+	if s.TokenSecret != "" {
+		// The token only reaches the WebApps of its Secret's namespace
+		secret := &corev1.Secret{}
+		err := s.Reader.Get(ctx, types.NamespacedName{Name: s.TokenSecret, Namespace: key.Namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			return &requestError{http.StatusUnauthorized, "invalid token"}
+		} else if err != nil {
+			return fmt.Errorf("reading token Secret: %w", err)
+		}
+		want := secret.Data[tokenKey]
+		if len(want) == 0 || subtle.ConstantTimeCompare([]byte(token), want) != 1 {
+			return &requestError{http.StatusUnauthorized, "invalid token"}
+		}
+		return nil
+	}
+
+	audience := s.Audience
+	if audience == "" {
+		audience = DefaultAudience
+	}
+	review := &authnv1.TokenReview{Spec: authnv1.TokenReviewSpec{Token: token, Audiences: []string{audience}}}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return fmt.Errorf("reviewing token: %w", err)
+	}
+	if !review.Status.Authenticated || !slices.Contains(review.Status.Audiences, audience) {
+		return &requestError{http.StatusUnauthorized, "invalid token"}
+	}
+	user := review.Status.User
+	extra := map[string]authzv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	access := &authzv1.SubjectAccessReview{Spec: authzv1.SubjectAccessReviewSpec{
+		User:   user.Username,
+		UID:    user.UID,
+		Groups: user.Groups,
+		Extra:  extra,
+		ResourceAttributes: &authzv1.ResourceAttributes{
+			Namespace: key.Namespace,
+			Verb:      verb,
+			Group:     webappv1.GroupVersion.Group,
+			Resource:  "webapps",
+			Name:      key.Name,
+		},
+	}}
+	if err := s.Client.Create(ctx, access); err != nil {
+		return fmt.Errorf("reviewing access: %w", err)
+	}
+	if !access.Status.Allowed {
+		return &requestError{http.StatusForbidden, fmt.Sprintf("%s may not %s WebApp %s", user.Username, verb, key)}
+	}
+	return nil
+}
+
+// storeChunks writes the tarball into immutable ConfigMaps owned by the WebApp
+// and returns them. A chunk that already exists belongs to a concurrent upload
+// of the same tarball, or to the served one after a stale read: it is never
+// replaced, and the upload fails with a conflict.
+func (s *Server) storeChunks(ctx context.Context, webapp *webappv1.WebApp, uploaded webappv1.UploadSource, data []byte) ([]*corev1.ConfigMap, error) {
+	revision := uploaded.Revision
+	var stored []*corev1.ConfigMap
+	for i := 0; len(data) > 0; i++ {
+		n := min(chunkSize, len(data))
+		immutable := true
+		chunk := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ChunkName(webapp.Name, revision, uploaded.SHA256, i),
+				Namespace: webapp.Namespace,
+				Labels:    ChunkLabels(webapp.Name),
+			},
+			BinaryData: map[string][]byte{ChunkKey: data[:n]},
+			Immutable:  &immutable,
+		}
+		chunk.Labels[revisionLabel] = strconv.FormatInt(revision, 10)
+		if err := ctrl.SetControllerReference(webapp, chunk, s.Scheme); err != nil {
+			s.deleteChunks(ctx, stored)
+			return nil, err
+		}
+
+		if err := s.Client.Create(ctx, chunk); err != nil {
+			s.deleteChunks(ctx, stored)
+			if apierrors.IsAlreadyExists(err) {
+				return nil, &requestError{http.StatusConflict, fmt.Sprintf("the chunks of upload %d already exist; retry", revision)}
+			}
+			return nil, fmt.Errorf("storing chunk %d: %w", i, err)
+		}
+		stored = append(stored, chunk)
+		data = data[n:]
+	}
+	return stored, nil
+}
+
+// deleteChunks removes the chunks an upload stored before it failed. Errors
+// are only logged: the operator prunes the chunks along with their revision.
+func (s *Server) deleteChunks(ctx context.Context, chunks []*corev1.ConfigMap) {
+	for _, chunk := range chunks {
+		if err := s.Client.Delete(ctx, chunk); client.IgnoreNotFound(err) != nil {
+			uploadlog.Error(err, "Deleting chunk of a failed upload", "name", chunk.Name, "namespace", chunk.Namespace)
+		}
+	}
+}
+
+// ChunkLabels returns the labels of the chunk ConfigMaps of the WebApp. They
+// leave out the selector labels of the WebApp's Pods and Service.
+func ChunkLabels(webapp string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/instance":   webapp,
+		"app.kubernetes.io/component":  component,
+		"app.kubernetes.io/managed-by": "webapp-operator",
+	}
+}
+
+// ChunkRevision returns the upload revision a chunk ConfigMap belongs to.
+func ChunkRevision(chunk *corev1.ConfigMap) (int64, bool) {
+	revision, err := strconv.ParseInt(chunk.Labels[revisionLabel], 10, 64)
+	return revision, err == nil
+}
+
+// validateTarball checks that data is a gzip-compressed tarball of regular
+// files and directories, with paths inside the site root, that unpacks to at
+// most maxUnpacked bytes.
+func validateTarball(data []byte, maxUnpacked int64) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("not a gzip-compressed tarball: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var unpacked int64
+	files := 0
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading the tarball: %v", err)
+		}
+		if entries >= maxEntries {
+			return fmt.Errorf("the tarball holds more than %d entries", maxEntries)
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if name != "" && name != "." && !fs.ValidPath(name) {
+			return fmt.Errorf("%s: paths must be relative and stay inside the site", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+			files++
+		default:
+			return fmt.Errorf("%s: only regular files and directories are allowed", hdr.Name)
+		}
+
+		unpacked += hdr.Size
+		if unpacked > maxUnpacked {
+			return fmt.Errorf("the tarball unpacks to more than %d bytes", maxUnpacked)
+		}
+		// Reading the content catches truncated and corrupt tarballs
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("reading %s: %v", hdr.Name, err)
+		}
+	}
+	if files == 0 {
+		return errors.New("the tarball holds no files")
+	}
+	return nil
+}
+
+// writeJSON answers with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,84 @@
+package upload
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+// entry is a tarball member; dirs have no content.
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+}
+
+func tarball(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0o644, Size: int64(len(e.content))}
+		if e.typeflag == tar.TypeSymlink {
+			hdr.Linkname, hdr.Size = "/etc/passwd", 0
+		}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode, hdr.Size = 0o755, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateTarball(t *testing.T) {
+	index := entry{name: "index.html", typeflag: tar.TypeReg, content: "<h1>hi</h1>"}
+	valid := tarball(t, entry{name: "./", typeflag: tar.TypeDir}, entry{name: "css/", typeflag: tar.TypeDir},
+		index, entry{name: "css/site.css", typeflag: tar.TypeReg, content: "h1{}"})
+
+	tests := []struct {
+		name        string
+		data        []byte
+		maxUnpacked int64
+		wantErr     string
+	}{
+		{name: "site", data: valid, maxUnpacked: 1024},
+		{name: "not gzip", data: []byte("index.html"), maxUnpacked: 1024, wantErr: "not a gzip-compressed tarball"},
+		{name: "truncated", data: valid[:len(valid)/2], maxUnpacked: 1024, wantErr: "reading"},
+		{name: "only directories", data: tarball(t, entry{name: "css/", typeflag: tar.TypeDir}), maxUnpacked: 1024,
+			wantErr: "holds no files"},
+		{name: "parent path", data: tarball(t, entry{name: "../index.html", typeflag: tar.TypeReg, content: "x"}), maxUnpacked: 1024,
+			wantErr: "stay inside the site"},
+		{name: "absolute path", data: tarball(t, entry{name: "/index.html", typeflag: tar.TypeReg, content: "x"}), maxUnpacked: 1024,
+			wantErr: "stay inside the site"},
+		{name: "symlink", data: tarball(t, index, entry{name: "passwd", typeflag: tar.TypeSymlink}), maxUnpacked: 1024,
+			wantErr: "only regular files and directories"},
+		{name: "too large unpacked", data: valid, maxUnpacked: 8, wantErr: "unpacks to more than 8 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTarball(tt.data, tt.maxUnpacked)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validateTarball() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validateTarball() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
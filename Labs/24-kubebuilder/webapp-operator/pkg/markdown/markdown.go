@@ -0,0 +1,89 @@
+// Package markdown renders the Markdown content of a WebApp to HTML. Unless
+// raw HTML is allowed, HTML embedded in the document is left out and links
+// with a script scheme (e.g. "javascript:") are dropped, so the page runs no
+// script from its author. A document may start with a YAML front-matter
+// block between "---" lines; its "title" sets the page title.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"sigs.k8s.io/yaml"
+)
+
+// frontMatterDelimiter opens and closes the front-matter block.
+const frontMatterDelimiter = "---"
+
+var scriptPattern = regexp.MustCompile(`(?i)<script[\s/>]`)
+
+var (
+	safe   = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	unsafe = goldmark.New(goldmark.WithExtensions(extension.GFM), goldmark.WithRendererOptions(html.WithUnsafe()))
+)
+
+// FrontMatter holds the recognized keys of the front-matter block.
+type FrontMatter struct {
+	Title string `json:"title,omitempty"`
+}
+
+// Page is a rendered document.
+type Page struct {
+	// Title is the title from the front matter, or empty if it sets none.
+	Title string
+	// Body is the HTML of the document without its front matter.
+	Body string
+}
+
+// HasScript reports whether the document embeds a script tag.
+func HasScript(source string) bool {
+	return scriptPattern.MatchString(source)
+}
+
+// SplitFrontMatter parses the leading front-matter block of the document, if
+// any, and returns it with the rest of the document.
+func SplitFrontMatter(source string) (FrontMatter, string, error) {
+	var front FrontMatter
+	first, rest, found := strings.Cut(source, "\n")
+	if !found || strings.TrimRight(first, " \r") != frontMatterDelimiter {
+		return front, source, nil
+	}
+
+	var block []string
+	for {
+		line, remaining, more := strings.Cut(rest, "\n")
+		if strings.TrimRight(line, " \r") == frontMatterDelimiter {
+			if err := yaml.Unmarshal([]byte(strings.Join(block, "\n")), &front); err != nil {
+				return FrontMatter{}, source, fmt.Errorf("parsing front matter: %w", err)
+			}
+			return front, remaining, nil
+		}
+		if !more {
+			return front, source, fmt.Errorf("front matter is not closed by a %q line", frontMatterDelimiter)
+		}
+		block = append(block, line)
+		rest = remaining
+	}
+}
+
+// Render renders the document, passing embedded HTML through only when
+// allowRawHTML is set. When the front matter does not parse, the error is
+// returned along with the whole document rendered as Markdown.
+func Render(source string, allowRawHTML bool) (Page, error) {
+	front, body, frontErr := SplitFrontMatter(source)
+
+	md := safe
+	if allowRawHTML {
+		md = unsafe
+	}
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(body), &buf); err != nil {
+		return Page{}, fmt.Errorf("rendering markdown: %w", err)
+	}
+	return Page{Title: front.Title, Body: buf.String()}, frontErr
+}
@@ -0,0 +1,60 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name, source string
+		wantTitle    string
+		wantBody     string
+		wantErr      bool
+	}{
+		{name: "no front matter", source: "# Hello\n", wantBody: "# Hello\n"},
+		{name: "title", source: "---\ntitle: Welcome\n---\n# Hello\n", wantTitle: "Welcome", wantBody: "# Hello\n"},
+		{name: "CRLF line endings", source: "---\r\ntitle: Welcome\r\n---\r\n# Hello", wantTitle: "Welcome", wantBody: "# Hello"},
+		{name: "unknown keys", source: "---\ntitle: Welcome\ndraft: true\n---\nbody", wantTitle: "Welcome", wantBody: "body"},
+		{name: "empty block", source: "---\n---\nbody", wantBody: "body"},
+		{name: "rule not at the start", source: "# Hello\n---\ntitle: x\n---\n", wantBody: "# Hello\n---\ntitle: x\n---\n"},
+		{name: "not closed", source: "---\ntitle: Welcome\n# Hello\n", wantBody: "---\ntitle: Welcome\n# Hello\n", wantErr: true},
+		{name: "invalid YAML", source: "---\ntitle: [\n---\nbody", wantBody: "---\ntitle: [\n---\nbody", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, body, err := SplitFrontMatter(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitFrontMatter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if front.Title != tt.wantTitle {
+				t.Errorf("SplitFrontMatter() title = %q, want %q", front.Title, tt.wantTitle)
+			}
+			if body != tt.wantBody {
+				t.Errorf("SplitFrontMatter() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRenderFrontMatter(t *testing.T) {
+	page, err := Render("---\ntitle: Welcome\n---\n# Hello\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Welcome" {
+		t.Errorf("Render() title = %q, want %q", page.Title, "Welcome")
+	}
+	if strings.Contains(page.Body, "title:") || !strings.Contains(page.Body, "<h1>Hello</h1>") {
+		t.Errorf("Render() body = %q, want only the rendered document", page.Body)
+	}
+
+	// A broken block is reported, and the whole document is still rendered
+	page, err = Render("---\ntitle: Welcome\n# Hello\n", false)
+	if err == nil {
+		t.Fatal("Render() of an unclosed front matter returned no error")
+	}
+	if !strings.Contains(page.Body, "<h1>Hello</h1>") {
+		t.Errorf("Render() body = %q, want the document rendered", page.Body)
+	}
+}
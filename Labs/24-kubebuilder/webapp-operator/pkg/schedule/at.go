@@ -0,0 +1,24 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// atLayouts are the accepted layouts of a wall-clock time, with and without seconds.
+var atLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// At parses a wall-clock time such as "2026-12-24T18:00" in the IANA time
+// zone timeZone; an empty zone means UTC.
+func At(value, timeZone string) (time.Time, error) {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, layout := range atLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time of the form 2006-01-02T15:04", value)
+}
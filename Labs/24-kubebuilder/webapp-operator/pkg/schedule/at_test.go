@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	tests := []struct {
+		name, value, timeZone string
+		want                  time.Time
+		wantErr               bool
+	}{
+		{name: "minutes in UTC", value: "2026-12-24T18:00", want: time.Date(2026, 12, 24, 18, 0, 0, 0, time.UTC)},
+		{name: "seconds", value: "2026-12-24T18:00:30", timeZone: "UTC", want: time.Date(2026, 12, 24, 18, 0, 30, 0, time.UTC)},
+		{name: "in a time zone", value: "2026-07-01T09:30", timeZone: "Europe/Berlin", want: time.Date(2026, 7, 1, 9, 30, 0, 0, berlin)},
+		{name: "unknown time zone", value: "2026-07-01T09:30", timeZone: "Mars/Olympus", wantErr: true},
+		{name: "date only", value: "2026-07-01", wantErr: true},
+		{name: "with an offset", value: "2026-07-01T09:30:00Z", wantErr: true},
+		{name: "invalid date", value: "2026-02-30T09:30", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := At(tt.value, tt.timeZone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("At(%q, %q) error = %v, wantErr %v", tt.value, tt.timeZone, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("At(%q, %q) = %v, want %v", tt.value, tt.timeZone, got, tt.want)
+			}
+		})
+	}
+}